@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons a submission or notification was suppressed as a duplicate
+const (
+	dedupIdempotency = "idempotency"
+	dedupThrottle    = "throttle"
+)
+
+// dedupStatsRetention bounds how far back suppression events are kept
+const dedupStatsRetention = 7 * 24 * time.Hour
+
+// dedupStats records when duplicates were suppressed, by reason
+type dedupStats struct {
+	mu     sync.Mutex
+	clock  Clock
+	events map[string][]time.Time
+}
+
+var suppressions = &dedupStats{clock: systemClock, events: make(map[string][]time.Time)}
+
+// Record notes one suppression for reason
+func (d *dedupStats) Record(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	events := d.events[reason]
+
+	// Drop events past retention so the slice stays bounded
+	cutoff := now.Add(-dedupStatsRetention)
+	for len(events) > 0 && events[0].Before(cutoff) {
+		events = events[1:]
+	}
+	d.events[reason] = append(events, now)
+}
+
+// Counts returns the number of suppressions per reason within window.
+// Every known reason is present, with zero when there were none.
+func (d *dedupStats) Counts(window time.Duration) map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := d.clock.Now().Add(-window)
+	counts := map[string]int{
+		dedupIdempotency: 0,
+		dedupThrottle:    0,
+	}
+	for reason, events := range d.events {
+		for _, t := range events {
+			if !t.Before(cutoff) {
+				counts[reason]++
+			}
+		}
+	}
+	return counts
+}
+
+// requireAdmin only lets requests through that carry ADMIN_API_KEY in the
+// X-API-Key header or as a bearer token. Admin routes are disabled (404)
+// when no key is configured.
+func requireAdmin(cfg *Config, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminAPIKey == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleDedupStats reports suppressed duplicates by reason over ?window=
+// (a Go duration, default 24h)
+func handleDedupStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window": window.String(),
+		"counts": suppressions.Counts(window),
+	})
+}
+
+// handleListSubmissions lists submissions created within ?since= (a Go
+// duration, default 24h), newest first
+func handleListSubmissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since := 24 * time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+
+	subs, err := store.ListSubmissions(systemClock.Now().Add(-since))
+	if err != nil {
+		log.Printf("Failed to list submissions: %v", err)
+		http.Error(w, "Failed to list submissions", http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []Submission{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":       len(subs),
+		"submissions": subs,
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useSuppressions replaces the package suppression counters with empty ones
+// on clock for the duration of the test
+func useSuppressions(t *testing.T, clock Clock) *dedupStats {
+	t.Helper()
+	stats := &dedupStats{clock: clock, events: make(map[string][]time.Time)}
+	previous := suppressions
+	suppressions = stats
+	t.Cleanup(func() { suppressions = previous })
+	return stats
+}
+
+func TestDedupStatsCounts(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	stats := &dedupStats{clock: clock, events: make(map[string][]time.Time)}
+
+	want := map[string]int{dedupIdempotency: 0, dedupThrottle: 0}
+	if got := stats.Counts(time.Hour); !maps.Equal(got, want) {
+		t.Errorf("empty Counts = %v, want %v", got, want)
+	}
+
+	stats.Record(dedupThrottle)
+	clock.Advance(30 * time.Minute)
+	stats.Record(dedupIdempotency)
+	stats.Record(dedupThrottle)
+
+	if got, want := stats.Counts(time.Hour), map[string]int{dedupIdempotency: 1, dedupThrottle: 2}; !maps.Equal(got, want) {
+		t.Errorf("Counts(1h) = %v, want %v", got, want)
+	}
+	if got, want := stats.Counts(10*time.Minute), map[string]int{dedupIdempotency: 1, dedupThrottle: 1}; !maps.Equal(got, want) {
+		t.Errorf("Counts(10m) = %v, want %v", got, want)
+	}
+}
+
+func TestDedupStatsRetention(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	stats := &dedupStats{clock: clock, events: make(map[string][]time.Time)}
+
+	stats.Record(dedupThrottle)
+	clock.Advance(dedupStatsRetention + time.Minute)
+	stats.Record(dedupThrottle)
+
+	if n := len(stats.events[dedupThrottle]); n != 1 {
+		t.Errorf("kept %d events, want 1 (older ones pruned)", n)
+	}
+}
+
+func TestHandleDedupStats(t *testing.T) {
+	stats := useSuppressions(t, newFakeClock(testEpoch))
+	stats.Record(dedupIdempotency)
+
+	handler := requireAdmin(&Config{AdminAPIKey: "secret"}, handleDedupStats)
+
+	tests := []struct {
+		name   string
+		url    string
+		key    string
+		status int
+	}{
+		{"no key", "/api/admin/dedup-stats", "", http.StatusUnauthorized},
+		{"wrong key", "/api/admin/dedup-stats", "nope", http.StatusUnauthorized},
+		{"bad window", "/api/admin/dedup-stats?window=soon", "secret", http.StatusBadRequest},
+		{"ok", "/api/admin/dedup-stats?window=1h", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if tt.key != "" {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Window string         `json:"window"`
+				Counts map[string]int `json:"counts"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			want := map[string]int{dedupIdempotency: 1, dedupThrottle: 0}
+			if body.Window != "1h0m0s" || !maps.Equal(body.Counts, want) {
+				t.Errorf("body = %+v, want window 1h0m0s and counts %v", body, want)
+			}
+		})
+	}
+}
+
+func TestRequireAdminDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	requireAdmin(&Config{}, handleDedupStats)(w, httptest.NewRequest("GET", "/api/admin/dedup-stats", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 without ADMIN_API_KEY", w.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+// defaultAutoresponderSubject and defaultAutoresponderTemplate are used when
+// AUTORESPONDER_SUBJECT / AUTORESPONDER_TEMPLATE are unset
+const (
+	defaultAutoresponderSubject  = "We received your message"
+	defaultAutoresponderTemplate = `Hi {{.FirstName}},
+
+Thanks for reaching out to Sogos. We've received your message and will be in touch within 24 hours.
+{{with .Reference}}
+Your confirmation number is {{.}}.
+{{end}}
+— The Sogos team
+`
+)
+
+// autoresponderData is what the autoresponder templates render: the
+// submission's fields plus the confirmation number and first name
+type autoresponderData struct {
+	ContactRequest
+	Reference string
+	FirstName string
+}
+
+// parseAutoresponderTemplates parses AUTORESPONDER_SUBJECT and
+// AUTORESPONDER_TEMPLATE (text/templates over autoresponderData), falling
+// back to the defaults for unset ones
+func parseAutoresponderTemplates(cfg *Config) (*template.Template, *template.Template, error) {
+	subjectText := cfg.AutoresponderSubject
+	if subjectText == "" {
+		subjectText = defaultAutoresponderSubject
+	}
+	bodyText := cfg.AutoresponderTemplate
+	if bodyText == "" {
+		bodyText = defaultAutoresponderTemplate
+	}
+
+	subject, err := template.New("subject").Parse(subjectText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid AUTORESPONDER_SUBJECT: %w", err)
+	}
+	body, err := template.New("body").Parse(bodyText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid AUTORESPONDER_TEMPLATE: %w", err)
+	}
+	return subject, body, nil
+}
+
+// renderAutoresponder returns the subject and body of the confirmation
+// email for req
+func renderAutoresponder(cfg *Config, req ContactRequest, reference string) (string, string, error) {
+	subjectTmpl, bodyTmpl, err := parseAutoresponderTemplates(cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	firstName, _ := parseName(req.Name)
+	data := autoresponderData{
+		ContactRequest: req,
+		Reference:      reference,
+		FirstName:      firstName,
+	}
+
+	var subject, body strings.Builder
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// sendAutoresponder emails the submitter a confirmation that their message
+// arrived, when SEND_AUTORESPONDER is set. It is best-effort: failures are
+// logged and never affect the submission. Replies go to the address that
+// received the lead notification.
+func sendAutoresponder(cfg *Config, req ContactRequest, reference string) {
+	if !envBool("SEND_AUTORESPONDER") || !isValidEmail(req.Email) {
+		return
+	}
+
+	apiKey := cfg.MailgunAPIKey
+	domain := cfg.MailgunDomain
+	if apiKey == "" || domain == "" {
+		log.Printf("Warning: Autoresponder skipped: mailgun configuration missing")
+		return
+	}
+
+	subject, body, err := renderAutoresponder(cfg, req, reference)
+	if err != nil {
+		log.Printf("Warning: Failed to render autoresponder: %v", err)
+		return
+	}
+
+	subject, recipients, err := applyMailgunSandbox(cfg, subject, []string{strings.TrimSpace(req.Email)})
+	if err != nil {
+		log.Printf("Warning: Autoresponder not sent: %v", err)
+		return
+	}
+
+	mg := mailgun.NewMailgun(domain, apiKey)
+	m := mg.NewMessage(fmt.Sprintf("Sogos <noreply@%s>", domain), subject, body, recipients...)
+	m.SetReplyTo(notificationRecipient(cfg, req.Service))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if _, _, err := mg.Send(ctx, m); err != nil {
+		log.Printf("Warning: Failed to send autoresponder to %s: %v", req.Email, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff strategies
+const (
+	backoffFull  = "full"  // random delay in [0, exp)
+	backoffEqual = "equal" // exp/2 plus a random delay in [0, exp/2)
+	backoffFixed = "fixed" // always the base delay
+)
+
+// Backoff computes retry delays. exp is Base doubled for each attempt and
+// capped at Max; the strategy decides how much jitter is applied to it.
+type Backoff struct {
+	Strategy string
+	Base     time.Duration
+	Max      time.Duration
+
+	// Rand returns a number in [0, 1); it is the jitter source
+	Rand func() float64
+}
+
+// Delay returns how long to wait before retry number attempt (1-based)
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Strategy == backoffFixed {
+		return b.Base
+	}
+
+	exp := b.Base
+	for i := 1; i < attempt && (b.Max <= 0 || exp < b.Max); i++ {
+		exp *= 2
+	}
+	if b.Max > 0 && exp > b.Max {
+		exp = b.Max
+	}
+
+	random := b.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+
+	switch b.Strategy {
+	case backoffEqual:
+		half := exp / 2
+		return half + time.Duration(random()*float64(exp-half))
+	default:
+		return time.Duration(random() * float64(exp))
+	}
+}
+
+// retryBackoff returns the Backoff configured by RETRY_BACKOFF
+// (full|equal|fixed, default full), RETRY_BASE_DELAY (default 200ms) and
+// RETRY_MAX_DELAY (default 10s). All retrying callers share it.
+func retryBackoff(cfg *Config) Backoff {
+	strategy := cfg.RetryBackoff
+	if strategy == "" {
+		strategy = backoffFull
+	}
+	return Backoff{
+		Strategy: strategy,
+		Base:     envDuration("RETRY_BASE_DELAY", 200*time.Millisecond),
+		Max:      envDuration("RETRY_MAX_DELAY", 10*time.Second),
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fixedRand returns a jitter source that always yields v
+func fixedRand(v float64) func() float64 {
+	return func() float64 { return v }
+}
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		attempt int
+		want    time.Duration
+	}{
+		{"full, first retry", Backoff{Strategy: backoffFull, Base: 100 * time.Millisecond, Rand: fixedRand(0.5)}, 1, 50 * time.Millisecond},
+		{"full, doubles", Backoff{Strategy: backoffFull, Base: 100 * time.Millisecond, Rand: fixedRand(0.5)}, 3, 200 * time.Millisecond},
+		{"full, zero jitter", Backoff{Strategy: backoffFull, Base: 100 * time.Millisecond, Rand: fixedRand(0)}, 3, 0},
+		{"full, capped", Backoff{Strategy: backoffFull, Base: 100 * time.Millisecond, Max: 300 * time.Millisecond, Rand: fixedRand(0.5)}, 10, 150 * time.Millisecond},
+		{"equal, no jitter", Backoff{Strategy: backoffEqual, Base: 100 * time.Millisecond, Rand: fixedRand(0)}, 2, 100 * time.Millisecond},
+		{"equal, most jitter", Backoff{Strategy: backoffEqual, Base: 100 * time.Millisecond, Rand: fixedRand(0.99)}, 2, 199 * time.Millisecond},
+		{"equal, capped", Backoff{Strategy: backoffEqual, Base: time.Second, Max: 2 * time.Second, Rand: fixedRand(0.5)}, 5, 1500 * time.Millisecond},
+		{"fixed ignores attempt", Backoff{Strategy: backoffFixed, Base: 100 * time.Millisecond, Rand: fixedRand(0.5)}, 5, 100 * time.Millisecond},
+		{"unknown strategy is full", Backoff{Strategy: "linear", Base: 100 * time.Millisecond, Rand: fixedRand(0.5)}, 2, 100 * time.Millisecond},
+		{"huge attempt stays capped", Backoff{Strategy: backoffFull, Base: time.Second, Max: 10 * time.Second, Rand: fixedRand(0.5)}, 1000, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.backoff.Delay(tt.attempt); got != tt.want {
+			t.Errorf("%s: Delay(%d) = %v, want %v", tt.name, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffDefaultRandInRange(t *testing.T) {
+	b := Backoff{Strategy: backoffEqual, Base: 100 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(1); d < 50*time.Millisecond || d >= 100*time.Millisecond {
+			t.Fatalf("Delay(1) = %v, want within [50ms, 100ms)", d)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"", backoffFull},
+		{"equal", backoffEqual},
+		{"fixed", backoffFixed},
+	}
+	for _, tt := range tests {
+		t.Setenv("RETRY_BASE_DELAY", "1s")
+		t.Setenv("RETRY_MAX_DELAY", "")
+		b := retryBackoff(&Config{RetryBackoff: tt.strategy})
+		if b.Strategy != tt.want || b.Base != time.Second || b.Max != 10*time.Second {
+			t.Errorf("RETRY_BACKOFF=%q: %+v", tt.strategy, b)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+)
+
+// botUserAgentMatch reports whether ua looks like a bot: it contains one of
+// the BOT_USER_AGENTS patterns (comma-separated, case-insensitive
+// substrings), or it is empty and REJECT_EMPTY_USER_AGENT is set
+func botUserAgentMatch(cfg *Config, ua string) bool {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return envBool("REJECT_EMPTY_USER_AGENT")
+	}
+
+	for _, pattern := range cfg.BotUserAgents {
+		if strings.Contains(ua, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// botResponseForbidden reports whether bot submissions get 403
+// (BOT_UA_RESPONSE=forbidden) rather than the default silent 200, which
+// doesn't tell the bot it was caught
+func botResponseForbidden(cfg *Config) bool {
+	return cfg.BotUAResponse == "forbidden"
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const browserUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_3) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.3 Safari/605.1.15"
+
+func TestBotUserAgentMatch(t *testing.T) {
+	cfg := &Config{BotUserAgents: []string{"curl", "python-requests", "HeadlessChrome"}}
+	tests := []struct {
+		ua         string
+		rejectNone string
+		want       bool
+	}{
+		{"curl/8.4.0", "", true},
+		{"Python-Requests/2.31", "", true},
+		{"Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/120.0", "", true},
+		{browserUserAgent, "", false},
+		{"", "", false},
+		{"  ", "true", true},
+		{browserUserAgent, "true", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("REJECT_EMPTY_USER_AGENT", tt.rejectNone)
+		if got := botUserAgentMatch(cfg, tt.ua); got != tt.want {
+			t.Errorf("botUserAgentMatch(%q) with REJECT_EMPTY_USER_AGENT=%q = %v, want %v", tt.ua, tt.rejectNone, got, tt.want)
+		}
+	}
+}
+
+func postContactAs(cfg *Config, userAgent string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(validContactBody))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", userAgent)
+	handleContact(cfg)(w, r)
+	return w
+}
+
+func TestHandleContactBotUserAgent(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+	cfg.BotUserAgents = []string{"python-requests"}
+	out := captureStandardLog(t)
+
+	// Bots get a silent success without anything being created
+	w := postContactAs(cfg, "python-requests/2.31")
+	if w.Code != http.StatusOK || !responseOf(t, w).Success {
+		t.Errorf("bot: status = %d, want a silent 200", w.Code)
+	}
+	if n := len(stub.operations()); n != 0 {
+		t.Errorf("bot submission made %d CRM calls, want none", n)
+	}
+	if !strings.Contains(out.String(), `Rejected bot submission (user agent "python-requests/2.31")`) {
+		t.Errorf("log = %q, want the user agent logged", out.String())
+	}
+
+	cfg.BotUAResponse = "forbidden"
+	if w := postContactAs(cfg, "python-requests/2.31"); w.Code != http.StatusForbidden {
+		t.Errorf("bot with BOT_UA_RESPONSE=forbidden: status = %d, want 403", w.Code)
+	}
+
+	// Browsers are processed as usual
+	if w := postContactAs(cfg, browserUserAgent); w.Code != http.StatusOK || stub.count("CreatePerson") != 1 {
+		t.Errorf("browser: status = %d, %d people created; want the lead processed", w.Code, stub.count("CreatePerson"))
+	}
+}
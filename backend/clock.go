@@ -0,0 +1,21 @@
+package main
+
+import "time"
+
+// Clock abstracts time so time-based logic (TTLs, windows, retry delays)
+// can be driven deterministically
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// realClock is the Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// systemClock is the Clock used outside of tests
+var systemClock Clock = realClock{}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when Advance (or Sleep) is called
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+// fakeWaiter is a pending After channel and the time it fires at
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Sleep advances the clock instead of blocking
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance moves the clock forward, firing any After channels that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns how many After channels have not fired yet
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// waitForWaiters blocks until n After channels are pending on clock, so a
+// test can advance time only once a goroutine is waiting on it
+func waitForWaiters(t *testing.T, clock *fakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for clock.Waiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d clock waiters, have %d", n, clock.Waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// testEpoch is the fixed start time of fake clocks
+var testEpoch = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// useMemoryStore replaces the package store with a fresh in-memory store on
+// a fake clock for the duration of the test
+func useMemoryStore(t *testing.T) (*memoryStore, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock(testEpoch)
+	mem := newMemoryStore(clock)
+	previous := store
+	store = mem
+	t.Cleanup(func() { store = previous })
+	return mem, clock
+}
+
+// useSystemClock replaces systemClock with a fake clock for the duration of
+// the test
+func useSystemClock(t *testing.T) *fakeClock {
+	t.Helper()
+	clock := newFakeClock(testEpoch)
+	previous := systemClock
+	systemClock = clock
+	t.Cleanup(func() { systemClock = previous })
+	return clock
+}
+
+func TestFakeClockAfter(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	ch := clock.After(time.Minute)
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("After fired early")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case at := <-ch:
+		if !at.Equal(testEpoch.Add(time.Minute)) {
+			t.Errorf("fired at %v, want %v", at, testEpoch.Add(time.Minute))
+		}
+	default:
+		t.Fatal("After did not fire")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("Waiters() = %d, want 0", clock.Waiters())
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	clock.Sleep(time.Hour)
+	if got := clock.Now(); !got.Equal(testEpoch.Add(time.Hour)) {
+		t.Errorf("Now() = %v, want %v", got, testEpoch.Add(time.Hour))
+	}
+}
+
+func TestMemoryStoreIncrTTL(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	s := newMemoryStore(clock)
+
+	for want := int64(1); want <= 3; want++ {
+		if n, _ := s.Incr("k", time.Minute); n != want {
+			t.Fatalf("Incr = %d, want %d", n, want)
+		}
+	}
+
+	// The window is fixed from the first Incr, not extended by later ones
+	clock.Advance(time.Minute)
+	if n, _ := s.Incr("k", time.Minute); n != 1 {
+		t.Errorf("Incr after expiry = %d, want 1", n)
+	}
+}
+
+func TestMemoryStoreNoTTL(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	s := newMemoryStore(clock)
+
+	s.Incr("k", 0)
+	clock.Advance(365 * 24 * time.Hour)
+	if n, _ := s.Incr("k", 0); n != 2 {
+		t.Errorf("Incr = %d, want 2 (no TTL never expires)", n)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CompanyMatch is a company returned by the company search
+type CompanyMatch struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// CompanyMerge is a submission whose company matched several stored
+// companies, queued for someone to reconcile in Twenty
+type CompanyMerge struct {
+	// ID identifies the candidate set, so repeats of the same ambiguity
+	// update one entry instead of queueing another
+	ID            string         `json:"id"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+	SubmittedName string         `json:"submittedName"`
+	Website       string         `json:"website,omitempty"`
+	Candidates    []CompanyMatch `json:"candidates"`
+	ChosenID      string         `json:"chosenId"`
+	Occurrences   int            `json:"occurrences"`
+}
+
+// companyHost returns the lowercased host of a company URL without "www."
+func companyHost(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// bestCompanyMatch picks the company a lead should attach to from the
+// search matches, and reports whether the choice was ambiguous: more than
+// one stored company has the submitted name or website domain. Matches on
+// both beat a domain match, which beats a name match; with no strong match
+// the first result is used, as before.
+func bestCompanyMatch(matches []CompanyMatch, name, website string) (CompanyMatch, []CompanyMatch, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	host := companyHost(website)
+
+	var strong []CompanyMatch
+	best, bestScore := matches[0], 0
+	for _, m := range matches {
+		score := 0
+		if host != "" && companyHost(m.Domain) == host {
+			score += 2
+		}
+		if strings.ToLower(strings.TrimSpace(m.Name)) == name {
+			score++
+		}
+		if score == 0 {
+			continue
+		}
+		strong = append(strong, m)
+		if score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+
+	return best, strong, len(strong) > 1
+}
+
+// companyMergeID derives a stable ID from the candidate company IDs
+func companyMergeID(candidates []CompanyMatch) string {
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, "+")
+}
+
+// queueCompanyMerge records an ambiguous company match for review
+// (best-effort)
+func queueCompanyMerge(name, website string, candidates []CompanyMatch, chosenID string) {
+	merge := &CompanyMerge{
+		ID:            companyMergeID(candidates),
+		SubmittedName: name,
+		Website:       website,
+		Candidates:    candidates,
+		ChosenID:      chosenID,
+	}
+	if err := store.SaveCompanyMerge(merge); err != nil {
+		log.Printf("Warning: Failed to queue company merge for %q: %v", name, err)
+		return
+	}
+	log.Printf("Company %q matched %d stored companies, queued for merge review", name, len(candidates))
+}
+
+// handleListCompanyMerges lists the company merge review queue, most
+// recently seen first
+func handleListCompanyMerges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	merges, err := store.ListCompanyMerges()
+	if err != nil {
+		log.Printf("Failed to list company merges: %v", err)
+		http.Error(w, "Failed to list company merges", http.StatusInternalServerError)
+		return
+	}
+	if merges == nil {
+		merges = []CompanyMerge{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(merges),
+		"merges": merges,
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompanyHost(t *testing.T) {
+	tests := map[string]string{
+		"":                             "",
+		"https://www.Acme.com/about":   "acme.com",
+		"acme.com":                     "acme.com",
+		"http://shop.acme.com:8080/x":  "shop.acme.com",
+		"https://www.acme.co.uk?ref=1": "acme.co.uk",
+	}
+	for in, want := range tests {
+		if got := companyHost(in); got != want {
+			t.Errorf("companyHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBestCompanyMatch(t *testing.T) {
+	acme := CompanyMatch{ID: "c1", Name: "Acme", Domain: "https://acme.com"}
+	acmeInc := CompanyMatch{ID: "c2", Name: "ACME Inc", Domain: "https://www.acme.com"}
+	acmeOld := CompanyMatch{ID: "c3", Name: "acme", Domain: "https://acme-old.com"}
+	acmeLabs := CompanyMatch{ID: "c4", Name: "Acme Labs", Domain: "https://acmelabs.com"}
+
+	tests := []struct {
+		name          string
+		matches       []CompanyMatch
+		website       string
+		wantID        string
+		wantAmbiguous bool
+	}{
+		{"single exact match", []CompanyMatch{acmeLabs, acme}, "", "c1", false},
+		{"same name twice", []CompanyMatch{acme, acmeOld}, "", "c1", true},
+		{"same domain, different names", []CompanyMatch{acme, acmeInc}, "acme.com", "c1", true},
+		{"domain beats name", []CompanyMatch{acmeOld, acmeInc}, "https://acme.com", "c2", true},
+		{"domain and name beat domain", []CompanyMatch{acmeInc, acme}, "acme.com", "c1", true},
+		{"only partial matches", []CompanyMatch{acmeLabs, acmeInc}, "", "c4", false},
+	}
+	for _, tt := range tests {
+		best, candidates, ambiguous := bestCompanyMatch(tt.matches, "Acme", tt.website)
+		if best.ID != tt.wantID || ambiguous != tt.wantAmbiguous {
+			t.Errorf("%s: best = %s, ambiguous = %v; want %s, %v", tt.name, best.ID, ambiguous, tt.wantID, tt.wantAmbiguous)
+		}
+		if ambiguous && len(candidates) < 2 {
+			t.Errorf("%s: candidates = %v, want every strong match", tt.name, candidates)
+		}
+	}
+}
+
+func TestFindOrCreateCompanyQueuesAmbiguousMatch(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	t.Setenv("COMPANY_MERGE_QUEUE", "true")
+	stub.on("FindCompany", `{"data":{"companies":{"edges":[
+		{"node":{"id":"c-labs","name":"Acme Labs","domainName":{"primaryLinkUrl":"https://acmelabs.com"}}},
+		{"node":{"id":"c-old","name":"Acme Corp","domainName":{"primaryLinkUrl":"https://acme.com"}}},
+		{"node":{"id":"c-best","name":"Acme","domainName":{"primaryLinkUrl":"https://www.acme.com"}}}]}}}`)
+
+	for i := 0; i < 2; i++ {
+		id, err := findOrCreateCompany(context.Background(), cfg, "Acme", "https://acme.com", 0)
+		if err != nil || id != "c-best" {
+			t.Fatalf("findOrCreateCompany = %q, %v; want the best candidate", id, err)
+		}
+	}
+	if n := stub.count("CreateCompany"); n != 0 {
+		t.Errorf("%d companies created, want none", n)
+	}
+
+	// The search also looks for companies stored under the same domain
+	if filter := stub.variables("FindCompany")["filter"].(map[string]interface{}); filter["or"] == nil {
+		t.Errorf("filter = %v, want name or domain", filter)
+	}
+
+	w := httptest.NewRecorder()
+	handleListCompanyMerges(w, httptest.NewRequest("GET", "/api/admin/company-merges", nil))
+	var got struct {
+		Count  int            `json:"count"`
+		Merges []CompanyMerge `json:"merges"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.Count != 1 {
+		t.Fatalf("merges = %+v, want one queued entry", got.Merges)
+	}
+	merge := got.Merges[0]
+	if merge.ID != "c-best+c-old" || merge.ChosenID != "c-best" || merge.SubmittedName != "Acme" || merge.Occurrences != 2 || len(merge.Candidates) != 2 {
+		t.Errorf("merge = %+v", merge)
+	}
+}
+
+func TestFindOrCreateCompanyWithoutMergeQueue(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	t.Setenv("COMPANY_MERGE_QUEUE", "")
+	stub.on("FindCompany", `{"data":{"companies":{"edges":[
+		{"node":{"id":"c-old","name":"Acme"}},
+		{"node":{"id":"c-best","name":"Acme"}}]}}}`)
+
+	if id, _ := findOrCreateCompany(context.Background(), cfg, "Acme", "https://acme.com", 0); id != "c-old" {
+		t.Errorf("company = %q, want the first result", id)
+	}
+	if merges, _ := store.ListCompanyMerges(); len(merges) != 0 {
+		t.Errorf("merges = %+v with the queue off", merges)
+	}
+
+	w := httptest.NewRecorder()
+	handleListCompanyMerges(w, httptest.NewRequest("GET", "/api/admin/company-merges", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "{\"count\":0,\"merges\":[]}\n" {
+		t.Errorf("empty queue = %d %q", w.Code, w.Body.String())
+	}
+}
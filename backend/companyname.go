@@ -0,0 +1,82 @@
+package main
+
+import "strings"
+
+// maxCompanyNameLength caps normalized company names
+const maxCompanyNameLength = 100
+
+// companySuffixes maps legal suffixes (lowercase, periods removed) to their
+// standard spelling
+var companySuffixes = map[string]string{
+	"inc":          "Inc",
+	"incorporated": "Inc",
+	"llc":          "LLC",
+	"ltd":          "Ltd",
+	"limited":      "Ltd",
+	"corp":         "Corp",
+	"corporation":  "Corp",
+	"co":           "Co",
+	"gmbh":         "GmbH",
+	"plc":          "PLC",
+	"llp":          "LLP",
+}
+
+// normalizeCompanyName tidies a company name for display when
+// COMPANY_NAME_NORMALIZE is set (off by default). The rules, in order:
+//
+//   - whitespace is trimmed and runs of spaces collapsed;
+//   - with COMPANY_NAME_TITLE_CASE, a name typed entirely in upper or lower
+//     case is title-cased, keeping all-caps words of up to 3 letters in an
+//     all-caps name as acronyms ("ACME IT SERVICES" → "Acme IT Services");
+//     mixed-case names are left alone;
+//   - with COMPANY_NAME_SUFFIXES, a trailing legal suffix is standardized
+//     ("Acme, Inc." → "Acme Inc", "acme l.l.c." → "acme LLC");
+//   - the result is truncated to maxCompanyNameLength characters.
+func normalizeCompanyName(name string) string {
+	if !envBool("COMPANY_NAME_NORMALIZE") {
+		return name
+	}
+
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return ""
+	}
+
+	if envBool("COMPANY_NAME_TITLE_CASE") {
+		words = titleCaseCompanyWords(words)
+	}
+
+	if envBool("COMPANY_NAME_SUFFIXES") && len(words) > 1 {
+		last := len(words) - 1
+		key := strings.ToLower(strings.ReplaceAll(words[last], ".", ""))
+		if suffix, ok := companySuffixes[key]; ok {
+			words[last] = suffix
+			words[last-1] = strings.TrimSuffix(words[last-1], ",")
+		}
+	}
+
+	name = strings.Join(words, " ")
+	if runes := []rune(name); len(runes) > maxCompanyNameLength {
+		name = strings.TrimSpace(string(runes[:maxCompanyNameLength]))
+	}
+	return name
+}
+
+// titleCaseCompanyWords title-cases the words of a single-case name
+func titleCaseCompanyWords(words []string) []string {
+	joined := strings.Join(words, " ")
+	allUpper := joined == strings.ToUpper(joined)
+	if !allUpper && joined != strings.ToLower(joined) {
+		return words
+	}
+
+	cased := make([]string, len(words))
+	for i, word := range words {
+		if allUpper && len([]rune(word)) <= 3 {
+			cased[i] = word
+			continue
+		}
+		cased[i] = capitalizeNamePart(strings.ToLower(word))
+	}
+	return cased
+}
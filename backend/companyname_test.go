@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCompanyName(t *testing.T) {
+	tests := []struct {
+		name      string
+		titleCase string
+		suffixes  string
+		in        string
+		want      string
+	}{
+		{"whitespace", "", "", "  Acme   Design\tStudio ", "Acme Design Studio"},
+		{"mixed case kept", "", "", "acme DESIGN", "acme DESIGN"},
+		{"empty", "true", "true", "   ", ""},
+		{"all caps title-cased", "true", "", "ACME IT SERVICES", "Acme IT Services"},
+		{"lower case title-cased", "true", "", "acme it services", "Acme It Services"},
+		{"mixed case left alone", "true", "", "eBay Marketplace", "eBay Marketplace"},
+		{"suffix standardized", "", "true", "Acme, Inc.", "Acme Inc"},
+		{"dotted suffix", "", "true", "acme l.l.c.", "acme LLC"},
+		{"long suffix", "", "true", "Acme Corporation", "Acme Corp"},
+		{"suffix alone isn't touched", "", "true", "Inc.", "Inc."},
+		{"suffix only at the end", "", "true", "Inc. Magazine", "Inc. Magazine"},
+		{"both rules", "true", "true", "ACME WIDGETS, INC.", "Acme Widgets Inc"},
+		{"acronym suffix", "true", "true", "SOGOS GMBH", "Sogos GmbH"},
+	}
+	t.Setenv("COMPANY_NAME_NORMALIZE", "true")
+	for _, tt := range tests {
+		t.Setenv("COMPANY_NAME_TITLE_CASE", tt.titleCase)
+		t.Setenv("COMPANY_NAME_SUFFIXES", tt.suffixes)
+		if got := normalizeCompanyName(tt.in); got != tt.want {
+			t.Errorf("%s: normalizeCompanyName(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCompanyNameTruncates(t *testing.T) {
+	t.Setenv("COMPANY_NAME_NORMALIZE", "true")
+	got := normalizeCompanyName(strings.Repeat("é", maxCompanyNameLength+10))
+	if n := len([]rune(got)); n != maxCompanyNameLength {
+		t.Errorf("normalized name has %d characters, want %d", n, maxCompanyNameLength)
+	}
+}
+
+func TestNormalizeCompanyNameOffByDefault(t *testing.T) {
+	t.Setenv("COMPANY_NAME_NORMALIZE", "")
+	t.Setenv("COMPANY_NAME_TITLE_CASE", "true")
+	t.Setenv("COMPANY_NAME_SUFFIXES", "true")
+	if got := normalizeCompanyName("  ACME,  INC. "); got != "  ACME,  INC. " {
+		t.Errorf("normalizeCompanyName = %q, want the name unchanged", got)
+	}
+}
+
+func TestCreateCompanyUsesNormalizedName(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	t.Setenv("COMPANY_NAME_NORMALIZE", "true")
+	t.Setenv("COMPANY_NAME_TITLE_CASE", "true")
+	t.Setenv("COMPANY_NAME_SUFFIXES", "true")
+
+	if _, err := findOrCreateCompany(context.Background(), cfg, "ACME WIDGETS, INC.", "", 0); err != nil {
+		t.Fatalf("findOrCreateCompany: %v", err)
+	}
+	if name := stub.input("CreateCompany")["name"]; name != "Acme Widgets Inc" {
+		t.Errorf("company name = %v, want Acme Widgets Inc", name)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultMaxDecompressedBody caps compressed request bodies once expanded
+const defaultMaxDecompressedBody = 1 << 20
+
+// errBodyTooLarge is returned when a decompressed body exceeds the limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// errUnsupportedEncoding is returned for a Content-Encoding we can't decode
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// defaultMaxBody caps request bodies as sent, before any decompression
+const defaultMaxBody = 64 << 10
+
+// maxBodyBytes returns MAX_BODY_BYTES (default 64 KiB)
+func maxBodyBytes(cfg *Config) int64 {
+	if cfg.MaxBodyBytes > 0 {
+		return cfg.MaxBodyBytes
+	}
+	return defaultMaxBody
+}
+
+// maxDecompressedBody returns MAX_DECOMPRESSED_BODY_BYTES (default 1 MiB)
+func maxDecompressedBody(cfg *Config) int64 {
+	if cfg.MaxDecompressedBodyBytes > 0 {
+		return cfg.MaxDecompressedBodyBytes
+	}
+	return defaultMaxDecompressedBody
+}
+
+// readRequestBody reads body, transparently decompressing gzip and deflate
+// according to the Content-Encoding header. Decompressed output is limited
+// to maxDecompressedBody so a small compressed payload can't expand without
+// bound. Identity (or absent) encodings are read as-is.
+func readRequestBody(cfg *Config, body io.Reader, contentEncoding string) ([]byte, error) {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return io.ReadAll(body)
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		fl, err := newDeflateReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deflate body: %w", err)
+		}
+		defer fl.Close()
+		reader = fl
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnsupportedEncoding, contentEncoding)
+	}
+
+	limit := maxDecompressedBody(cfg)
+	raw, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress body: %w", err)
+	}
+	if int64(len(raw)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return raw, nil
+}
+
+// newDeflateReader decodes an HTTP "deflate" body. The encoding is defined
+// as the zlib format (RFC 1950), but some clients send raw DEFLATE, so the
+// zlib header is sniffed and anything else is read as raw DEFLATE.
+func newDeflateReader(body io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(body)
+	header, _ := br.Peek(2)
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
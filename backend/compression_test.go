@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(s string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	io.WriteString(w, s)
+	w.Close()
+	return b.Bytes()
+}
+
+func zlibBytes(s string) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	io.WriteString(w, s)
+	w.Close()
+	return b.Bytes()
+}
+
+func rawDeflateBytes(s string) []byte {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+	io.WriteString(w, s)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestReadRequestBody(t *testing.T) {
+	const body = `{"name":"Jane"}`
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+	}{
+		{"identity", "", []byte(body)},
+		{"explicit identity", "identity", []byte(body)},
+		{"gzip", "gzip", gzipBytes(body)},
+		{"x-gzip", "X-GZIP", gzipBytes(body)},
+		{"zlib deflate", "deflate", zlibBytes(body)},
+		{"raw deflate", "deflate", rawDeflateBytes(body)},
+	}
+	for _, tt := range tests {
+		raw, err := readRequestBody(&Config{}, bytes.NewReader(tt.data), tt.encoding)
+		if err != nil || string(raw) != body {
+			t.Errorf("%s: readRequestBody = %q, %v; want %q", tt.name, raw, err, body)
+		}
+	}
+}
+
+func TestReadRequestBodyErrors(t *testing.T) {
+	cfg := &Config{MaxDecompressedBodyBytes: 100}
+
+	if _, err := readRequestBody(cfg, bytes.NewReader(gzipBytes(strings.Repeat("a", 101))), "gzip"); !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("gzip bomb: err = %v, want errBodyTooLarge", err)
+	}
+	if raw, err := readRequestBody(cfg, bytes.NewReader(gzipBytes(strings.Repeat("a", 100))), "gzip"); err != nil || len(raw) != 100 {
+		t.Errorf("body at the limit: %d bytes, %v", len(raw), err)
+	}
+	if _, err := readRequestBody(cfg, strings.NewReader("not gzip"), "gzip"); err == nil {
+		t.Error("invalid gzip accepted")
+	}
+	if _, err := readRequestBody(cfg, strings.NewReader("{}"), "br"); !errors.Is(err, errUnsupportedEncoding) {
+		t.Errorf("br: err = %v, want errUnsupportedEncoding", err)
+	}
+}
+
+func TestHandleContactCompressedBodies(t *testing.T) {
+	useMemoryStore(t)
+	cfg := &Config{CRMMissingConfig: "unavailable", MaxBodyBytes: 1024, MaxDecompressedBodyBytes: 4096}
+
+	padded := `{"name":"Jane","email":"jane@example.com","message":"` + strings.Repeat("a", 5000) + `"}`
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+		want     int
+	}{
+		// Valid leads get as far as the 503 for the missing CRM
+		{"gzip", "gzip", gzipBytes(validContactBody), http.StatusServiceUnavailable},
+		{"zlib deflate", "deflate", zlibBytes(validContactBody), http.StatusServiceUnavailable},
+		{"raw deflate", "deflate", rawDeflateBytes(validContactBody), http.StatusServiceUnavailable},
+		{"oversized as sent", "", []byte(padded), http.StatusRequestEntityTooLarge},
+		{"oversized once decompressed", "gzip", gzipBytes(padded), http.StatusRequestEntityTooLarge},
+		{"corrupt gzip", "gzip", []byte("not gzip"), http.StatusBadRequest},
+		{"unsupported encoding", "br", []byte(validContactBody), http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/contact", bytes.NewReader(tt.data))
+		if tt.encoding != "" {
+			r.Header.Set("Content-Encoding", tt.encoding)
+		}
+		w := httptest.NewRecorder()
+		handleContact(cfg)(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
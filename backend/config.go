@@ -0,0 +1,567 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Config holds the settings the server depends on. It is loaded and
+// validated once at startup, so a misconfigured deployment fails at boot
+// instead of on its first lead, and is passed down to the handlers. Zero
+// values select the documented defaults. The rollout settings in
+// rolloutFlags stay out of it on purpose: feature flags can change those at
+// runtime. So do the ones only read once while booting (logging, tracing,
+// the store and Google Sheets).
+type Config struct {
+	Port          string
+	TwentyAPIURL  string
+	TwentyAPIKey  string
+	MailgunAPIKey string
+	MailgunDomain string
+
+	// TwentyAPIMode selects the CRM client: "graphql" (the default) or "rest"
+	TwentyAPIMode string
+
+	// TwentyRequestAttempts is how many times a single Twenty request is
+	// tried on transient failures (default 3)
+	TwentyRequestAttempts int
+
+	// RetryBackoff is the jitter strategy shared by retrying callers:
+	// "full" (the default), "equal" or "fixed"
+	RetryBackoff string
+
+	// ContactEmail receives notifications for unrouted services
+	ContactEmail string
+
+	// CRMMissingConfig is how leads are handled while Twenty isn't
+	// configured: "unavailable" answers 503, "degraded" emails the lead only
+	CRMMissingConfig string
+
+	// CompanyFailureMode "strict" fails a lead whose company couldn't be
+	// recorded instead of creating a company-less opportunity ("lenient")
+	CompanyFailureMode string
+
+	// OpportunityNameDisambiguate is "date" or "number" (see
+	// disambiguateOpportunityName), or empty to keep duplicate names
+	OpportunityNameDisambiguate string
+
+	// OpportunityWithoutContact is what happens when no person could be
+	// created: "skip" (the default) fails the lead, "embed" creates the
+	// opportunity anyway with the contact details in its note
+	OpportunityWithoutContact string
+
+	// NameMismatchMode handles a differing name on an existing person:
+	// "ignore" (the default), "update" the person, or "note" it on the
+	// opportunity
+	NameMismatchMode string
+
+	// OpportunityStage is the stage new opportunities start in (default
+	// NEW); OpportunityClosedStages are the ones that count as closed
+	// (default CUSTOMER)
+	OpportunityStage        string
+	OpportunityClosedStages []string
+
+	// OpportunityOwnerIDs are the workspace members new opportunities are
+	// assigned to in turn
+	OpportunityOwnerIDs []string
+
+	// OpportunityDescTemplate and OpportunityNameTemplate are text/templates
+	// over ContactRequest for the opportunity's description and name
+	OpportunityDescTemplate string
+	OpportunityNameTemplate string
+
+	// Workspace-specific fields, each only written when its name is set
+	// since Twenty rejects fields the workspace doesn't have
+	OpportunityDescriptionField string
+	GeoIPOpportunityField       string
+	TwentyReferralField         string
+	ReferrerChainField          string
+	PriorInquiriesField         string
+	PhoneCountryMismatchField   string
+	PersonAddressField          string
+	MailgunBouncePersonField    string
+
+	// EnvironmentTag marks the records a non-production deployment creates,
+	// in the EnvironmentTagField custom field when set
+	EnvironmentTag      string
+	EnvironmentTagField string
+
+	// NoteMaxLength caps note bodies in characters (default 5000)
+	NoteMaxLength int
+
+	// FollowUpTaskDueHours is how long after submission the follow-up task
+	// is due (default 24), assigned to FollowUpTaskAssigneeID when set
+	FollowUpTaskDueHours   int
+	FollowUpTaskAssigneeID string
+
+	// EmptyMessageMode "placeholder" stands EmptyMessagePlaceholder in for a
+	// blank message; the default, "omit", leaves the message out
+	EmptyMessageMode        string
+	EmptyMessagePlaceholder string
+
+	// DefaultCountry is the ISO country assumed for phone numbers without a
+	// country code (default US)
+	DefaultCountry string
+
+	// ReferralSources, when set, are the only referral sources accepted
+	ReferralSources []string
+
+	// ServiceAliases map services to canonical names ("web=Web Design").
+	// Services longer than ServiceMaxLength (default 80) are truncated, or
+	// rejected when ServiceOverlength is "reject".
+	ServiceAliases    []string
+	ServiceMaxLength  int
+	ServiceOverlength string
+
+	// FieldTransforms and FormProfiles are the parsed FIELD_TRANSFORMS and
+	// FORM_PROFILES
+	FieldTransforms map[string][]string
+	FormProfiles    map[string]FormProfile
+
+	// ContactPaths and ContactMethods serve the contact endpoint (default
+	// /api/contact and POST); AllowedOrigins limits CORS, allowing any
+	// origin when empty
+	ContactPaths   []string
+	ContactMethods []string
+	AllowedOrigins []string
+
+	// RateLimitPerMinute is the most contact requests accepted per minute
+	// from one client IP (default 5; zero disables the limit), unless the
+	// request's origin has its own entry in RateLimitOrigins
+	RateLimitPerMinute int64
+	RateLimitOrigins   map[string]int64
+
+	// MaxBodyBytes (default 64 KiB) and MaxDecompressedBodyBytes (default
+	// 1 MiB) cap request bodies as sent and once decompressed
+	MaxBodyBytes             int64
+	MaxDecompressedBodyBytes int64
+
+	// TrustedProxyHops is the number of proxies in front of the server that
+	// append to X-Forwarded-For; zero ignores the header
+	TrustedProxyHops int
+
+	// HoneypotField is the hidden form field bots fill in and people don't
+	HoneypotField string
+
+	// BotUserAgents are user agent substrings rejected as bots, answered
+	// with 403 when BotUAResponse is "forbidden" instead of a "silent" 200
+	BotUserAgents []string
+	BotUAResponse string
+
+	// WAFScoreHeader carries our CDN's threat score; requests scoring above
+	// WAFScoreThreshold are dropped
+	WAFScoreHeader    string
+	WAFScoreThreshold float64
+
+	// MessageHTML "keep" stores HTML messages as sent instead of "strip"ping
+	// them to plain text
+	MessageHTML string
+
+	// ConsentRequiredCountries are the ISO codes ("EU" for the member
+	// states) whose leads must confirm consent
+	ConsentRequiredCountries []string
+
+	// EmailDailyCap is the most submissions accepted from one email per day
+	// (zero disables the cap), counted per UTC day when EmailCapReset is
+	// "calendar" instead of "rolling"
+	EmailDailyCap int
+	EmailCapReset string
+
+	// EnrichmentURL looks up company details for new leads, authenticated
+	// with EnrichmentAPIKey and bounded by EnrichmentTimeout (default 3s)
+	EnrichmentURL     string
+	EnrichmentAPIKey  string
+	EnrichmentTimeout time.Duration
+
+	// IdempotencyMaxKeys is the most Idempotency-Keys kept at once (default
+	// 10000)
+	IdempotencyMaxKeys int
+
+	// NotifyChannels are where lead notifications go ("email", "teams");
+	// when empty, email plus Teams if TeamsWebhookURL is set
+	NotifyChannels  []string
+	TeamsWebhookURL string
+
+	// NotificationMode "digest" batches notification emails instead of
+	// sending them "immediate"ly; DigestMaxLeads buffered leads trigger an
+	// early send (zero only sends on the interval)
+	NotificationMode string
+	DigestMaxLeads   int
+
+	// EmailThrottleWindow suppresses repeat notifications for the same
+	// email and service (zero disables it)
+	EmailThrottleWindow time.Duration
+
+	// ReplyToFallback is the Reply-To for submitters whose email can't
+	// receive replies
+	ReplyToFallback string
+
+	// MailgunSandboxRecipient receives every email in MAILGUN_SANDBOX mode
+	MailgunSandboxRecipient string
+
+	// AutoresponderSubject and AutoresponderTemplate override the
+	// autoresponder's default text/templates
+	AutoresponderSubject  string
+	AutoresponderTemplate string
+
+	// SelfTestEmail receives the startup self-test email instead of
+	// ContactEmail
+	SelfTestEmail string
+
+	// SecondaryWebhookURL receives a copy of every lead, authenticated with
+	// SecondaryWebhookToken
+	SecondaryWebhookURL   string
+	SecondaryWebhookToken string
+
+	// LeadPipelineAttempts is how many times queued leads run the pipeline
+	// (default 1), LeadPipelineRetryDelay apart when set
+	LeadPipelineAttempts   int
+	LeadPipelineRetryDelay time.Duration
+
+	// LeadWorkerConcurrency queued jobs are processed at once (default 4),
+	// with up to LeadWorkerQueueSize waiting (default 100)
+	LeadWorkerConcurrency int
+	LeadWorkerQueueSize   int
+
+	// EmailHashSalt salts the email hash carried by analytics records
+	EmailHashSalt string
+
+	// LeadWorkerURL receives leads for out-of-process handling; requests
+	// to and from the worker are signed with LeadWorkerSecret
+	LeadWorkerURL    string
+	LeadWorkerSecret string
+
+	// PartnerFieldMap maps partner payload keys onto contact fields for the
+	// partner endpoint, which requires PartnerAPIKey when it is set
+	PartnerFieldMap map[string]string
+	PartnerAPIKey   string
+
+	// MailgunWebhookSigningKey verifies Mailgun's event webhooks
+	MailgunWebhookSigningKey string
+
+	// AdminAPIKey unlocks the admin routes
+	AdminAPIKey string
+
+	// ServiceRecipients maps services to notification addresses
+	// ("Branding=a@x.com"); UnroutedRecipient gets services with no mapping
+	ServiceRecipients []string
+	UnroutedRecipient string
+
+	// ContactEmailCC gets a copy of every notification
+	ContactEmailCC []string
+
+	// CRMMissingNotice replaces the "not yet in CRM" line in notifications
+	CRMMissingNotice string
+
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSMinVersion is "1.2" (the default) or "1.3"
+	TLSMinVersion string
+
+	// ReferrerPolicy overrides the default Referrer-Policy header;
+	// HSTSMaxAge (seconds) adds Strict-Transport-Security over TLS
+	ReferrerPolicy string
+	HSTSMaxAge     string
+
+	// FeatureFlagsURL serves the runtime overrides (see featureFlags); it
+	// must be https
+	FeatureFlagsURL string
+}
+
+// CRMConfigured reports whether the Twenty connection settings are present
+func (c *Config) CRMConfigured() bool {
+	return c.TwentyAPIURL != "" && c.TwentyAPIKey != ""
+}
+
+// loadConfig reads the settings from the environment and validates them.
+// The Mailgun key and domain are required. So are the Twenty URL and key,
+// unless CRM_MISSING_CONFIG ("unavailable" or "degraded") says how to run
+// without them; either way they must be set together. Every invalid
+// optional setting is reported, not just the first.
+func loadConfig() (*Config, error) {
+	env := &envSettings{}
+	cfg := &Config{
+		Port:                        os.Getenv("PORT"),
+		TwentyAPIURL:                os.Getenv("TWENTY_API_URL"),
+		TwentyAPIKey:                os.Getenv("TWENTY_API_KEY"),
+		MailgunAPIKey:               os.Getenv("MAILGUN_API_KEY"),
+		MailgunDomain:               os.Getenv("MAILGUN_DOMAIN"),
+		TwentyAPIMode:               env.choice("TWENTY_API_MODE", "graphql", "rest"),
+		TwentyRequestAttempts:       env.positive("TWENTY_REQUEST_ATTEMPTS"),
+		RetryBackoff:                env.choice("RETRY_BACKOFF", backoffFull, backoffEqual, backoffFixed),
+		ContactEmail:                os.Getenv("CONTACT_EMAIL"),
+		CRMMissingConfig:            env.choice("CRM_MISSING_CONFIG", "unavailable", "degraded"),
+		CompanyFailureMode:          env.choice("COMPANY_FAILURE_MODE", "lenient", "strict"),
+		OpportunityNameDisambiguate: env.choice("OPPORTUNITY_NAME_DISAMBIGUATE", "date", "number"),
+		OpportunityWithoutContact:   env.choice("OPPORTUNITY_WITHOUT_CONTACT", "skip", "embed"),
+		NameMismatchMode:            env.choice("NAME_MISMATCH_MODE", "ignore", "update", "note"),
+		OpportunityStage:            strings.TrimSpace(os.Getenv("OPPORTUNITY_STAGE")),
+		OpportunityClosedStages:     splitList(os.Getenv("OPPORTUNITY_CLOSED_STAGES")),
+		OpportunityOwnerIDs:         splitList(os.Getenv("OPPORTUNITY_OWNER_IDS")),
+		OpportunityDescTemplate:     env.template("OPPORTUNITY_DESC_TEMPLATE"),
+		OpportunityNameTemplate:     env.template("OPPORTUNITY_NAME_TEMPLATE"),
+		OpportunityDescriptionField: os.Getenv("OPPORTUNITY_DESCRIPTION_FIELD"),
+		GeoIPOpportunityField:       os.Getenv("GEOIP_OPPORTUNITY_FIELD"),
+		TwentyReferralField:         os.Getenv("TWENTY_REFERRAL_FIELD"),
+		ReferrerChainField:          os.Getenv("REFERRER_CHAIN_FIELD"),
+		PriorInquiriesField:         os.Getenv("PRIOR_INQUIRIES_FIELD"),
+		PhoneCountryMismatchField:   os.Getenv("PHONE_COUNTRY_MISMATCH_FIELD"),
+		PersonAddressField:          os.Getenv("PERSON_ADDRESS_FIELD"),
+		MailgunBouncePersonField:    os.Getenv("MAILGUN_BOUNCE_PERSON_FIELD"),
+		EnvironmentTag:              strings.TrimSpace(os.Getenv("ENVIRONMENT_TAG")),
+		EnvironmentTagField:         os.Getenv("ENVIRONMENT_TAG_FIELD"),
+		NoteMaxLength:               env.positive("NOTE_MAX_LENGTH"),
+		FollowUpTaskDueHours:        env.positive("FOLLOWUP_TASK_DUE_HOURS"),
+		FollowUpTaskAssigneeID:      os.Getenv("FOLLOWUP_TASK_ASSIGNEE_ID"),
+		EmptyMessageMode:            env.choice("EMPTY_MESSAGE_MODE", "omit", "placeholder"),
+		EmptyMessagePlaceholder:     os.Getenv("EMPTY_MESSAGE_PLACEHOLDER"),
+		ReferralSources:             splitList(os.Getenv("REFERRAL_SOURCES")),
+		ServiceAliases:              splitList(os.Getenv("SERVICE_ALIASES")),
+		ServiceMaxLength:            env.positive("SERVICE_MAX_LENGTH"),
+		ServiceOverlength:           env.choice("SERVICE_OVERLENGTH", "truncate", "reject"),
+		ContactPaths:                splitList(os.Getenv("CONTACT_PATH")),
+		AllowedOrigins:              splitList(os.Getenv("ALLOWED_ORIGINS")),
+		RateLimitPerMinute:          int64(env.nonNegative("RATE_LIMIT_PER_MINUTE")),
+		MaxBodyBytes:                int64(env.positive("MAX_BODY_BYTES")),
+		MaxDecompressedBodyBytes:    int64(env.positive("MAX_DECOMPRESSED_BODY_BYTES")),
+		TrustedProxyHops:            env.nonNegative("TRUSTED_PROXY_HOPS"),
+		HoneypotField:               strings.TrimSpace(os.Getenv("HONEYPOT_FIELD")),
+		BotUserAgents:               splitList(os.Getenv("BOT_USER_AGENTS")),
+		BotUAResponse:               env.choice("BOT_UA_RESPONSE", "silent", "forbidden"),
+		WAFScoreHeader:              os.Getenv("WAF_SCORE_HEADER"),
+		WAFScoreThreshold:           env.number("WAF_SCORE_THRESHOLD"),
+		MessageHTML:                 env.choice("MESSAGE_HTML", "strip", "keep"),
+		ConsentRequiredCountries:    splitList(os.Getenv("CONSENT_REQUIRED_COUNTRIES")),
+		EmailDailyCap:               env.nonNegative("EMAIL_DAILY_CAP"),
+		EmailCapReset:               env.choice("EMAIL_CAP_RESET", "rolling", "calendar"),
+		EnrichmentURL:               os.Getenv("ENRICHMENT_URL"),
+		EnrichmentAPIKey:            os.Getenv("ENRICHMENT_API_KEY"),
+		EnrichmentTimeout:           env.duration("ENRICHMENT_TIMEOUT"),
+		IdempotencyMaxKeys:          env.positive("IDEMPOTENCY_MAX_KEYS"),
+		TeamsWebhookURL:             os.Getenv("TEAMS_WEBHOOK_URL"),
+		NotificationMode:            env.choice("NOTIFICATION_MODE", "immediate", "digest"),
+		DigestMaxLeads:              env.nonNegative("DIGEST_MAX_LEADS"),
+		EmailThrottleWindow:         env.duration("EMAIL_THROTTLE_WINDOW"),
+		ReplyToFallback:             os.Getenv("REPLY_TO_FALLBACK"),
+		MailgunSandboxRecipient:     os.Getenv("MAILGUN_SANDBOX_RECIPIENT"),
+		AutoresponderSubject:        env.template("AUTORESPONDER_SUBJECT"),
+		AutoresponderTemplate:       env.template("AUTORESPONDER_TEMPLATE"),
+		SelfTestEmail:               os.Getenv("SELFTEST_EMAIL"),
+		SecondaryWebhookURL:         os.Getenv("SECONDARY_WEBHOOK_URL"),
+		SecondaryWebhookToken:       os.Getenv("SECONDARY_WEBHOOK_TOKEN"),
+		LeadPipelineAttempts:        env.positive("LEAD_PIPELINE_ATTEMPTS"),
+		LeadPipelineRetryDelay:      env.duration("LEAD_PIPELINE_RETRY_DELAY"),
+		LeadWorkerConcurrency:       env.positive("LEAD_WORKER_CONCURRENCY"),
+		LeadWorkerQueueSize:         env.positive("LEAD_WORKER_QUEUE_SIZE"),
+		ServiceRecipients:           splitList(os.Getenv("SERVICE_RECIPIENTS")),
+		UnroutedRecipient:           os.Getenv("UNROUTED_RECIPIENT"),
+		ContactEmailCC:              splitList(os.Getenv("CONTACT_EMAIL_CC")),
+		CRMMissingNotice:            os.Getenv("CRM_MISSING_NOTICE"),
+		EmailHashSalt:               os.Getenv("EMAIL_HASH_SALT"),
+		LeadWorkerURL:               os.Getenv("LEAD_WORKER_URL"),
+		LeadWorkerSecret:            os.Getenv("LEAD_WORKER_SECRET"),
+		PartnerAPIKey:               os.Getenv("PARTNER_API_KEY"),
+		MailgunWebhookSigningKey:    os.Getenv("MAILGUN_WEBHOOK_SIGNING_KEY"),
+		AdminAPIKey:                 os.Getenv("ADMIN_API_KEY"),
+		TLSCertFile:                 os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:                  os.Getenv("TLS_KEY_FILE"),
+		TLSMinVersion:               strings.TrimSpace(os.Getenv("TLS_MIN_VERSION")),
+		ReferrerPolicy:              os.Getenv("REFERRER_POLICY"),
+		HSTSMaxAge:                  strings.TrimSpace(os.Getenv("HSTS_MAX_AGE")),
+		FeatureFlagsURL:             os.Getenv("FEATURE_FLAGS_URL"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+	if cfg.ContactEmail == "" {
+		cfg.ContactEmail = "john@sogos.io"
+	}
+	if strings.TrimSpace(os.Getenv("RATE_LIMIT_PER_MINUTE")) == "" {
+		cfg.RateLimitPerMinute = 5
+	}
+
+	for _, method := range splitList(os.Getenv("CONTACT_METHODS")) {
+		cfg.ContactMethods = append(cfg.ContactMethods, strings.ToUpper(method))
+	}
+	for _, channel := range splitList(os.Getenv("NOTIFY_CHANNELS")) {
+		channel = strings.ToLower(channel)
+		if channel != "email" && channel != "teams" {
+			env.fail(fmt.Errorf("invalid NOTIFY_CHANNELS entry %q (want email or teams)", channel))
+		}
+		cfg.NotifyChannels = append(cfg.NotifyChannels, channel)
+	}
+
+	var err error
+	if cfg.DefaultCountry, err = parseDefaultCountry(os.Getenv("DEFAULT_COUNTRY")); err != nil {
+		env.fail(err)
+	}
+	if cfg.FieldTransforms, err = parseFieldTransforms(os.Getenv("FIELD_TRANSFORMS")); err != nil {
+		env.fail(fmt.Errorf("invalid FIELD_TRANSFORMS: %w", err))
+	}
+	if cfg.FormProfiles, err = parseFormProfiles(os.Getenv("FORM_PROFILES")); err != nil {
+		env.fail(fmt.Errorf("invalid FORM_PROFILES: %w", err))
+	}
+	if cfg.PartnerFieldMap, err = parsePartnerFieldMap(os.Getenv("PARTNER_FIELD_MAP")); err != nil {
+		env.fail(fmt.Errorf("invalid PARTNER_FIELD_MAP: %w", err))
+	}
+	if cfg.RateLimitOrigins, err = parseOriginRateLimits(os.Getenv("RATE_LIMIT_ORIGINS")); err != nil {
+		env.fail(fmt.Errorf("invalid RATE_LIMIT_ORIGINS: %w", err))
+	}
+	if err := validateHoneypotField(cfg.HoneypotField); err != nil {
+		env.fail(err)
+	}
+	if cfg.WAFScoreHeader != "" && os.Getenv("WAF_SCORE_THRESHOLD") == "" {
+		env.fail(errors.New("WAF_SCORE_HEADER is set but WAF_SCORE_THRESHOLD is not"))
+	}
+	if cfg.TLSMinVersion != "" {
+		if _, ok := tlsVersions[cfg.TLSMinVersion]; !ok {
+			env.fail(fmt.Errorf("unsupported TLS_MIN_VERSION %q", cfg.TLSMinVersion))
+		}
+	}
+	if cfg.HSTSMaxAge != "" {
+		if n, err := strconv.Atoi(cfg.HSTSMaxAge); err != nil || n < 0 {
+			env.fail(fmt.Errorf("invalid HSTS_MAX_AGE %q (want seconds)", cfg.HSTSMaxAge))
+		}
+	}
+	if err := errors.Join(env.errs...); err != nil {
+		return nil, err
+	}
+
+	required := []struct{ name, value string }{
+		{"MAILGUN_API_KEY", cfg.MailgunAPIKey},
+		{"MAILGUN_DOMAIN", cfg.MailgunDomain},
+	}
+	// Running without Twenty is opt-in, and never with half of it
+	if cfg.CRMMissingConfig == "" || cfg.TwentyAPIURL != "" || cfg.TwentyAPIKey != "" {
+		required = append(required,
+			struct{ name, value string }{"TWENTY_API_URL", cfg.TwentyAPIURL},
+			struct{ name, value string }{"TWENTY_API_KEY", cfg.TwentyAPIKey},
+		)
+	}
+
+	var missing []string
+	for _, setting := range required {
+		if setting.value == "" {
+			missing = append(missing, setting.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	// Fail fast rather than send the API key in cleartext
+	if cfg.TwentyAPIURL != "" {
+		if err := validateCRMURL(cfg.TwentyAPIURL); err != nil {
+			return nil, fmt.Errorf("invalid TWENTY_API_URL: %w", err)
+		}
+	}
+
+	if cfg.FeatureFlagsURL != "" {
+		if err := validateFeatureFlagsURL(cfg.FeatureFlagsURL); err != nil {
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS_URL: %w", err)
+		}
+	}
+
+	if !isValidEmail(cfg.ContactEmail) {
+		return nil, fmt.Errorf("invalid CONTACT_EMAIL %q", cfg.ContactEmail)
+	}
+
+	return cfg, nil
+}
+
+// envSettings reads the optional settings for loadConfig. Unset settings
+// read as zero; invalid ones also read as zero and are recorded in errs.
+type envSettings struct {
+	errs []error
+}
+
+// fail records an invalid setting
+func (e *envSettings) fail(err error) {
+	e.errs = append(e.errs, err)
+}
+
+// choice returns the lowercased value of key, which must be one of values
+func (e *envSettings) choice(key string, values ...string) string {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	if v == "" || slices.Contains(values, v) {
+		return v
+	}
+	want := strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+	e.fail(fmt.Errorf("invalid %s %q (want %s)", key, v, want))
+	return ""
+}
+
+// positive returns the value of key, which must be a positive integer
+func (e *envSettings) positive(key string) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		e.fail(fmt.Errorf("invalid %s %q (want a positive integer)", key, v))
+		return 0
+	}
+	return n
+}
+
+// nonNegative returns the value of key, which must be an integer of at
+// least zero
+func (e *envSettings) nonNegative(key string) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		e.fail(fmt.Errorf("invalid %s %q (want a non-negative integer)", key, v))
+		return 0
+	}
+	return n
+}
+
+// number returns the value of key, which must be a number
+func (e *envSettings) number(key string) float64 {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail(fmt.Errorf("invalid %s %q (want a number)", key, v))
+		return 0
+	}
+	return f
+}
+
+// duration returns the value of key, which must be a duration of at least
+// zero such as "90s"
+func (e *envSettings) duration(key string) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		e.fail(fmt.Errorf("invalid %s %q (want a duration such as 30s)", key, v))
+		return 0
+	}
+	return d
+}
+
+// template returns the value of key, which must parse as a text/template
+func (e *envSettings) template(key string) string {
+	v := os.Getenv(key)
+	if _, err := template.New(key).Parse(v); err != nil {
+		e.fail(fmt.Errorf("invalid %s: %w", key, err))
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequiredConfig sets the environment loadConfig requires
+func setRequiredConfig(t *testing.T) {
+	t.Helper()
+	t.Setenv("MAILGUN_API_KEY", "key")
+	t.Setenv("MAILGUN_DOMAIN", "mg.example.com")
+	t.Setenv("TWENTY_API_URL", "https://crm.example.com")
+	t.Setenv("TWENTY_API_KEY", "key")
+	t.Setenv("CONTACT_EMAIL", "")
+	t.Setenv("CRM_MISSING_CONFIG", "")
+	t.Setenv("ALLOW_INSECURE_CRM", "")
+	t.Setenv("FEATURE_FLAGS_URL", "")
+}
+
+func TestLoadConfigRejectsHTTPCRM(t *testing.T) {
+	setRequiredConfig(t)
+	t.Setenv("TWENTY_API_URL", "http://crm.example.com")
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig accepted an http TWENTY_API_URL")
+	}
+
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	if _, err := loadConfig(); err != nil {
+		t.Errorf("loadConfig with ALLOW_INSECURE_CRM: %v", err)
+	}
+}
+
+func TestLoadConfigRejectsHTTPFeatureFlags(t *testing.T) {
+	setRequiredConfig(t)
+	t.Setenv("FEATURE_FLAGS_URL", "http://flags.example.com/sogos.json")
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig accepted an http FEATURE_FLAGS_URL")
+	}
+
+	t.Setenv("FEATURE_FLAGS_URL", "https://flags.example.com/sogos.json")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig with an https FEATURE_FLAGS_URL: %v", err)
+	}
+	if cfg.FeatureFlagsURL != "https://flags.example.com/sogos.json" {
+		t.Errorf("FeatureFlagsURL = %q", cfg.FeatureFlagsURL)
+	}
+}
+
+func TestLoadConfigCRMMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		url     string
+		key     string
+		wantErr bool
+	}{
+		{"configured", "", "https://crm.example.com", "key", false},
+		{"required by default", "", "", "", true},
+		{"unavailable mode", "unavailable", "", "", false},
+		{"degraded mode", "Degraded", "", "", false},
+		{"half configured", "degraded", "https://crm.example.com", "", true},
+		{"unknown mode", "ignore", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredConfig(t)
+			t.Setenv("CRM_MISSING_CONFIG", tt.mode)
+			t.Setenv("TWENTY_API_URL", tt.url)
+			t.Setenv("TWENTY_API_KEY", tt.key)
+
+			cfg, err := loadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.CRMConfigured() != (tt.url != "") {
+				t.Errorf("CRMConfigured() = %v", cfg.CRMConfigured())
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	setRequiredConfig(t)
+	t.Setenv("PORT", "")
+	t.Setenv("SERVICE_RECIPIENTS", "Branding=a@sogos.io, Web=b@sogos.io")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Port != "8080" || cfg.ContactEmail != "john@sogos.io" || len(cfg.ServiceRecipients) != 2 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+
+	t.Setenv("MAILGUN_API_KEY", "")
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig succeeded without MAILGUN_API_KEY")
+	}
+}
+
+func TestLoadConfigRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"COMPANY_FAILURE_MODE", "bogus"},
+		{"OPPORTUNITY_NAME_DISAMBIGUATE", "bogus"},
+		{"RETRY_BACKOFF", "bogus"},
+		{"TWENTY_REQUEST_ATTEMPTS", "abc"},
+		{"TWENTY_REQUEST_ATTEMPTS", "0"},
+		{"TRUSTED_PROXY_HOPS", "-1"},
+		{"ENRICHMENT_TIMEOUT", "soon"},
+		{"WAF_SCORE_THRESHOLD", "high"},
+		{"NOTIFY_CHANNELS", "email,sms"},
+		{"DEFAULT_COUNTRY", "ZZ"},
+		{"TLS_MIN_VERSION", "1.0"},
+		{"HSTS_MAX_AGE", "1y"},
+		{"OPPORTUNITY_NAME_TEMPLATE", "{{.Name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			setRequiredConfig(t)
+			t.Setenv(tt.key, tt.value)
+			if _, err := loadConfig(); err == nil {
+				t.Errorf("loadConfig accepted %s=%q", tt.key, tt.value)
+			}
+		})
+	}
+
+	setRequiredConfig(t)
+	t.Setenv("WAF_SCORE_HEADER", "X-Threat-Score")
+	t.Setenv("WAF_SCORE_THRESHOLD", "")
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig accepted WAF_SCORE_HEADER without WAF_SCORE_THRESHOLD")
+	}
+}
+
+func TestLoadConfigParsesSettings(t *testing.T) {
+	setRequiredConfig(t)
+	t.Setenv("COMPANY_FAILURE_MODE", " Strict ")
+	t.Setenv("TWENTY_REQUEST_ATTEMPTS", "2")
+	t.Setenv("ENRICHMENT_TIMEOUT", "5s")
+	t.Setenv("CONTACT_METHODS", "post,put")
+	t.Setenv("DEFAULT_COUNTRY", "gb")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.CompanyFailureMode != "strict" || cfg.TwentyRequestAttempts != 2 || cfg.EnrichmentTimeout != 5*time.Second {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if strings.Join(cfg.ContactMethods, ",") != "POST,PUT" || cfg.DefaultCountry != "GB" {
+		t.Errorf("ContactMethods = %v, DefaultCountry = %q", cfg.ContactMethods, cfg.DefaultCountry)
+	}
+}
+
+func TestLoadConfigRateLimits(t *testing.T) {
+	setRequiredConfig(t)
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "")
+	t.Setenv("RATE_LIMIT_ORIGINS", "https://Partner.example/=2")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.RateLimitPerMinute != 5 || cfg.RateLimitOrigins["https://partner.example"] != 2 {
+		t.Errorf("RateLimitPerMinute = %d, RateLimitOrigins = %v", cfg.RateLimitPerMinute, cfg.RateLimitOrigins)
+	}
+
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "0")
+	if cfg, err := loadConfig(); err != nil || cfg.RateLimitPerMinute != 0 {
+		t.Errorf("RATE_LIMIT_PER_MINUTE=0: loadConfig = %v, %v; want the limit disabled", cfg, err)
+	}
+
+	for _, v := range []string{"https://partner.example=lots", "https://partner.example"} {
+		t.Setenv("RATE_LIMIT_ORIGINS", v)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("loadConfig accepted RATE_LIMIT_ORIGINS=%q", v)
+		}
+	}
+}
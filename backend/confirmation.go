@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// confirmationAlphabet omits look-alike characters (0/O, 1/I/L) so numbers
+// can be read out over the phone
+const confirmationAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// confirmationLength is the number of random characters after the prefix
+const confirmationLength = 8
+
+// confirmationPrefix marks confirmation numbers in support conversations
+const confirmationPrefix = "SG-"
+
+// confirmationNumbersEnabled reports whether CONFIRMATION_NUMBERS is set, in
+// which case submissions are stored under a confirmation number returned to
+// the submitter
+func confirmationNumbersEnabled() bool {
+	return envBool("CONFIRMATION_NUMBERS")
+}
+
+// newConfirmationNumber returns a random number like "SG-7K3M9QXA"
+func newConfirmationNumber() string {
+	b := make([]byte, confirmationLength)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	for i := range b {
+		b[i] = confirmationAlphabet[int(b[i])%len(confirmationAlphabet)]
+	}
+	return confirmationPrefix + string(b)
+}
+
+// normalizeConfirmationNumber uppercases a submitted number and restores a
+// missing prefix, returning "" when it can't be a confirmation number
+func normalizeConfirmationNumber(ref string) string {
+	ref = strings.ToUpper(strings.TrimSpace(ref))
+	if !strings.HasPrefix(ref, confirmationPrefix) {
+		ref = confirmationPrefix + ref
+	}
+
+	code := strings.TrimPrefix(ref, confirmationPrefix)
+	if len(code) != confirmationLength {
+		return ""
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(confirmationAlphabet, c) {
+			return ""
+		}
+	}
+	return ref
+}
+
+// handleSubmissionLookup reports the status of the submission with
+// confirmation number ?ref=. Only the status and time are returned, never
+// the submitted details, since callers are anonymous.
+func handleSubmissionLookup(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setAllowOrigin(cfg, w, r)
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ref := normalizeConfirmationNumber(r.URL.Query().Get("ref"))
+		if ref == "" {
+			http.Error(w, "Invalid confirmation number", http.StatusBadRequest)
+			return
+		}
+
+		sub, err := store.GetSubmission(ref)
+		if err != nil {
+			log.Printf("Failed to look up submission %s: %v", ref, err)
+			http.Error(w, "Failed to look up submission", http.StatusInternalServerError)
+			return
+		}
+		if sub == nil {
+			http.Error(w, "Submission not found", http.StatusNotFound)
+			return
+		}
+
+		// A failed pipeline is followed up by hand, so the submitter only needs
+		// to know the message arrived
+		status := sub.Status
+		if status == submissionFailed {
+			status = submissionReceived
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"reference":  sub.ID,
+			"status":     status,
+			"receivedAt": sub.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+}
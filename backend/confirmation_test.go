@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewConfirmationNumber(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		n := newConfirmationNumber()
+		if len(n) != len(confirmationPrefix)+confirmationLength || normalizeConfirmationNumber(n) != n {
+			t.Fatalf("newConfirmationNumber() = %q, not a valid number", n)
+		}
+		if seen[n] {
+			t.Fatalf("newConfirmationNumber() repeated %q", n)
+		}
+		seen[n] = true
+	}
+}
+
+func TestNormalizeConfirmationNumber(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"SG-7K3M9QXA", "SG-7K3M9QXA"},
+		{" sg-7k3m9qxa ", "SG-7K3M9QXA"},
+		{"7K3M9QXA", "SG-7K3M9QXA"},
+		{"", ""},
+		{"SG-7K3M9QX", ""},
+		{"SG-7K3M9QXAB", ""},
+		{"SG-7K3M9QX0", ""},
+		{"SG-7K3M9QX!", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeConfirmationNumber(tt.ref); got != tt.want {
+			t.Errorf("normalizeConfirmationNumber(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func lookupSubmission(ref string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handleSubmissionLookup(&Config{})(w, httptest.NewRequest("GET", "/api/contact/lookup?ref="+ref, nil))
+	return w
+}
+
+func TestHandleSubmissionLookup(t *testing.T) {
+	_, clock := useMemoryStore(t)
+	store.SaveSubmission(&Submission{ID: "SG-7K3M9QXA", Status: submissionProcessed, Request: ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Message: "secret"}})
+	store.SaveSubmission(&Submission{ID: "SG-22222222", Status: submissionFailed})
+
+	w := lookupSubmission("sg-7k3m9qxa")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "jane") || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("lookup exposes submission details: %s", w.Body.String())
+	}
+	var got map[string]string
+	json.Unmarshal(w.Body.Bytes(), &got)
+	want := map[string]string{"reference": "SG-7K3M9QXA", "status": submissionProcessed, "receivedAt": clock.Now().Format(time.RFC3339)}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+
+	// Failures are followed up by hand, so they read as received
+	json.Unmarshal(lookupSubmission("SG-22222222").Body.Bytes(), &got)
+	if got["status"] != submissionReceived {
+		t.Errorf("failed submission status = %q, want %q", got["status"], submissionReceived)
+	}
+
+	if w := lookupSubmission("SG-33333333"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown number: status = %d, want 404", w.Code)
+	}
+	if w := lookupSubmission("nope"); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed number: status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandleContactReturnsConfirmationNumber(t *testing.T) {
+	useMemoryStore(t)
+	_, cfg := useTwentyStub(t)
+	t.Setenv("CONFIRMATION_NUMBERS", "true")
+	cfg.NotifyChannels = []string{"teams"}
+
+	w := postContact(cfg, validContactBody)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	resp := responseOf(t, w)
+	if normalizeConfirmationNumber(resp.Reference) != resp.Reference || resp.Reference == "" {
+		t.Fatalf("reference = %q, want a confirmation number", resp.Reference)
+	}
+	if sub, _ := store.GetSubmission(resp.Reference); sub == nil || sub.Request.Email != "jane@example.com" {
+		t.Errorf("submission stored under %s = %+v", resp.Reference, sub)
+	}
+
+	var got map[string]string
+	json.Unmarshal(lookupSubmission(resp.Reference).Body.Bytes(), &got)
+	if got["status"] != submissionProcessed {
+		t.Errorf("lookup status = %q, want %q", got["status"], submissionProcessed)
+	}
+}
+
+func TestHandleContactWithoutConfirmationNumbers(t *testing.T) {
+	useMemoryStore(t)
+	_, cfg := useTwentyStub(t)
+	t.Setenv("CONFIRMATION_NUMBERS", "")
+	cfg.NotifyChannels = []string{"teams"}
+
+	if resp := responseOf(t, postContact(cfg, validContactBody)); resp.Reference != "" {
+		t.Errorf("reference = %q with confirmation numbers disabled", resp.Reference)
+	}
+}
+
+func TestAutoresponderIncludesConfirmationNumber(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}
+
+	_, body, err := renderAutoresponder(&Config{}, req, "SG-7K3M9QXA")
+	if err != nil {
+		t.Fatalf("renderAutoresponder: %v", err)
+	}
+	if !strings.Contains(body, "Hi Jane,") || !strings.Contains(body, "Your confirmation number is SG-7K3M9QXA.") {
+		t.Errorf("body = %q", body)
+	}
+	if _, body, _ := renderAutoresponder(&Config{}, req, ""); strings.Contains(body, "confirmation number") {
+		t.Errorf("body mentions a confirmation number without one: %q", body)
+	}
+}
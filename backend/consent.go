@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+)
+
+// euCountries are the EU member states, selected with "EU" in
+// CONSENT_REQUIRED_COUNTRIES
+var euCountries = []string{
+	"AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR", "HU", "IE",
+	"IT", "LV", "LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK", "SI", "ES", "SE",
+}
+
+// consentRequiredCountries returns the ISO codes from
+// CONSENT_REQUIRED_COUNTRIES (comma-separated; "EU" expands to the member
+// states)
+func consentRequiredCountries(cfg *Config) map[string]bool {
+	countries := make(map[string]bool)
+	for _, code := range cfg.ConsentRequiredCountries {
+		code = strings.ToUpper(code)
+		if code == "EU" {
+			for _, eu := range euCountries {
+				countries[eu] = true
+			}
+			continue
+		}
+		countries[code] = true
+	}
+	return countries
+}
+
+// consentRequired reports whether the submitter is in a country that needs
+// explicit consent, judged by both the submitted country and the GeoIP
+// location, so either one being in scope is enough
+func consentRequired(cfg *Config, req ContactRequest) bool {
+	countries := consentRequiredCountries(cfg)
+	if len(countries) == 0 {
+		return false
+	}
+	if req.Country != "" && countries[req.Country] {
+		return true
+	}
+	return req.Location != nil && countries[req.Location.Country]
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConsentRequired(t *testing.T) {
+	tests := []struct {
+		name      string
+		countries []string
+		req       ContactRequest
+		want      bool
+	}{
+		{"not configured", nil, ContactRequest{Country: "DE"}, false},
+		{"EU country submitted", []string{"EU"}, ContactRequest{Country: "DE"}, true},
+		{"EU visitor by GeoIP", []string{"EU"}, ContactRequest{Location: &GeoLocation{Country: "FR"}}, true},
+		{"EU GeoIP outweighs a non-EU country", []string{"EU"}, ContactRequest{Country: "US", Location: &GeoLocation{Country: "FR"}}, true},
+		{"non-EU visitor", []string{"EU"}, ContactRequest{Country: "US", Location: &GeoLocation{Country: "US"}}, false},
+		{"unknown location", []string{"EU"}, ContactRequest{}, false},
+		{"extra countries", []string{"eu", "gb"}, ContactRequest{Location: &GeoLocation{Country: "GB"}}, true},
+		{"explicit list without EU", []string{"GB"}, ContactRequest{Country: "DE"}, false},
+	}
+	for _, tt := range tests {
+		cfg := &Config{ConsentRequiredCountries: tt.countries}
+		if got := consentRequired(cfg, tt.req); got != tt.want {
+			t.Errorf("%s: consentRequired = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleContactConsent(t *testing.T) {
+	useMemoryStore(t)
+	useGeoLocator(t, stubLocator{"192.0.2.1": {Country: "DE"}})
+	cfg := &Config{CRMMissingConfig: "unavailable", ConsentRequiredCountries: []string{"EU"}}
+
+	// EU visitor without consent is rejected before anything is processed
+	w := postContact(cfg, validContactBody)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("EU visitor without consent: status = %d, want 400", w.Code)
+	}
+	if resp := responseOf(t, w); resp.Code != codeValidationError {
+		t.Errorf("code = %q, want %q", resp.Code, codeValidationError)
+	}
+
+	// With consent the lead gets as far as the missing CRM
+	withConsent := `{"name":"Jane Doe","email":"jane@example.com","message":"Hello","consent":true}`
+	if w := postContact(cfg, withConsent); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("EU visitor with consent: status = %d, want 503", w.Code)
+	}
+
+	// Non-EU visitors don't need to consent
+	useGeoLocator(t, stubLocator{"192.0.2.1": {Country: "US"}})
+	if w := postContact(cfg, validContactBody); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("non-EU visitor without consent: status = %d, want 503", w.Code)
+	}
+
+	// An explicit EU country needs consent wherever the request comes from
+	if w := postContact(cfg, `{"name":"Jane Doe","email":"jane@example.com","country":"fr"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("EU country without consent: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// restStub is a fake Twenty REST API. It records each request and answers
+// creates with a generated ID, updates with no data, and finds with the
+// responses queued by on or else no records.
+type restStub struct {
+	mu        sync.Mutex
+	requests  []string
+	bodies    map[string]map[string]interface{}
+	filters   []string
+	responses map[string][]string
+}
+
+func newRestStub(t *testing.T) (*restStub, *httptest.Server) {
+	t.Helper()
+	stub := &restStub{bodies: map[string]map[string]interface{}{}, responses: map[string][]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		request := r.Method + " " + r.URL.Path
+		stub.requests = append(stub.requests, request)
+
+		object := strings.TrimPrefix(r.URL.Path, "/rest/")
+		if r.Method == "GET" {
+			stub.filters = append(stub.filters, r.URL.Query().Get("filter"))
+			if queued := stub.responses[request]; len(queued) > 0 {
+				stub.responses[request] = queued[1:]
+				w.Write([]byte(queued[0]))
+				return
+			}
+			w.Write([]byte(`{"data":{"` + object + `":[]},"totalCount":0}`))
+			return
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		stub.bodies[object] = body
+
+		if r.Method == "PATCH" {
+			w.Write([]byte(`{"data":{}}`))
+			return
+		}
+
+		key := map[string]string{
+			"companies":     "createCompany",
+			"people":        "createPerson",
+			"opportunities": "createOpportunity",
+			"notes":         "createNote",
+			"noteTargets":   "createNoteTarget",
+			"leads":         "createLead",
+			"tasks":         "createTask",
+			"taskTargets":   "createTaskTarget",
+		}[object]
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":{"` + key + `":{"id":"` + object + `-1"}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return stub, srv
+}
+
+// on queues responses for GET requests to path, e.g. "/rest/people"
+func (s *restStub) on(path string, responses ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses["GET "+path] = append(s.responses["GET "+path], responses...)
+}
+
+func TestRestCreateOpportunityNote(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	stub, srv := newRestStub(t)
+
+	crm := &restCRM{cfg: &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key"}}
+	id, err := crm.CreateOpportunity(context.Background(), "Acme - Branding", "Hello there", "NEW", "person-1", "company-1", "", nil)
+	if err != nil {
+		t.Fatalf("CreateOpportunity: %v", err)
+	}
+	if id != "opportunities-1" {
+		t.Errorf("id = %q, want opportunities-1", id)
+	}
+
+	want := []string{"POST /rest/opportunities", "POST /rest/notes", "POST /rest/noteTargets"}
+	if strings.Join(stub.requests, ", ") != strings.Join(want, ", ") {
+		t.Errorf("requests = %v, want %v", stub.requests, want)
+	}
+
+	target := stub.bodies["noteTargets"]
+	if target["noteId"] != "notes-1" || target["opportunityId"] != "opportunities-1" {
+		t.Errorf("note target = %v, want the note linked to the opportunity", target)
+	}
+	if note := stub.bodies["notes"]; note["title"] != "Project Details" {
+		t.Errorf("note title = %v, want Project Details", note["title"])
+	}
+}
+
+func TestRestFindPersonByEmailExact(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	stub, srv := newRestStub(t)
+
+	crm := &restCRM{cfg: &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key"}}
+	if _, err := crm.findPersonByEmail(context.Background(), "jane_doe@example.com"); err != nil {
+		t.Fatalf("findPersonByEmail: %v", err)
+	}
+
+	want := `emails.primaryEmail[eq]:"jane_doe@example.com"`
+	if len(stub.filters) != 1 || stub.filters[0] != want {
+		t.Errorf("filters = %v, want [%s]", stub.filters, want)
+	}
+}
+
+func TestNewCRMClientMode(t *testing.T) {
+	cfg := &Config{TwentyAPIURL: "https://crm.example.com", TwentyAPIKey: "key", TwentyAPIMode: "rest"}
+	if _, ok := newCRMClient(cfg).(*restCRM); !ok {
+		t.Error("TWENTY_API_MODE=rest should select the REST client")
+	}
+
+	cfg.TwentyAPIMode = ""
+	if _, ok := newCRMClient(cfg).(*graphQLCRM); !ok {
+		t.Error("the GraphQL client should be the default")
+	}
+}
+
+// graphQLRequests returns the requests that went anywhere but the REST API
+func (s *restStub) graphQLRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var other []string
+	for _, request := range s.requests {
+		if _, path, _ := strings.Cut(request, " "); !strings.HasPrefix(path, "/rest/") {
+			other = append(other, request)
+		}
+	}
+	return other
+}
+
+func TestCreateTwentyLeadRestOnly(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	t.Setenv("PERSON_PHONE_MATCH", "true")
+	t.Setenv("INCLUDE_PRIOR_INQUIRIES", "true")
+	t.Setenv("OPPORTUNITY_REUSE_WINDOW", "24h")
+	t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+	t.Setenv("COMPANY_OPPORTUNITY_WINDOW", "24h")
+	t.Setenv("CREATE_FOLLOWUP_TASK", "true")
+	stub, srv := newRestStub(t)
+	stub.on("/rest/people", `{"data":{"people":[{"id":"person-1"}]}}`)
+	stub.on("/rest/people/person-1", `{"data":{"person":{"name":{"firstName":"Janet","lastName":"Doe"}}}}`)
+	stub.on("/rest/opportunities", `{"data":{"opportunities":[]},"totalCount":2}`)
+
+	cfg := &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyAPIMode: "rest", NameMismatchMode: "note", OpportunityNameDisambiguate: "number"}
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Phone: "+1 555 123 4567", Company: "Acme", Service: "Branding"}
+	lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+	if err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+
+	if other := stub.graphQLRequests(); len(other) > 0 {
+		t.Errorf("REST mode sent %v outside the REST API", other)
+	}
+	if lead.PriorInquiries != 2 || lead.AlternateName != "Jane Doe" || lead.TaskID != "tasks-1" {
+		t.Errorf("lead = %+v, want prior inquiries, the alternate name and a task", lead)
+	}
+	for _, want := range []string{"GET /rest/people/person-1", "POST /rest/opportunities", "POST /rest/tasks", "POST /rest/taskTargets"} {
+		if !slices.Contains(stub.requests, want) {
+			t.Errorf("requests = %v, missing %s", stub.requests, want)
+		}
+	}
+	sameNamed := `and(or(name[eq]:"Jane Doe - Branding",name[like]:"Jane Doe - Branding #%"),or(pointOfContactId[eq]:"person-1",companyId[eq]:"companies-1"))`
+	if !slices.Contains(stub.filters, sameNamed) {
+		t.Errorf("filters = %v, missing the same-named count %s", stub.filters, sameNamed)
+	}
+}
+
+func TestCreateTwentyLeadRestReopens(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+	stub, srv := newRestStub(t)
+	stub.on("/rest/people", `{"data":{"people":[{"id":"person-1"}]}}`)
+	stub.on("/rest/opportunities", `{"data":{"opportunities":[{"id":"opportunity-9","stage":"CUSTOMER"}]}}`)
+
+	cfg := &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyAPIMode: "rest"}
+	lead, err := createTwentyLead(context.Background(), cfg, ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}, nil)
+	if err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+
+	if lead.OpportunityID != "opportunity-9" || !lead.ReopenedOpportunity {
+		t.Errorf("lead = %+v, want opportunity-9 reopened", lead)
+	}
+	if stage := stub.bodies["opportunities/opportunity-9"]["stage"]; stage != "NEW" {
+		t.Errorf("reopened stage = %v, want NEW", stage)
+	}
+	if note := stub.bodies["notes"]; note["title"] != "Reopened: New Inquiry" {
+		t.Errorf("note title = %v, want Reopened: New Inquiry", note["title"])
+	}
+	if other := stub.graphQLRequests(); len(other) > 0 {
+		t.Errorf("REST mode sent %v outside the REST API", other)
+	}
+}
+
+func TestRestCreateLead(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	stub, srv := newRestStub(t)
+
+	crm := &restCRM{cfg: &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key"}}
+	id, err := crm.CreateLead(context.Background(), "Jane Doe - Branding", "Hello there", "Branding", "person-1", "")
+	if err != nil || id != "leads-1" {
+		t.Fatalf("CreateLead = %q, %v; want leads-1", id, err)
+	}
+	if lead := stub.bodies["leads"]; lead["service"] != "Branding" || lead["personId"] != "person-1" {
+		t.Errorf("lead = %v, want the service and person", lead)
+	}
+	if target := stub.bodies["noteTargets"]; target["leadId"] != "leads-1" {
+		t.Errorf("note target = %v, want the note linked to the lead", target)
+	}
+}
+
+func TestRestFindPersonByPhone(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	t.Setenv("PERSON_PHONE_MATCH", "true")
+	stub, srv := newRestStub(t)
+	stub.on("/rest/people",
+		`{"data":{"people":[]}}`,
+		`{"data":{"people":[{"id":"person-1","phones":{"primaryPhoneNumber":"5551234567"}},{"id":"person-2","phones":{"primaryPhoneNumber":"5551234567","primaryPhoneCallingCode":"+1"}}]}}`)
+
+	crm := &restCRM{cfg: &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key"}}
+	personID, isNew, err := crm.FindOrCreatePerson(context.Background(), "Jane", "Doe", "jane@example.com", "+1 (555) 123-4567", "", "", nil)
+	if err != nil || personID != "person-2" || isNew {
+		t.Errorf("FindOrCreatePerson = %q, %t, %v; want the existing person-2", personID, isNew, err)
+	}
+
+	want := `or(phones.primaryPhoneNumber[eq]:"+15551234567",phones.primaryPhoneNumber[eq]:"15551234567",phones.primaryPhoneNumber[eq]:"5551234567")`
+	if len(stub.filters) != 2 || stub.filters[1] != want {
+		t.Errorf("filters = %v, want the phone search %s", stub.filters, want)
+	}
+	if other := stub.graphQLRequests(); len(other) > 0 {
+		t.Errorf("phone matching sent %v outside the REST API", other)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// dailyCapKey returns the store key and TTL for counting an email's
+// submissions. EMAIL_CAP_RESET=calendar counts per UTC calendar day;
+// the default, rolling, counts for 24 hours from the first submission.
+func dailyCapKey(cfg *Config, email string, now time.Time) (string, time.Duration) {
+	key := "daily-cap:" + strings.ToLower(strings.TrimSpace(email))
+	if cfg.EmailCapReset != "calendar" {
+		return key, 24 * time.Hour
+	}
+
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return key + ":" + now.Format("2006-01-02"), midnight.Sub(now)
+}
+
+// overDailyCap counts this submission against the email's daily cap
+// (EMAIL_DAILY_CAP; zero, the default, disables it) and reports whether the
+// cap is exceeded. Store errors let the lead through.
+func overDailyCap(cfg *Config, email string) bool {
+	limit := int64(cfg.EmailDailyCap)
+	if limit == 0 {
+		return false
+	}
+
+	key, ttl := dailyCapKey(cfg, email, systemClock.Now())
+	n, err := store.Incr(key, ttl)
+	if err != nil {
+		log.Printf("Warning: Failed to check daily submission cap: %v", err)
+		return false
+	}
+	return n > limit
+}
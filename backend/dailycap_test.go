@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// useCapClock points systemClock and a fresh memory store at one fake
+// clock, so cap keys and their expiry move together
+func useCapClock(t *testing.T) *fakeClock {
+	t.Helper()
+	clock := useSystemClock(t)
+	previous := store
+	store = newMemoryStore(clock)
+	t.Cleanup(func() { store = previous })
+	return clock
+}
+
+func TestDailyCapKey(t *testing.T) {
+	key, ttl := dailyCapKey(&Config{}, " Jane@Example.com ", testEpoch)
+	if key != "daily-cap:jane@example.com" || ttl != 24*time.Hour {
+		t.Errorf("rolling: %q, %v", key, ttl)
+	}
+
+	key, ttl = dailyCapKey(&Config{EmailCapReset: "calendar"}, "jane@example.com", testEpoch.In(time.FixedZone("PST", -8*60*60)))
+	if key != "daily-cap:jane@example.com:2024-03-01" || ttl != 12*time.Hour {
+		t.Errorf("calendar: %q, %v; want the UTC day and the time to midnight", key, ttl)
+	}
+}
+
+func TestOverDailyCapRolling(t *testing.T) {
+	clock := useCapClock(t)
+	cfg := &Config{EmailDailyCap: 2}
+
+	for i := 1; i <= 2; i++ {
+		if overDailyCap(cfg, "jane@example.com") {
+			t.Fatalf("submission %d over the cap of 2", i)
+		}
+	}
+	if !overDailyCap(cfg, "JANE@example.com") {
+		t.Fatal("third submission within a day not capped")
+	}
+	if overDailyCap(cfg, "john@example.com") {
+		t.Error("another email shares the cap")
+	}
+
+	// Midnight doesn't reset a rolling cap; 24 hours after the first does
+	clock.Advance(23*time.Hour + 59*time.Minute)
+	if !overDailyCap(cfg, "jane@example.com") {
+		t.Error("cap reset before 24 hours")
+	}
+	clock.Advance(time.Minute)
+	if overDailyCap(cfg, "jane@example.com") {
+		t.Error("cap not reset after 24 hours")
+	}
+}
+
+func TestOverDailyCapCalendar(t *testing.T) {
+	clock := useCapClock(t)
+	cfg := &Config{EmailDailyCap: 1, EmailCapReset: "calendar"}
+
+	overDailyCap(cfg, "jane@example.com")
+	clock.Advance(11*time.Hour + 59*time.Minute)
+	if !overDailyCap(cfg, "jane@example.com") {
+		t.Fatal("second submission on the same day not capped")
+	}
+
+	// The count starts over at UTC midnight
+	clock.Advance(time.Minute)
+	if overDailyCap(cfg, "jane@example.com") {
+		t.Error("cap not reset at midnight")
+	}
+	if !overDailyCap(cfg, "jane@example.com") {
+		t.Error("new day's cap not enforced")
+	}
+}
+
+func TestOverDailyCapDisabled(t *testing.T) {
+	useCapClock(t)
+	cfg := &Config{}
+	for i := 0; i < 10; i++ {
+		if overDailyCap(cfg, "jane@example.com") {
+			t.Fatal("capped without EMAIL_DAILY_CAP")
+		}
+	}
+}
+
+func TestHandleContactDailyCap(t *testing.T) {
+	useCapClock(t)
+	cfg := &Config{CRMMissingConfig: "unavailable", EmailDailyCap: 1}
+
+	// The first submission goes on to the CRM step; the second stops here
+	if w := postContact(cfg, validContactBody); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first submission: status = %d, want 503", w.Code)
+	}
+	w := postContact(cfg, validContactBody)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second submission: status = %d, want 429", w.Code)
+	}
+	if resp := responseOf(t, w); resp.Success || resp.Message == "" {
+		t.Errorf("response = %+v, want an explanation", resp)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// submissionDiscarded marks a failed submission an operator chose not to
+// replay. It stays in the store for reference but leaves the dead-letter list.
+const submissionDiscarded = "discarded"
+
+// handleListDeadLetters lists failed submissions with their last error over
+// ?since= (a Go duration, default 7 days)
+func handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since := 7 * 24 * time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+
+	subs, err := store.ListSubmissions(systemClock.Now().Add(-since))
+	if err != nil {
+		log.Printf("Failed to list submissions: %v", err)
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	failed := []Submission{}
+	for _, sub := range subs {
+		if sub.Status == submissionFailed {
+			failed = append(failed, sub)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":       len(failed),
+		"submissions": failed,
+	})
+}
+
+// handleRetryDeadLetter replays the failed submission ?id= through the lead
+// pipeline, resuming after the steps that already succeeded, and returns it
+// with its updated status. A retry that fails again answers 502.
+func handleRetryDeadLetter(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub, ok := deadLetterFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		log.Printf("Retrying failed submission %s (last error: %s)", sub.ID, sub.LastError)
+		completeLead(r.Context(), cfg, sub, sub.Request, 1)
+
+		status := http.StatusOK
+		if sub.Status == submissionFailed {
+			log.Printf("Retry of submission %s failed: %s", sub.ID, sub.LastError)
+			status = http.StatusBadGateway
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(sub)
+	}
+}
+
+// handleDiscardDeadLetter marks the failed submission ?id= as discarded
+func handleDiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	sub, ok := deadLetterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	sub.Status = submissionDiscarded
+	if err := store.SaveSubmission(sub); err != nil {
+		log.Printf("Failed to discard submission %s: %v", sub.ID, err)
+		http.Error(w, "Failed to discard submission", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Discarded failed submission %s", sub.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// deadLetterFromRequest loads the failed submission named by ?id= for a POST,
+// writing the error response and reporting false if there isn't one
+func deadLetterFromRequest(w http.ResponseWriter, r *http.Request) (*Submission, bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	sub, err := store.GetSubmission(id)
+	if err != nil {
+		log.Printf("Failed to load submission %s: %v", id, err)
+		http.Error(w, "Failed to load submission", http.StatusInternalServerError)
+		return nil, false
+	}
+	if sub == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if sub.Status != submissionFailed {
+		http.Error(w, "Submission is not failed (status: "+sub.Status+")", http.StatusConflict)
+		return nil, false
+	}
+
+	return sub, true
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// seedDeadLetters stores one processed and two failed submissions, one of
+// them older than the default listing window, in a fresh memory store
+func seedDeadLetters(t *testing.T) {
+	t.Helper()
+	clock := useCapClock(t)
+	store.SaveSubmission(&Submission{ID: "sub-old", Status: submissionFailed, LastError: "crm: timeout", Request: ContactRequest{Name: "Old Lead", Email: "old@example.com"}})
+	clock.Advance(8 * 24 * time.Hour)
+	store.SaveSubmission(&Submission{ID: "sub-ok", Status: submissionProcessed, Request: ContactRequest{Name: "John Doe", Email: "john@example.com"}})
+	store.SaveSubmission(&Submission{ID: "sub-failed", Status: submissionFailed, LastError: "crm: 503", Request: ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}})
+}
+
+// postDeadLetter calls handler with a POST for the submission id
+func postDeadLetter(handler http.HandlerFunc, id string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/api/admin/dead-letters?id="+id, nil))
+	return w
+}
+
+func TestHandleListDeadLetters(t *testing.T) {
+	seedDeadLetters(t)
+
+	w := httptest.NewRecorder()
+	handleListDeadLetters(w, httptest.NewRequest("GET", "/api/admin/dead-letters", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp struct {
+		Count       int          `json:"count"`
+		Submissions []Submission `json:"submissions"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Count != 1 || len(resp.Submissions) != 1 || resp.Submissions[0].ID != "sub-failed" || resp.Submissions[0].LastError != "crm: 503" {
+		t.Errorf("dead letters = %+v, want only the recent failure with its error", resp)
+	}
+
+	// A wider window reaches the older failure
+	w = httptest.NewRecorder()
+	handleListDeadLetters(w, httptest.NewRequest("GET", "/api/admin/dead-letters?since=240h", nil))
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Count != 2 {
+		t.Errorf("count with since=240h = %d, want 2", resp.Count)
+	}
+
+	w = httptest.NewRecorder()
+	handleListDeadLetters(w, httptest.NewRequest("GET", "/api/admin/dead-letters?since=soon", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status for an invalid since = %d, want 400", w.Code)
+	}
+}
+
+func TestHandleRetryDeadLetter(t *testing.T) {
+	seedDeadLetters(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+
+	w := postDeadLetter(handleRetryDeadLetter(cfg), "sub-failed")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if n := stub.count("CreateOpportunity"); n != 1 {
+		t.Errorf("%d opportunities created, want 1", n)
+	}
+	sub, _ := store.GetSubmission("sub-failed")
+	if sub == nil || sub.Status != submissionProcessed || sub.LastError != "" || sub.OpportunityID == "" {
+		t.Errorf("submission = %+v, want it processed", sub)
+	}
+
+	// Once processed it is no longer a dead letter
+	if w := postDeadLetter(handleRetryDeadLetter(cfg), "sub-failed"); w.Code != http.StatusConflict {
+		t.Errorf("status for a second retry = %d, want 409", w.Code)
+	}
+}
+
+func TestHandleRetryDeadLetterFailsAgain(t *testing.T) {
+	seedDeadLetters(t)
+	stub, cfg := useTwentyStub(t)
+	stub.on("CreatePerson", `{"errors":[{"message":"still down"}]}`)
+	cfg.NotifyChannels = []string{"teams"}
+
+	w := postDeadLetter(handleRetryDeadLetter(cfg), "sub-failed")
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+	sub, _ := store.GetSubmission("sub-failed")
+	if sub == nil || sub.Status != submissionFailed || sub.LastError == "crm: 503" {
+		t.Errorf("submission = %+v, want it still failed with the new error", sub)
+	}
+}
+
+func TestHandleDiscardDeadLetter(t *testing.T) {
+	seedDeadLetters(t)
+
+	if w := postDeadLetter(handleDiscardDeadLetter, "sub-failed"); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	sub, _ := store.GetSubmission("sub-failed")
+	if sub == nil || sub.Status != submissionDiscarded || sub.LastError != "crm: 503" {
+		t.Errorf("submission = %+v, want it discarded with its error kept", sub)
+	}
+
+	w := httptest.NewRecorder()
+	handleListDeadLetters(w, httptest.NewRequest("GET", "/api/admin/dead-letters", nil))
+	var resp struct {
+		Count int `json:"count"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Count != 0 {
+		t.Errorf("count after discarding = %d, want 0", resp.Count)
+	}
+}
+
+func TestDeadLetterFromRequest(t *testing.T) {
+	seedDeadLetters(t)
+
+	tests := []struct {
+		method string
+		id     string
+		want   int
+	}{
+		{"GET", "sub-failed", http.StatusMethodNotAllowed},
+		{"POST", "", http.StatusBadRequest},
+		{"POST", "sub-missing", http.StatusNotFound},
+		{"POST", "sub-ok", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handleDiscardDeadLetter(w, httptest.NewRequest(tt.method, "/api/admin/dead-letters/discard?id="+tt.id, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s id=%q: status = %d, want %d", tt.method, tt.id, w.Code, tt.want)
+		}
+	}
+	if sub, _ := store.GetSubmission("sub-ok"); sub.Status != submissionProcessed {
+		t.Errorf("processed submission status = %q, want it untouched", sub.Status)
+	}
+}
+
+func TestDeadLetterRoutesRequireAdmin(t *testing.T) {
+	seedDeadLetters(t)
+
+	w := postDeadLetter(requireAdmin(&Config{AdminAPIKey: "admin-key"}, handleDiscardDeadLetter), "sub-failed")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status without a key = %d, want 401", w.Code)
+	}
+	if sub, _ := store.GetSubmission("sub-failed"); sub.Status != submissionFailed {
+		t.Errorf("status = %q after an unauthorized discard, want failed", sub.Status)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultOpportunityDescTemplate renders the message followed by whichever
+// lead details are present
+const defaultOpportunityDescTemplate = `{{.Message}}
+
+{{with .Service}}- Service: {{.}}
+{{end}}{{with .Company}}- Company: {{.}}
+{{end}}{{with .Title}}- Title: {{.}}
+{{end}}{{with .Website}}- Website: {{.}}
+{{end}}{{with .Location}}- Location: {{.}}
+{{end}}{{with .ReferralSource}}- Heard about us: {{.}}
+{{end}}{{with .ReferrerChain}}- Journey:
+{{range .}}  - {{.}}
+{{end}}{{end}}`
+
+var extraBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// renderOpportunityDescription renders OPPORTUNITY_DESC_TEMPLATE (a
+// text/template over ContactRequest, overridden by the form profile's
+// descriptionTemplate) for the opportunity's description note, and for the
+// field named by OPPORTUNITY_DESCRIPTION_FIELD when set. Runs of blank
+// lines left by empty fields are collapsed. If the template is invalid the
+// plain message is used instead.
+func renderOpportunityDescription(cfg *Config, req ContactRequest) string {
+	text := cfg.OpportunityDescTemplate
+	if profile, _ := lookupFormProfile(cfg, req.FormType); profile.DescriptionTemplate != "" {
+		text = profile.DescriptionTemplate
+	}
+	if text == "" {
+		text = defaultOpportunityDescTemplate
+	}
+
+	tmpl, err := template.New("description").Parse(text)
+	if err != nil {
+		log.Printf("Warning: Invalid OPPORTUNITY_DESC_TEMPLATE, using message only: %v", err)
+		return req.Message
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, req); err != nil {
+		log.Printf("Warning: Failed to render opportunity description, using message only: %v", err)
+		return req.Message
+	}
+
+	return strings.TrimSpace(extraBlankLines.ReplaceAllString(b.String(), "\n\n"))
+}
+
+// defaultOpportunityNameTemplate names opportunities "<name> - <service>",
+// or "<name> - Website Inquiry" when no service was picked
+const defaultOpportunityNameTemplate = `{{.Name}} - {{or .Service "Website Inquiry"}}`
+
+// renderOpportunityName renders OPPORTUNITY_NAME_TEMPLATE (a text/template
+// over ContactRequest) for the opportunity's name, e.g. "{{.Name}}" to drop
+// the suffix. A template that fails to render, or renders blank, falls back
+// to the default.
+func renderOpportunityName(cfg *Config, req ContactRequest) string {
+	text := cfg.OpportunityNameTemplate
+	if text == "" {
+		text = defaultOpportunityNameTemplate
+	}
+
+	name, err := executeOpportunityName(text, req)
+	if err != nil {
+		log.Printf("Warning: Failed to render opportunity name, using default: %v", err)
+	}
+	if name == "" {
+		name, _ = executeOpportunityName(defaultOpportunityNameTemplate, req)
+	}
+	return name
+}
+
+// executeOpportunityName renders a name template with whitespace collapsed
+func executeOpportunityName(text string, req ContactRequest) (string, error) {
+	tmpl, err := template.New("name").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, req); err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestRenderOpportunityDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		req      ContactRequest
+		want     string
+	}{
+		{
+			name: "populated",
+			req: ContactRequest{
+				Message:        "We need a new logo.",
+				Service:        "Branding",
+				Company:        "Acme",
+				Title:          "CEO",
+				Website:        "https://acme.example",
+				ReferralSource: "Google",
+				ReferrerChain:  []string{"/blog", "/pricing"},
+			},
+			want: "We need a new logo.\n\n" +
+				"- Service: Branding\n" +
+				"- Company: Acme\n" +
+				"- Title: CEO\n" +
+				"- Website: https://acme.example\n" +
+				"- Heard about us: Google\n" +
+				"- Journey:\n" +
+				"  - /blog\n" +
+				"  - /pricing",
+		},
+		{
+			name: "sparse",
+			req:  ContactRequest{Message: "Hi", Company: "Acme"},
+			want: "Hi\n\n- Company: Acme",
+		},
+		{
+			name: "message only",
+			req:  ContactRequest{Message: "Hi"},
+			want: "Hi",
+		},
+		{
+			name:     "custom template collapses blank lines",
+			template: "{{.Message}}\n\n\n\n{{.Service}}",
+			req:      ContactRequest{Message: "Hi", Service: "Web"},
+			want:     "Hi\n\nWeb",
+		},
+		{
+			name:     "invalid template falls back to the message",
+			template: "{{.Message",
+			req:      ContactRequest{Message: "Hi", Service: "Web"},
+			want:     "Hi",
+		},
+		{
+			name:     "unknown field falls back to the message",
+			template: "{{.NoSuchField}}",
+			req:      ContactRequest{Message: "Hi"},
+			want:     "Hi",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{OpportunityDescTemplate: tt.template}
+			if got := renderOpportunityDescription(cfg, tt.req); got != tt.want {
+				t.Errorf("renderOpportunityDescription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpportunityDescriptionField(t *testing.T) {
+	req := ContactRequest{Message: "Hi"}
+
+	cfg := &Config{}
+	if _, ok := opportunityCustomFields(cfg, req, &LeadResult{}, "Hi")["description"]; ok {
+		t.Error("description written without OPPORTUNITY_DESCRIPTION_FIELD")
+	}
+
+	cfg.OpportunityDescriptionField = "description"
+	if got := opportunityCustomFields(cfg, req, &LeadResult{}, "Hi")["description"]; got != "Hi" {
+		t.Errorf("description = %v, want Hi", got)
+	}
+}
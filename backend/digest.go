@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+// digestEntry is one buffered lead notification
+type digestEntry struct {
+	Req        ContactRequest
+	Lead       *LeadResult
+	ReceivedAt time.Time
+}
+
+// notificationDigest buffers lead notifications per recipient and sends them
+// as a single summary email when flushed
+type notificationDigest struct {
+	mu       sync.Mutex
+	clock    Clock
+	maxLeads int
+	pending  map[string][]digestEntry
+	send     func(recipient string, entries []digestEntry) error
+}
+
+// digest is nil unless NOTIFICATION_MODE=digest
+var digest *notificationDigest
+
+func newNotificationDigest(clock Clock, maxLeads int, send func(string, []digestEntry) error) *notificationDigest {
+	return &notificationDigest{
+		clock:    clock,
+		maxLeads: maxLeads,
+		pending:  make(map[string][]digestEntry),
+		send:     send,
+	}
+}
+
+// digestEnabled reports whether NOTIFICATION_MODE selects digest emails
+// instead of one email per lead (immediate, the default)
+func digestEnabled(cfg *Config) bool {
+	return cfg.NotificationMode == "digest"
+}
+
+// digestInterval returns DIGEST_INTERVAL (default 15m)
+func digestInterval() time.Duration {
+	return envDuration("DIGEST_INTERVAL", 15*time.Minute)
+}
+
+// Add buffers a notification for recipient, sending that recipient's digest
+// right away once maxLeads is reached
+func (d *notificationDigest) Add(recipient string, req ContactRequest, lead *LeadResult) {
+	d.mu.Lock()
+	d.pending[recipient] = append(d.pending[recipient], digestEntry{Req: req, Lead: lead, ReceivedAt: d.clock.Now()})
+	full := d.maxLeads > 0 && len(d.pending[recipient]) >= d.maxLeads
+	var entries []digestEntry
+	if full {
+		entries = d.pending[recipient]
+		delete(d.pending, recipient)
+	}
+	d.mu.Unlock()
+
+	if !full {
+		return
+	}
+
+	// Keep the leads buffered for the next flush if the early send fails
+	if err := d.send(recipient, entries); err != nil {
+		log.Printf("Warning: Failed to send lead digest to %s (%d leads): %v", recipient, len(entries), err)
+		d.requeue(recipient, entries)
+	}
+}
+
+// requeue puts entries back ahead of anything buffered since
+func (d *notificationDigest) requeue(recipient string, entries []digestEntry) {
+	d.mu.Lock()
+	d.pending[recipient] = append(entries, d.pending[recipient]...)
+	d.mu.Unlock()
+}
+
+// Flush sends every buffered digest. Recipients whose send fails keep their
+// entries so the next flush retries them.
+func (d *notificationDigest) Flush() error {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string][]digestEntry)
+	d.mu.Unlock()
+
+	var failed int
+	for recipient, entries := range pending {
+		if err := d.send(recipient, entries); err != nil {
+			log.Printf("Warning: Failed to send lead digest to %s (%d leads): %v", recipient, len(entries), err)
+			failed++
+			d.requeue(recipient, entries)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d %s failed to send", failed, pluralize(failed, "digest", "digests"))
+	}
+	return nil
+}
+
+// runDigest flushes the digest every interval until stop is closed, then
+// flushes once more so no buffered lead is lost on shutdown
+func runDigest(d *notificationDigest, interval time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-d.clock.After(interval):
+			d.Flush()
+		case <-stop:
+			d.Flush()
+			return
+		}
+	}
+}
+
+// buildDigestBody renders the plain-text digest listing each lead in the
+// order received, with its CRM link when includeCRMLink is set
+func buildDigestBody(cfg *Config, entries []digestEntry, includeCRMLink bool) string {
+	sorted := make([]digestEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ReceivedAt.Before(sorted[j].ReceivedAt) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new %s from sogos.io website\n", len(sorted), pluralize(len(sorted), "lead", "leads"))
+
+	for i, entry := range sorted {
+		req := entry.Req
+		fmt.Fprintf(&b, "\n%d. %s <%s>", i+1, req.Name, req.Email)
+		if req.Company != "" {
+			fmt.Fprintf(&b, " — %s", req.Company)
+		}
+		fmt.Fprintf(&b, "\n   Received: %s", entry.ReceivedAt.UTC().Format(time.RFC1123))
+		if req.Service != "" {
+			fmt.Fprintf(&b, "\n   Service Interest: %s", req.Service)
+		}
+		if req.Phone != "" {
+			fmt.Fprintf(&b, "\n   Phone: %s", req.Phone)
+		}
+		if message := messageOrPlaceholder(cfg, req.Message); message != "" {
+			fmt.Fprintf(&b, "\n   Message: %s", strings.Join(strings.Fields(message), " "))
+		}
+
+		lead := entry.Lead
+		switch {
+		case !includeCRMLink || lead == nil:
+		case lead.OpportunityID != "":
+			fmt.Fprintf(&b, "\n   📊 View in CRM: %s/object/opportunity/%s", cfg.TwentyAPIURL, lead.OpportunityID)
+		case lead.LeadID != "":
+			fmt.Fprintf(&b, "\n   📊 View in CRM: %s/object/lead/%s", cfg.TwentyAPIURL, lead.LeadID)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// sendDigestEmail mails a digest to recipient, and a copy to the
+// CONTACT_EMAIL_CC addresses (with CRM links only if CRM_LINK_FOR_CC is set)
+func sendDigestEmail(cfg *Config, recipient string, entries []digestEntry) error {
+	apiKey := cfg.MailgunAPIKey
+	domain := cfg.MailgunDomain
+
+	if apiKey == "" || domain == "" {
+		return fmt.Errorf("mailgun configuration missing")
+	}
+
+	mg := mailgun.NewMailgun(domain, apiKey)
+	subject := fmt.Sprintf("🎯 Lead Digest: %d new %s", len(entries), pluralize(len(entries), "lead", "leads"))
+
+	send := func(body string, recipients ...string) error {
+		subject, recipients, err := applyMailgunSandbox(cfg, subject, recipients)
+		if err != nil {
+			return err
+		}
+
+		m := mg.NewMessage(
+			fmt.Sprintf("Sogos CRM <noreply@%s>", domain),
+			subject,
+			body,
+			recipients...,
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		_, _, err = mg.Send(ctx, m)
+		return err
+	}
+
+	if err := send(buildDigestBody(cfg, entries, true), recipient); err != nil {
+		return err
+	}
+
+	if cc := cfg.ContactEmailCC; len(cc) > 0 {
+		if err := send(buildDigestBody(cfg, entries, envBool("CRM_LINK_FOR_CC")), cc...); err != nil {
+			log.Printf("Warning: Failed to send CC lead digest: %v", err)
+		}
+	}
+
+	return nil
+}
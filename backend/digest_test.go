@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// digestSends records the digests a notificationDigest sends
+type digestSends struct {
+	mu   sync.Mutex
+	sent map[string][][]digestEntry
+	err  error
+}
+
+func (s *digestSends) send(recipient string, entries []digestEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.sent == nil {
+		s.sent = make(map[string][][]digestEntry)
+	}
+	s.sent[recipient] = append(s.sent[recipient], entries)
+	return nil
+}
+
+func (s *digestSends) digests(recipient string) [][]digestEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent[recipient]
+}
+
+func (s *digestSends) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func TestBuildDigestBody(t *testing.T) {
+	entries := []digestEntry{
+		{Req: ContactRequest{Name: "John Roe", Email: "john@example.com"}, Lead: &LeadResult{LeadID: "lead-2"}, ReceivedAt: testEpoch.Add(time.Minute)},
+		{Req: ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Company: "Acme", Service: "Branding", Phone: "555-0100", Message: "Hello\n  there"}, Lead: &LeadResult{OpportunityID: "opportunity-1"}, ReceivedAt: testEpoch},
+		{Req: ContactRequest{Name: "No CRM", Email: "nocrm@example.com"}, ReceivedAt: testEpoch.Add(2 * time.Minute)},
+	}
+
+	cfg := &Config{TwentyAPIURL: "https://crm.example.com"}
+	body := buildDigestBody(cfg, entries, true)
+	for _, want := range []string{
+		"3 new leads from sogos.io website",
+		"1. Jane Doe <jane@example.com> — Acme",
+		"Received: " + testEpoch.Format(time.RFC1123),
+		"Service Interest: Branding",
+		"Phone: 555-0100",
+		"Message: Hello there",
+		"View in CRM: https://crm.example.com/object/opportunity/opportunity-1",
+		"2. John Roe <john@example.com>",
+		"View in CRM: https://crm.example.com/object/lead/lead-2",
+		"3. No CRM <nocrm@example.com>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("digest lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Count(body, "View in CRM") != 2 {
+		t.Errorf("want a CRM link only for leads with records:\n%s", body)
+	}
+
+	if body := buildDigestBody(cfg, entries, false); strings.Contains(body, "View in CRM") {
+		t.Errorf("CRM links included when disabled:\n%s", body)
+	}
+	if body := buildDigestBody(&Config{}, entries[:1], false); !strings.HasPrefix(body, "1 new lead from") {
+		t.Errorf("single lead digest = %q", body)
+	}
+}
+
+func TestNotificationDigestFlush(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	sends := &digestSends{}
+	d := newNotificationDigest(clock, 0, sends.send)
+
+	d.Add("sales@example.com", ContactRequest{Name: "Jane"}, nil)
+	d.Add("design@example.com", ContactRequest{Name: "John"}, nil)
+	d.Add("sales@example.com", ContactRequest{Name: "Ann"}, nil)
+	if len(sends.digests("sales@example.com")) != 0 {
+		t.Fatal("digest sent before a flush")
+	}
+
+	if err := d.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := sends.digests("sales@example.com"); len(got) != 1 || len(got[0]) != 2 || got[0][0].Req.Name != "Jane" {
+		t.Errorf("sales digests = %+v, want one with both leads", got)
+	}
+	if got := sends.digests("design@example.com"); len(got) != 1 || len(got[0]) != 1 {
+		t.Errorf("design digests = %+v", got)
+	}
+
+	// Nothing buffered, nothing sent
+	d.Flush()
+	if got := sends.digests("sales@example.com"); len(got) != 1 {
+		t.Errorf("empty flush sent %d digests", len(got)-1)
+	}
+}
+
+func TestNotificationDigestMaxLeads(t *testing.T) {
+	sends := &digestSends{}
+	d := newNotificationDigest(newFakeClock(testEpoch), 2, sends.send)
+
+	d.Add("sales@example.com", ContactRequest{Name: "Jane"}, nil)
+	if len(sends.digests("sales@example.com")) != 0 {
+		t.Fatal("digest sent below DIGEST_MAX_LEADS")
+	}
+	d.Add("sales@example.com", ContactRequest{Name: "John"}, nil)
+	if got := sends.digests("sales@example.com"); len(got) != 1 || len(got[0]) != 2 {
+		t.Fatalf("digests = %+v, want an early send of both leads", got)
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("pending = %+v after the early send", d.pending)
+	}
+}
+
+func TestNotificationDigestFailedSendRetries(t *testing.T) {
+	sends := &digestSends{}
+	d := newNotificationDigest(newFakeClock(testEpoch), 0, sends.send)
+	d.Add("sales@example.com", ContactRequest{Name: "Jane"}, nil)
+
+	sends.fail(errors.New("mailgun down"))
+	if err := d.Flush(); err == nil {
+		t.Fatal("Flush succeeded with a failing send")
+	}
+	d.Add("sales@example.com", ContactRequest{Name: "John"}, nil)
+
+	sends.fail(nil)
+	if err := d.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	got := sends.digests("sales@example.com")
+	if len(got) != 1 || len(got[0]) != 2 || got[0][0].Req.Name != "Jane" || got[0][1].Req.Name != "John" {
+		t.Errorf("digests = %+v, want the retried lead first", got)
+	}
+}
+
+func TestRunDigestFlushesOnShutdown(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	sends := &digestSends{}
+	d := newNotificationDigest(clock, 0, sends.send)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runDigest(d, time.Hour, stop)
+		close(done)
+	}()
+
+	// The interval flush sends what's buffered
+	waitForWaiters(t, clock, 1)
+	d.Add("sales@example.com", ContactRequest{Name: "Jane"}, nil)
+	clock.Advance(time.Hour)
+	waitForWaiters(t, clock, 1)
+	if got := sends.digests("sales@example.com"); len(got) != 1 {
+		t.Fatalf("interval flush sent %d digests, want 1", len(got))
+	}
+
+	// Shutdown sends the rest without waiting for the interval
+	d.Add("sales@example.com", ContactRequest{Name: "John"}, nil)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runDigest did not stop")
+	}
+	if got := sends.digests("sales@example.com"); len(got) != 2 || got[1][0].Req.Name != "John" {
+		t.Errorf("digests = %+v, want the buffered lead flushed on shutdown", got)
+	}
+}
+
+func TestSendNotificationEmailBuffersDigest(t *testing.T) {
+	useMemoryStore(t)
+	sends := &digestSends{}
+	previous := digest
+	digest = newNotificationDigest(newFakeClock(testEpoch), 0, sends.send)
+	t.Cleanup(func() { digest = previous })
+
+	cfg := &Config{MailgunAPIKey: "key", MailgunDomain: "mg.example.com", ContactEmail: "sales@example.com"}
+	if err := sendNotificationEmail(cfg, ContactRequest{Name: "Jane", Email: "jane@example.com"}, nil); err != nil {
+		t.Fatalf("sendNotificationEmail: %v", err)
+	}
+	if len(digest.pending["sales@example.com"]) != 1 {
+		t.Errorf("pending = %+v, want the lead buffered for sales", digest.pending)
+	}
+}
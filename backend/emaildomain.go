@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MXResolver looks up the DNS records used to check an email domain
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// mxResolver is the resolver used by checkEmailDomain
+var mxResolver MXResolver = net.DefaultResolver
+
+// errEmailDomainUnreachable means the email's domain has no MX or A records
+var errEmailDomainUnreachable = errors.New("email domain does not accept mail")
+
+// isValidEmail reports whether email (after trimming whitespace) is a bare
+// address with a local part and a dotted domain. Display names and angle
+// brackets are not accepted.
+func isValidEmail(email string) bool {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return false
+	}
+
+	local, domain, ok := strings.Cut(addr.Address, "@")
+	if !ok || local == "" {
+		return false
+	}
+	dot := strings.LastIndex(domain, ".")
+	return dot > 0 && dot < len(domain)-1
+}
+
+// replyToAddress returns the notification's Reply-To: the submitter's email
+// when it is valid, otherwise REPLY_TO_FALLBACK (empty omits the header so
+// replies don't bounce off a malformed address)
+func replyToAddress(cfg *Config, email string) string {
+	if isValidEmail(email) {
+		return strings.TrimSpace(email)
+	}
+	return cfg.ReplyToFallback
+}
+
+// emailMXTimeout returns EMAIL_MX_TIMEOUT (default 2s)
+func emailMXTimeout() time.Duration {
+	return envDuration("EMAIL_MX_TIMEOUT", 2*time.Second)
+}
+
+// checkEmailDomain verifies, when VALIDATE_EMAIL_MX is enabled, that the
+// email's domain has an MX record or, failing that, an address record that
+// can receive mail. Only a definitive "no such records" answer rejects the
+// email; timeouts and other resolver errors are logged and accepted so a
+// DNS hiccup never blocks a real lead.
+func checkEmailDomain(email string) error {
+	if !envBool("VALIDATE_EMAIL_MX") {
+		return nil
+	}
+
+	_, domain, ok := strings.Cut(strings.TrimSpace(email), "@")
+	if !ok || domain == "" {
+		return fmt.Errorf("%w: missing domain", errEmailDomainUnreachable)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), emailMXTimeout())
+	defer cancel()
+
+	mx, err := mxResolver.LookupMX(ctx, domain)
+	if err == nil && len(mx) > 0 {
+		return nil
+	}
+	if err != nil && !isDNSNotFound(err) {
+		log.Printf("Warning: MX lookup for %s failed, accepting email: %v", domain, err)
+		return nil
+	}
+
+	// No MX records: mail falls back to the domain's address records
+	hosts, err := mxResolver.LookupHost(ctx, domain)
+	if err == nil && len(hosts) > 0 {
+		return nil
+	}
+	if err != nil && !isDNSNotFound(err) {
+		log.Printf("Warning: Host lookup for %s failed, accepting email: %v", domain, err)
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", errEmailDomainUnreachable, domain)
+}
+
+// isDNSNotFound reports whether err is a definitive "no such host/records"
+// answer rather than a transient failure
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
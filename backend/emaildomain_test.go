@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubResolver answers MX and host lookups from fixed results
+type stubResolver struct {
+	mx      []*net.MX
+	mxErr   error
+	hosts   []string
+	hostErr error
+	block   bool
+}
+
+func (s stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if s.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.mx, s.mxErr
+}
+
+func (s stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return s.hosts, s.hostErr
+}
+
+// useMXResolver swaps mxResolver for the duration of the test
+func useMXResolver(t *testing.T, r MXResolver) {
+	t.Helper()
+	previous := mxResolver
+	mxResolver = r
+	t.Cleanup(func() { mxResolver = previous })
+}
+
+func TestCheckEmailDomain(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}
+	tests := []struct {
+		name     string
+		resolver stubResolver
+		wantErr  bool
+	}{
+		{"has MX", stubResolver{mx: []*net.MX{{Host: "mx.example.com."}}}, false},
+		{"no MX, has A", stubResolver{mxErr: notFound, hosts: []string{"192.0.2.1"}}, false},
+		{"no MX or A", stubResolver{mxErr: notFound, hostErr: notFound}, true},
+		{"empty MX and A", stubResolver{}, true},
+		{"MX lookup error", stubResolver{mxErr: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}, false},
+		{"host lookup error", stubResolver{mxErr: notFound, hostErr: errors.New("connection refused")}, false},
+	}
+	t.Setenv("VALIDATE_EMAIL_MX", "true")
+	for _, tt := range tests {
+		useMXResolver(t, tt.resolver)
+		err := checkEmailDomain("jane@example.com")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkEmailDomain = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, errEmailDomainUnreachable) {
+			t.Errorf("%s: err = %v, want errEmailDomainUnreachable", tt.name, err)
+		}
+	}
+}
+
+func TestCheckEmailDomainTimeoutFailsOpen(t *testing.T) {
+	t.Setenv("VALIDATE_EMAIL_MX", "true")
+	t.Setenv("EMAIL_MX_TIMEOUT", "10ms")
+	useMXResolver(t, stubResolver{block: true})
+
+	start := time.Now()
+	if err := checkEmailDomain("jane@example.com"); err != nil {
+		t.Errorf("checkEmailDomain = %v, want a timeout to accept", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %v, want it bounded by EMAIL_MX_TIMEOUT", elapsed)
+	}
+}
+
+func TestCheckEmailDomainDisabled(t *testing.T) {
+	t.Setenv("VALIDATE_EMAIL_MX", "")
+	useMXResolver(t, stubResolver{})
+	if err := checkEmailDomain("jane@example.invalid"); err != nil {
+		t.Errorf("checkEmailDomain = %v with the check disabled", err)
+	}
+}
+
+func TestHandleContactRejectsUnreachableDomain(t *testing.T) {
+	useMemoryStore(t)
+	t.Setenv("VALIDATE_EMAIL_MX", "true")
+	useMXResolver(t, stubResolver{})
+
+	w := postContact(&Config{CRMMissingConfig: "unavailable"}, validContactBody)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if resp := responseOf(t, w); resp.Code != codeValidationError {
+		t.Errorf("code = %q, want %q", resp.Code, codeValidationError)
+	}
+}
+
+func TestReplyToAddress(t *testing.T) {
+	tests := []struct {
+		email, fallback, want string
+	}{
+		{"jane@example.com", "sales@sogos.io", "jane@example.com"},
+		{" jane@example.com ", "", "jane@example.com"},
+		{"jane@example", "sales@sogos.io", "sales@sogos.io"},
+		{"Jane <jane@example.com>", "sales@sogos.io", "sales@sogos.io"},
+		{"not an email", "", ""},
+	}
+	for _, tt := range tests {
+		if got := replyToAddress(&Config{ReplyToFallback: tt.fallback}, tt.email); got != tt.want {
+			t.Errorf("replyToAddress(%q) with fallback %q = %q, want %q", tt.email, tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationFlagsInvalidEmailOnce(t *testing.T) {
+	cfg := &Config{}
+	lead := &LeadResult{PersonID: "person-1", OpportunityID: "opportunity-1"}
+	const warning = "Invalid email, not used for Reply-To"
+
+	valid := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+	if body := buildNotificationBody(cfg, valid, lead, false); strings.Contains(body, warning) {
+		t.Errorf("body flags a valid email:\n%s", body)
+	}
+
+	invalid := ContactRequest{Name: "Jane Doe", Email: "jane at example", Service: "Branding"}
+	body := buildNotificationBody(cfg, invalid, lead, false)
+	if n := strings.Count(body, warning); n != 1 {
+		t.Errorf("body flags the invalid email %d times, want once:\n%s", n, body)
+	}
+	if !strings.Contains(body, `"jane at example"`) {
+		t.Errorf("body lacks the raw submitted email:\n%s", body)
+	}
+	if html := buildNotificationHTML(cfg, invalid, lead, false); strings.Count(html, warning) != 1 {
+		t.Errorf("HTML flags the invalid email %d times, want once:\n%s", strings.Count(html, warning), html)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// EnrichmentResult is the subset of the enrichment service response we use
+type EnrichmentResult struct {
+	Company     string `json:"company"`
+	Title       string `json:"title"`
+	CompanySize int    `json:"companySize"`
+}
+
+// enrichmentTimeout returns the timeout for enrichment lookups (default 3s)
+func enrichmentTimeout(cfg *Config) time.Duration {
+	if cfg.EnrichmentTimeout > 0 {
+		return cfg.EnrichmentTimeout
+	}
+	return 3 * time.Second
+}
+
+// fetchEnrichment looks up the email against the enrichment service
+func fetchEnrichment(cfg *Config, email string) (*EnrichmentResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), enrichmentTimeout(cfg))
+	defer cancel()
+
+	u, err := url.Parse(cfg.EnrichmentURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrichment URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("email", email)
+	u.RawQuery = q.Encode()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if cfg.EnrichmentAPIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+cfg.EnrichmentAPIKey)
+	}
+
+	client := &http.Client{}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(body))
+	}
+
+	var result EnrichmentResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// mergeEnrichment fills empty request fields from the enrichment result.
+// Values the user provided are never overwritten.
+func mergeEnrichment(req *ContactRequest, enrichment *EnrichmentResult) {
+	if req.Company == "" {
+		req.Company = enrichment.Company
+	}
+	if req.Title == "" {
+		req.Title = enrichment.Title
+	}
+	if req.CompanySize == 0 {
+		req.CompanySize = enrichment.CompanySize
+	}
+}
+
+// enrichRequest merges enrichment data into req when ENRICHMENT_URL is set.
+// Enrichment is best-effort and never fails the lead.
+func enrichRequest(cfg *Config, req *ContactRequest) {
+	if cfg.EnrichmentURL == "" || req.Email == "" {
+		return
+	}
+
+	enrichment, err := fetchEnrichment(cfg, req.Email)
+	if err != nil {
+		log.Printf("Warning: Failed to enrich lead %s: %v", req.Email, err)
+		return
+	}
+
+	mergeEnrichment(req, enrichment)
+}
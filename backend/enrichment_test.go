@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnrichRequestMerges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("email"); got != "jane@example.com" {
+			t.Errorf("email query = %q", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		w.Write([]byte(`{"company":"Acme","title":"CTO","companySize":250}`))
+	}))
+	defer srv.Close()
+	cfg := &Config{EnrichmentURL: srv.URL, EnrichmentAPIKey: "key"}
+
+	req := ContactRequest{Email: "jane@example.com", Company: "Jane's Shop"}
+	enrichRequest(cfg, &req)
+
+	if req.Company != "Jane's Shop" {
+		t.Errorf("Company = %q, the user's value was overwritten", req.Company)
+	}
+	if req.Title != "CTO" || req.CompanySize != 250 {
+		t.Errorf("Title = %q, CompanySize = %d; want the enriched values", req.Title, req.CompanySize)
+	}
+}
+
+func TestEnrichRequestFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}},
+		{"malformed body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`not json`))
+		}},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			cfg := &Config{EnrichmentURL: srv.URL, EnrichmentTimeout: 50 * time.Millisecond}
+
+			req := ContactRequest{Email: "jane@example.com", Company: "Acme"}
+			enrichRequest(cfg, &req)
+			if req.Company != "Acme" || req.Title != "" || req.CompanySize != 0 {
+				t.Errorf("request changed after a failed lookup: %+v", req)
+			}
+		})
+	}
+}
+
+func TestEnrichRequestDisabled(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	enrichRequest(&Config{}, &ContactRequest{Email: "jane@example.com"})
+	enrichRequest(&Config{EnrichmentURL: srv.URL}, &ContactRequest{})
+
+	if called {
+		t.Error("enrichment service was called without a URL or an email")
+	}
+}
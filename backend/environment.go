@@ -0,0 +1,22 @@
+package main
+
+// environmentFields returns ENVIRONMENT_TAG, the label marking records a
+// non-production deployment creates (e.g. "staging"), as the custom field
+// named by ENVIRONMENT_TAG_FIELD, for new people and opportunities. It is
+// empty unless both are set.
+func environmentFields(cfg *Config) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if cfg.EnvironmentTagField != "" && cfg.EnvironmentTag != "" {
+		fields[cfg.EnvironmentTagField] = cfg.EnvironmentTag
+	}
+	return fields
+}
+
+// taggedOpportunityName prefixes name with "[tag]" when ENVIRONMENT_TAG is
+// set without a field to hold it, so tagged leads still stand out in Twenty
+func taggedOpportunityName(cfg *Config, name string) string {
+	if cfg.EnvironmentTag != "" && cfg.EnvironmentTagField == "" {
+		return "[" + cfg.EnvironmentTag + "] " + name
+	}
+	return name
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnvironmentFields(t *testing.T) {
+	tests := []struct {
+		tag, field string
+		want       map[string]interface{}
+	}{
+		{"staging", "environment", map[string]interface{}{"environment": "staging"}},
+		{"staging", "", map[string]interface{}{}},
+		{"", "environment", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		got := environmentFields(&Config{EnvironmentTag: tt.tag, EnvironmentTagField: tt.field})
+		if len(got) != len(tt.want) || got[tt.field] != tt.want[tt.field] {
+			t.Errorf("tag %q, field %q: environmentFields() = %v, want %v", tt.tag, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestTaggedOpportunityName(t *testing.T) {
+	tests := []struct {
+		tag, field, want string
+	}{
+		{"staging", "", "[staging] Jane Doe - Branding"},
+		{"staging", "environment", "Jane Doe - Branding"},
+		{"", "", "Jane Doe - Branding"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{EnvironmentTag: tt.tag, EnvironmentTagField: tt.field}
+		if got := taggedOpportunityName(cfg, "Jane Doe - Branding"); got != tt.want {
+			t.Errorf("tag %q, field %q: taggedOpportunityName = %q, want %q", tt.tag, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTwentyLeadEnvironmentTag(t *testing.T) {
+	tests := []struct {
+		name, tag, field string
+		wantTagged       bool
+		wantName         string
+	}{
+		{"tag in a field", "staging", "environment", true, "Jane Doe - Branding"},
+		{"tag in the name", "staging", "", false, "[staging] Jane Doe - Branding"},
+		{"production", "", "environment", false, "Jane Doe - Branding"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, cfg := useTwentyStub(t)
+			cfg.EnvironmentTag = tt.tag
+			cfg.EnvironmentTagField = tt.field
+
+			req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+			if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+				t.Fatalf("createTwentyLead: %v", err)
+			}
+
+			for _, op := range []string{"CreatePerson", "CreateOpportunity"} {
+				value, tagged := stub.input(op)["environment"]
+				if tagged != tt.wantTagged || (tagged && value != "staging") {
+					t.Errorf("%s environment = %v, want tagged %v", op, value, tt.wantTagged)
+				}
+			}
+			if got := stub.input("CreateOpportunity")["name"]; got != tt.wantName {
+				t.Errorf("opportunity name = %v, want %q", got, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// featureFlags holds runtime overrides for boolean and duration settings,
+// fetched from FEATURE_FLAGS_URL. The env config stays the default for any
+// setting the flag document doesn't mention, and for every setting outside
+// rolloutFlags.
+type featureFlags struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// flags is empty (everything comes from the env) unless the poller runs
+var flags = &featureFlags{}
+
+// rolloutFlags are the settings the flag document may override: feature
+// rollouts and lead-handling windows. Security settings (ALLOW_INSECURE_CRM,
+// MAILGUN_SANDBOX, SECURITY_HEADERS, the bot filters) and infrastructure
+// tuning always come from the env, so a compromised or mistaken flag
+// document can't weaken them.
+var rolloutFlags = map[string]bool{
+	"COMPANY_MERGE_QUEUE":        true,
+	"COMPANY_NAME_NORMALIZE":     true,
+	"COMPANY_NAME_TITLE_CASE":    true,
+	"COMPANY_OPPORTUNITY_WINDOW": true,
+	"CONFIRMATION_NUMBERS":       true,
+	"CREATE_FOLLOWUP_TASK":       true,
+	"CRM_LEAD_MODE":              true,
+	"CRM_LINK_FOR_CC":            true,
+	"EMAIL_DEDUP_WINDOW":         true,
+	"INCLUDE_PRIOR_INQUIRIES":    true,
+	"NORMALIZE_NAME_CASE":        true,
+	"NOTIFICATION_VCARD":         true,
+	"OPPORTUNITY_REUSE_WINDOW":   true,
+	"PERSON_DUPLICATE_RETRY":     true,
+	"PERSON_PHONE_MATCH":         true,
+	"PHONE_COUNTRY_CHECK":        true,
+	"REOPEN_CLOSED_OPPORTUNITY":  true,
+	"SEND_AUTORESPONDER":         true,
+}
+
+// Lookup returns the override for an env key, if any
+func (f *featureFlags) Lookup(key string) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	v, ok := f.values[key]
+	return v, ok
+}
+
+// Set replaces all overrides
+func (f *featureFlags) Set(values map[string]string) {
+	f.mu.Lock()
+	f.values = values
+	f.mu.Unlock()
+}
+
+// flagValue returns the feature flag override for key, if key is one of the
+// rolloutFlags, falling back to the env var
+func flagValue(key string) string {
+	if !rolloutFlags[key] {
+		return os.Getenv(key)
+	}
+	if v, ok := flags.Lookup(key); ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// validateFeatureFlagsURL requires https for FEATURE_FLAGS_URL: the flag
+// document changes how leads are handled, so it must not be open to
+// tampering in transit
+func validateFeatureFlagsURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an https URL", raw)
+	}
+	return nil
+}
+
+// featureFlagsInterval returns FEATURE_FLAGS_INTERVAL (default 1m)
+func featureFlagsInterval() time.Duration {
+	return envDuration("FEATURE_FLAGS_INTERVAL", time.Minute)
+}
+
+// fetchFeatureFlags downloads the flag document: a JSON object keyed by env
+// var name, e.g. {"CRM_LEAD_MODE": true, "COMPANY_OPPORTUNITY_WINDOW": "72h"}.
+// Keys outside rolloutFlags are logged and dropped.
+func fetchFeatureFlags(flagsURL string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", flagsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var doc map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid flag document: %w", err)
+	}
+
+	values := make(map[string]string, len(doc))
+	for key, v := range doc {
+		if !rolloutFlags[key] {
+			logThrottled("Warning: Ignoring feature flag %q, which is not a rollout setting", key)
+			continue
+		}
+		switch v := v.(type) {
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("flag %q must be a boolean, string or number", key)
+		}
+	}
+	return values, nil
+}
+
+// runFeatureFlagPoller fetches the flag document now and then every
+// interval until stop is closed. A failed fetch keeps the last good flags.
+func runFeatureFlagPoller(f *featureFlags, flagsURL string, clock Clock, interval time.Duration, stop <-chan struct{}) {
+	for {
+		if values, err := fetchFeatureFlags(flagsURL); err != nil {
+			logThrottled("Warning: Failed to fetch feature flags, keeping the last ones: %v", err)
+		} else {
+			f.Set(values)
+		}
+
+		select {
+		case <-clock.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flagServer is a stub config service serving the documents queued by
+// serve, the last one repeating. A document of "" answers 500.
+type flagServer struct {
+	mu   sync.Mutex
+	docs []string
+	URL  string
+}
+
+func newFlagServer(t *testing.T, docs ...string) *flagServer {
+	t.Helper()
+	s := &flagServer{docs: docs}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		doc := s.docs[0]
+		if len(s.docs) > 1 {
+			s.docs = s.docs[1:]
+		}
+		s.mu.Unlock()
+
+		if doc == "" {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(doc))
+	}))
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL
+	return s
+}
+
+// useFlags replaces the package feature flags with overrides for the
+// duration of the test
+func useFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+	previous := flags
+	flags = &featureFlags{values: values}
+	t.Cleanup(func() { flags = previous })
+}
+
+func TestFetchFeatureFlags(t *testing.T) {
+	captureStandardLog(t)
+	srv := newFlagServer(t, `{"CRM_LEAD_MODE": true, "COMPANY_OPPORTUNITY_WINDOW": "72h", "ALLOW_INSECURE_CRM": true, "DAILY_SUBMISSION_CAP": 5}`)
+	values, err := fetchFeatureFlags(srv.URL)
+	if err != nil {
+		t.Fatalf("fetchFeatureFlags: %v", err)
+	}
+	// Only rollout settings are kept
+	want := map[string]string{"CRM_LEAD_MODE": "true", "COMPANY_OPPORTUNITY_WINDOW": "72h"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+
+	for _, doc := range []string{"", `not json`, `{"CRM_LEAD_MODE": ["true"]}`} {
+		if _, err := fetchFeatureFlags(newFlagServer(t, doc).URL); err == nil {
+			t.Errorf("fetchFeatureFlags of %q succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestRunFeatureFlagPoller(t *testing.T) {
+	captureStandardLog(t)
+	srv := newFlagServer(t,
+		`{"CRM_LEAD_MODE": true}`,
+		"",
+		`{"CRM_LEAD_MODE": false, "EMAIL_DEDUP_WINDOW": "1h"}`,
+	)
+	f := &featureFlags{}
+	clock := newFakeClock(testEpoch)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runFeatureFlagPoller(f, srv.URL, clock, time.Minute, stop)
+		close(done)
+	}()
+
+	// The first fetch happens right away
+	waitForWaiters(t, clock, 1)
+	if v, ok := f.Lookup("CRM_LEAD_MODE"); !ok || v != "true" {
+		t.Errorf("CRM_LEAD_MODE = %q, %v after the first poll, want true", v, ok)
+	}
+
+	// A failed fetch keeps the last good flags
+	clock.Advance(time.Minute)
+	waitForWaiters(t, clock, 1)
+	if v, ok := f.Lookup("CRM_LEAD_MODE"); !ok || v != "true" {
+		t.Errorf("CRM_LEAD_MODE = %q, %v after a failed poll, want true kept", v, ok)
+	}
+
+	// The next good document replaces them all
+	clock.Advance(time.Minute)
+	waitForWaiters(t, clock, 1)
+	if v, _ := f.Lookup("CRM_LEAD_MODE"); v != "false" {
+		t.Errorf("CRM_LEAD_MODE = %q after the third poll, want false", v)
+	}
+	if v, _ := f.Lookup("EMAIL_DEDUP_WINDOW"); v != "1h" {
+		t.Errorf("EMAIL_DEDUP_WINDOW = %q, want 1h", v)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("poller did not stop")
+	}
+}
+
+func TestFeatureFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("CRM_LEAD_MODE", "false")
+	t.Setenv("PERSON_DUPLICATE_RETRY", "")
+	t.Setenv("EMAIL_DEDUP_WINDOW", "10m")
+	useFlags(t, map[string]string{"CRM_LEAD_MODE": "true", "PERSON_DUPLICATE_RETRY": "false"})
+
+	if !envBool("CRM_LEAD_MODE") {
+		t.Error("envBool ignored the CRM_LEAD_MODE flag")
+	}
+	if envBoolDefault("PERSON_DUPLICATE_RETRY", true) {
+		t.Error("envBoolDefault ignored the PERSON_DUPLICATE_RETRY flag")
+	}
+
+	// Settings the document doesn't mention fall back to the env
+	if d := envDuration("EMAIL_DEDUP_WINDOW", time.Hour); d != 10*time.Minute {
+		t.Errorf("envDuration = %v, want the env's 10m", d)
+	}
+	if v := flagValue("EMAIL_DEDUP_WINDOW"); v != "10m" {
+		t.Errorf("flagValue = %q, want the env value", v)
+	}
+}
+
+func TestFeatureFlagsCannotOverrideSecurity(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "")
+	t.Setenv("MAILGUN_SANDBOX", "")
+	useFlags(t, map[string]string{"ALLOW_INSECURE_CRM": "true", "MAILGUN_SANDBOX": "true"})
+
+	for _, key := range []string{"ALLOW_INSECURE_CRM", "MAILGUN_SANDBOX"} {
+		if envBool(key) {
+			t.Errorf("a feature flag overrode %s", key)
+		}
+	}
+	if err := validateCRMURL("http://crm.example.com"); err == nil {
+		t.Error("a feature flag allowed an http CRM URL")
+	}
+}
+
+func TestValidateFeatureFlagsURL(t *testing.T) {
+	if err := validateFeatureFlagsURL("https://flags.example.com/sogos.json"); err != nil {
+		t.Errorf("validateFeatureFlagsURL of an https URL: %v", err)
+	}
+	for _, raw := range []string{"http://flags.example.com/sogos.json", "flags.example.com", "https://", "://bad"} {
+		if err := validateFeatureFlagsURL(raw); err == nil {
+			t.Errorf("validateFeatureFlagsURL(%q) succeeded, want an error", raw)
+		}
+	}
+}
+
+func TestCreateTwentyLeadFollowsFeatureFlag(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	t.Setenv("CRM_LEAD_MODE", "")
+	srv := newFlagServer(t, `{"CRM_LEAD_MODE": true}`)
+	useFlags(t, nil)
+
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+	if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if stub.count("CreateOpportunity") != 1 || stub.count("CreateLead") != 0 {
+		t.Fatalf("operations = %v, want an opportunity before the flag is set", stub.operations())
+	}
+
+	// Flipping the flag switches the next lead without a restart
+	values, err := fetchFeatureFlags(srv.URL)
+	if err != nil {
+		t.Fatalf("fetchFeatureFlags: %v", err)
+	}
+	flags.Set(values)
+	if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if stub.count("CreateOpportunity") != 1 || stub.count("CreateLead") != 1 {
+		t.Errorf("operations = %v, want a Lead once the flag is set", stub.operations())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// FormProfile bundles the settings for one kind of form served by the
+// contact endpoint (e.g. contact, demo request, partnership). Empty fields
+// fall back to the deployment-wide configuration.
+type FormProfile struct {
+	// Required lists extra fields (by JSON name) that must be non-empty
+	Required []string `json:"required"`
+	// Recipient overrides the notification address
+	Recipient string `json:"recipient"`
+	// Stage sets the opportunity stage instead of NEW
+	Stage string `json:"stage"`
+	// DescriptionTemplate overrides OPPORTUNITY_DESC_TEMPLATE
+	DescriptionTemplate string `json:"descriptionTemplate"`
+	// EmailSubject is a text/template over ContactRequest for the
+	// notification subject
+	EmailSubject string `json:"emailSubject"`
+}
+
+// parseFormProfiles parses FORM_PROFILES, a JSON object mapping form types
+// to profiles, and checks that required fields are known
+func parseFormProfiles(spec string) (map[string]FormProfile, error) {
+	profiles := make(map[string]FormProfile)
+	if strings.TrimSpace(spec) == "" {
+		return profiles, nil
+	}
+
+	if err := json.Unmarshal([]byte(spec), &profiles); err != nil {
+		return nil, err
+	}
+
+	known := transformableFields(&ContactRequest{})
+	for name, profile := range profiles {
+		for _, field := range profile.Required {
+			if _, ok := known[field]; !ok {
+				return nil, fmt.Errorf("profile %q requires unknown field %q", name, field)
+			}
+		}
+		if profile.EmailSubject != "" {
+			if _, err := template.New("subject").Parse(profile.EmailSubject); err != nil {
+				return nil, fmt.Errorf("profile %q has an invalid emailSubject: %w", name, err)
+			}
+		}
+	}
+
+	return profiles, nil
+}
+
+// lookupFormProfile returns the FORM_PROFILES entry for formType. An empty
+// form type selects the default profile (no overrides); an unknown one
+// reports false.
+func lookupFormProfile(cfg *Config, formType string) (FormProfile, bool) {
+	formType = strings.TrimSpace(formType)
+	if formType == "" {
+		return FormProfile{}, true
+	}
+
+	profile, ok := cfg.FormProfiles[formType]
+	return profile, ok
+}
+
+// missingRequiredFields returns the profile's required fields that are empty
+// in req, in sorted order
+func missingRequiredFields(req *ContactRequest, profile FormProfile) []string {
+	fields := transformableFields(req)
+	var missing []string
+	for _, field := range profile.Required {
+		if strings.TrimSpace(*fields[field]) == "" {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// notificationSubject renders the form profile's email subject, falling back
+// to the standard "New Lead" subject
+func notificationSubject(cfg *Config, req ContactRequest) string {
+	subject := fmt.Sprintf("🎯 New Lead: %s", req.Name)
+
+	profile, _ := lookupFormProfile(cfg, req.FormType)
+	if profile.EmailSubject == "" {
+		return subject
+	}
+
+	tmpl, err := template.New("subject").Parse(profile.EmailSubject)
+	if err != nil {
+		return subject
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, req); err != nil {
+		log.Printf("Warning: Failed to render email subject for form %q: %v", req.FormType, err)
+		return subject
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// twoFormProfiles configures a demo form and a partnership form
+const twoFormProfiles = `{
+	"demo": {
+		"required": ["company", "phone"],
+		"stage": "DEMO_REQUESTED",
+		"emailSubject": "Demo request: {{.Company}}",
+		"descriptionTemplate": "Demo for {{.Company}}: {{.Message}}"
+	},
+	"partner": {
+		"required": ["website"],
+		"recipient": "partners@sogos.io"
+	}
+}`
+
+// parsedFormProfiles returns twoFormProfiles as loadConfig would
+func parsedFormProfiles(t *testing.T) map[string]FormProfile {
+	t.Helper()
+	profiles, err := parseFormProfiles(twoFormProfiles)
+	if err != nil {
+		t.Fatalf("parseFormProfiles: %v", err)
+	}
+	return profiles
+}
+
+func TestFormProfiles(t *testing.T) {
+	cfg := &Config{FormProfiles: parsedFormProfiles(t)}
+
+	demo := ContactRequest{FormType: "demo", Name: "Jane Doe", Company: "Acme", Message: "Show me"}
+	partner := ContactRequest{FormType: "partner", Name: "John Roe", Company: "Globex", Message: "Let's team up"}
+
+	profile, ok := lookupFormProfile(cfg, "demo")
+	if !ok {
+		t.Fatal("demo profile not found")
+	}
+	if missing := missingRequiredFields(&demo, profile); !slices.Equal(missing, []string{"phone"}) {
+		t.Errorf("demo missing = %v, want [phone]", missing)
+	}
+	if got := initialOpportunityStage(cfg, demo); got != "DEMO_REQUESTED" {
+		t.Errorf("demo stage = %q", got)
+	}
+	if got := notificationSubject(cfg, demo); got != "Demo request: Acme" {
+		t.Errorf("demo subject = %q", got)
+	}
+	if got := renderOpportunityDescription(cfg, demo); got != "Demo for Acme: Show me" {
+		t.Errorf("demo description = %q", got)
+	}
+
+	profile, _ = lookupFormProfile(cfg, "partner")
+	if missing := missingRequiredFields(&partner, profile); !slices.Equal(missing, []string{"website"}) {
+		t.Errorf("partner missing = %v, want [website]", missing)
+	}
+	if got := initialOpportunityStage(cfg, partner); got != "NEW" {
+		t.Errorf("partner stage = %q, want the default", got)
+	}
+	if got := notificationSubject(cfg, partner); got != "🎯 New Lead: John Roe" {
+		t.Errorf("partner subject = %q, want the default", got)
+	}
+	if got := renderOpportunityDescription(cfg, partner); !strings.HasPrefix(got, "Let's team up") {
+		t.Errorf("partner description = %q, want the default template", got)
+	}
+	if profile.Recipient != "partners@sogos.io" {
+		t.Errorf("partner recipient = %q", profile.Recipient)
+	}
+}
+
+func TestFormProfileOpportunityStage(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	cfg.FormProfiles = parsedFormProfiles(t)
+
+	req := ContactRequest{FormType: "demo", Name: "Jane Doe", Email: "jane@example.com", Company: "Acme", Phone: "555-123-4567"}
+	if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if stage := stub.input("CreateOpportunity")["stage"]; stage != "DEMO_REQUESTED" {
+		t.Errorf("stage = %v, want DEMO_REQUESTED", stage)
+	}
+}
+
+func TestHandleContactFormProfiles(t *testing.T) {
+	useMemoryStore(t)
+	cfg := &Config{CRMMissingConfig: "unavailable", FormProfiles: parsedFormProfiles(t)}
+
+	tests := []struct {
+		body    string
+		want    int
+		message string
+	}{
+		{`{"formType":"demo","name":"Jane","email":"jane@example.com"}`, http.StatusBadRequest, "Missing required fields: company, phone"},
+		{`{"formType":"partner","name":"Jane","email":"jane@example.com"}`, http.StatusBadRequest, "Missing required fields: website"},
+		{`{"formType":"careers","name":"Jane","email":"jane@example.com"}`, http.StatusBadRequest, `Unknown form type "careers"`},
+	}
+	for _, tt := range tests {
+		w := postContact(cfg, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.body, w.Code, tt.want)
+		}
+		if resp := responseOf(t, w); resp.Message != tt.message {
+			t.Errorf("%s: message = %q, want %q", tt.body, resp.Message, tt.message)
+		}
+	}
+
+	// A complete submission gets past validation (to the 503 for the
+	// missing CRM)
+	w := postContact(cfg, `{"formType":"partner","name":"Jane","email":"jane@example.com","website":"acme.io"}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("complete partner form: status = %d, want 503", w.Code)
+	}
+}
+
+func TestParseFormProfiles(t *testing.T) {
+	if profiles, err := parseFormProfiles(twoFormProfiles); err != nil || len(profiles) != 2 {
+		t.Fatalf("parseFormProfiles = %v, %v", profiles, err)
+	}
+	for _, spec := range []string{`{"demo":{"required":["favoriteColor"]}}`, `{"demo":{"emailSubject":"{{.Name"}}`, `not json`} {
+		if _, err := parseFormProfiles(spec); err == nil {
+			t.Errorf("parseFormProfiles(%s) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoLocation is where a client IP resolves to
+type GeoLocation struct {
+	Country string // ISO 3166-1 alpha-2 code
+	Region  string // subdivision name, may be empty
+}
+
+// String renders the location as "Region, CC" (or just "CC")
+func (g *GeoLocation) String() string {
+	if g == nil {
+		return ""
+	}
+	if g.Region == "" {
+		return g.Country
+	}
+	return fmt.Sprintf("%s, %s", g.Region, g.Country)
+}
+
+// GeoLocator resolves IP addresses to locations
+type GeoLocator interface {
+	Lookup(ip net.IP) (*GeoLocation, error)
+}
+
+// geoLocator is nil when GeoIP lookups are disabled
+var geoLocator GeoLocator
+
+// maxMindLocator resolves locations from a MaxMind GeoIP2/GeoLite2 City database
+type maxMindLocator struct {
+	db *geoip2.Reader
+}
+
+func (m *maxMindLocator) Lookup(ip net.IP) (*GeoLocation, error) {
+	record, err := m.db.City(ip)
+	if err != nil {
+		return nil, err
+	}
+	if record.Country.IsoCode == "" {
+		return nil, fmt.Errorf("no location for %s", ip)
+	}
+
+	location := &GeoLocation{Country: record.Country.IsoCode}
+	if len(record.Subdivisions) > 0 {
+		location.Region = record.Subdivisions[0].Names["en"]
+	}
+	return location, nil
+}
+
+// initGeoIP opens the database at GEOIP_DB_PATH. A missing or unreadable
+// database leaves lookups disabled.
+func initGeoIP() {
+	path := os.Getenv("GEOIP_DB_PATH")
+	if path == "" {
+		return
+	}
+
+	db, err := geoip2.Open(path)
+	if err != nil {
+		log.Printf("Warning: GeoIP disabled, failed to open %s: %v", path, err)
+		return
+	}
+	geoLocator = &maxMindLocator{db: db}
+}
+
+// clientIP returns the originating client IP. Entries on the left of
+// X-Forwarded-For are whatever the client sent, so the address is read
+// TRUSTED_PROXY_HOPS entries from the right, where our own proxies append
+// it. Zero hops (the default) ignores the header and uses RemoteAddr, as
+// does a header without a usable entry.
+func clientIP(cfg *Config, r *http.Request) string {
+	if hops := cfg.TrustedProxyHops; hops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		if len(entries) > 0 {
+			ip := entries[max(len(entries)-hops, 0)]
+			if net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// lookupLocation resolves the request's client IP, returning nil when GeoIP
+// is disabled or the lookup fails
+func lookupLocation(cfg *Config, r *http.Request) *GeoLocation {
+	if geoLocator == nil {
+		return nil
+	}
+	ip := net.ParseIP(clientIP(cfg, r))
+	if ip == nil {
+		return nil
+	}
+	location, err := geoLocator.Lookup(ip)
+	if err != nil {
+		return nil
+	}
+	return location
+}
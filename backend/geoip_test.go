@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubLocator resolves the IPs in its map and fails for any other
+type stubLocator map[string]*GeoLocation
+
+func (s stubLocator) Lookup(ip net.IP) (*GeoLocation, error) {
+	if location, ok := s[ip.String()]; ok {
+		return location, nil
+	}
+	return nil, errors.New("address not found")
+}
+
+// useGeoLocator replaces geoLocator for the duration of the test
+func useGeoLocator(t *testing.T, locator GeoLocator) {
+	t.Helper()
+	previous := geoLocator
+	geoLocator = locator
+	t.Cleanup(func() { geoLocator = previous })
+}
+
+func TestLookupLocation(t *testing.T) {
+	cfg := &Config{TrustedProxyHops: 1}
+	useGeoLocator(t, stubLocator{
+		"81.2.69.142": {Country: "GB", Region: "England"},
+		"192.0.2.1":   {Country: "US"},
+	})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"known forwarded IP", "10.0.0.1:1234", "81.2.69.142", "England, GB"},
+		{"spoofed entries are ignored", "10.0.0.1:1234", "192.0.2.1, 81.2.69.142", "England, GB"},
+		{"remote address fallback", "192.0.2.1:1234", "", "US"},
+		{"unknown IP", "10.0.0.1:1234", "198.51.100.7", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/contact", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if got := lookupLocation(cfg, r).String(); got != tt.want {
+			t.Errorf("%s: location = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLookupLocationDisabled(t *testing.T) {
+	useGeoLocator(t, nil)
+
+	r := httptest.NewRequest("POST", "/api/contact", nil)
+	if location := lookupLocation(&Config{}, r); location != nil {
+		t.Errorf("location = %v, want nil with GeoIP disabled", location)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		hops         int
+		forwardedFor string
+		want         string
+	}{
+		{0, "81.2.69.142", "192.0.2.1"},
+		{1, "81.2.69.142", "81.2.69.142"},
+		{1, "1.1.1.1, 81.2.69.142", "81.2.69.142"},
+		{2, "1.1.1.1, 81.2.69.142", "1.1.1.1"},
+		{3, "81.2.69.142", "81.2.69.142"},
+		{1, "not-an-ip", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/contact", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		if got := clientIP(&Config{TrustedProxyHops: tt.hops}, r); got != tt.want {
+			t.Errorf("clientIP with %d hops and %q = %q, want %q", tt.hops, tt.forwardedFor, got, tt.want)
+		}
+	}
+}
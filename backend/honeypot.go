@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// validateHoneypotField rejects a HONEYPOT_FIELD that names a real
+// ContactRequest field (such as "website"), which would drop genuine leads
+func validateHoneypotField(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	t := reflect.TypeOf(ContactRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag != "-" && strings.EqualFold(tag, name) {
+			return fmt.Errorf("HONEYPOT_FIELD %q is a contact form field", name)
+		}
+	}
+	return nil
+}
+
+// checkHoneypot looks for the honeypot field name (HONEYPOT_FIELD, disabled
+// when empty) in a JSON object body. The name can be rotated whenever bots
+// learn to skip it, as long as the form is updated too. It
+// reports whether the field was filled in, and returns the body with the
+// field removed so strict decoding doesn't reject it as unknown. Field names
+// match case-insensitively, like encoding/json. Bodies that aren't a JSON
+// object are returned unchanged for the decoder to reject.
+func checkHoneypot(name string, raw []byte) ([]byte, bool) {
+	if name == "" {
+		return raw, false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return raw, false
+	}
+
+	found, filled := false, false
+	for key, value := range fields {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		found = true
+		switch strings.TrimSpace(string(value)) {
+		case `""`, "null", "false":
+		default:
+			filled = true
+		}
+		delete(fields, key)
+	}
+	if !found {
+		return raw, false
+	}
+
+	stripped, err := json.Marshal(fields)
+	if err != nil {
+		return raw, filled
+	}
+	return stripped, filled
+}
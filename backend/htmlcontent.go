@@ -0,0 +1,54 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// scriptLikePattern matches markup that executes code when rendered: script
+// and embedding tags, inline event handlers and javascript: URLs
+var scriptLikePattern = regexp.MustCompile(`(?i)<\s*(script|iframe|object|embed|svg)\b|\bon[a-z]+\s*=|javascript\s*:`)
+
+// htmlBlockPattern matches elements whose content is never meant to be read
+var htmlBlockPattern = regexp.MustCompile(`(?is)<\s*(script|style)\b[^>]*>.*?<\s*/\s*(script|style)\s*>`)
+
+// htmlLineBreakPattern matches tags that end a line of text
+var htmlLineBreakPattern = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/tr|/h[1-6])\b[^<>]*>`)
+
+// htmlTagPattern matches an HTML tag or comment (but not a bare "<" in text
+// like "a < b")
+var htmlTagPattern = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z][^<>]*>`)
+
+// containsScriptLikeContent reports whether s contains markup that could run
+// script if rendered as HTML
+func containsScriptLikeContent(s string) bool {
+	return scriptLikePattern.MatchString(s)
+}
+
+// htmlToPlainText strips HTML from s: script and style blocks are dropped
+// along with their content, line-ending tags become newlines, other tags are
+// removed, and entities decoded.
+// Text without tags is returned unchanged.
+func htmlToPlainText(s string) string {
+	if !htmlTagPattern.MatchString(s) {
+		return s
+	}
+	s = htmlBlockPattern.ReplaceAllString(s, "")
+	s = htmlLineBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// sanitizeMessageMarkup converts an HTML message to plain text, unless
+// MESSAGE_HTML=keep, so pasted markup is never stored raw in the CRM or
+// rendered in emails. When FLAG_SCRIPT_CONTENT is set, messages that
+// contained script-like content are flagged on the request.
+func sanitizeMessageMarkup(cfg *Config, req *ContactRequest) {
+	if envBool("FLAG_SCRIPT_CONTENT") && containsScriptLikeContent(req.Message) {
+		req.ScriptContent = true
+	}
+	if cfg.MessageHTML != "keep" {
+		req.Message = htmlToPlainText(req.Message)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	scriptPayload = `Hi <script>alert(document.cookie)</script>there`
+	imgPayload    = `<p>Check this</p><img src=x onerror="alert(1)">`
+)
+
+func TestContainsScriptLikeContent(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{scriptPayload, true},
+		{imgPayload, true},
+		{`< SCRIPT src="https://evil.example/x.js">`, true},
+		{`<a href="javascript:alert(1)">click</a>`, true},
+		{`<iframe src="https://evil.example"></iframe>`, true},
+		{`<b>Bold</b> and <i>italic</i>`, false},
+		{"We need a new logo, budget < $5k", false},
+		{"Our money = online sales", false},
+	}
+	for _, tt := range tests {
+		if got := containsScriptLikeContent(tt.message); got != tt.want {
+			t.Errorf("containsScriptLikeContent(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestHTMLToPlainText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{scriptPayload, "Hi there"},
+		{imgPayload, "Check this"},
+		{"<p>First</p><p>Second &amp; third</p>", "First\nSecond & third"},
+		{"Line one<br>Line two<!-- hidden -->", "Line one\nLine two"},
+		{"<style>p { color: red }</style>Hello", "Hello"},
+		{"Budget < $5k & soon", "Budget < $5k & soon"},
+	}
+	for _, tt := range tests {
+		if got := htmlToPlainText(tt.in); got != tt.want {
+			t.Errorf("htmlToPlainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeMessageMarkup(t *testing.T) {
+	t.Setenv("FLAG_SCRIPT_CONTENT", "true")
+	cfg := &Config{}
+
+	for _, payload := range []string{scriptPayload, imgPayload} {
+		req := ContactRequest{Message: payload}
+		sanitizeMessageMarkup(cfg, &req)
+		if !req.ScriptContent {
+			t.Errorf("%q not flagged", payload)
+		}
+		if strings.ContainsAny(req.Message, "<>") {
+			t.Errorf("message = %q, want plain text", req.Message)
+		}
+	}
+
+	req := ContactRequest{Message: "<b>Hello</b>"}
+	sanitizeMessageMarkup(cfg, &req)
+	if req.ScriptContent || req.Message != "Hello" {
+		t.Errorf("req = %+v, want plain text without a flag", req)
+	}
+
+	// Flagging is opt-in, and MESSAGE_HTML=keep leaves the markup alone
+	t.Setenv("FLAG_SCRIPT_CONTENT", "")
+	cfg.MessageHTML = "keep"
+	req = ContactRequest{Message: scriptPayload}
+	sanitizeMessageMarkup(cfg, &req)
+	if req.ScriptContent || req.Message != scriptPayload {
+		t.Errorf("req = %+v, want the message kept unflagged", req)
+	}
+}
+
+func TestNotificationHTMLEscapesMarkup(t *testing.T) {
+	cfg := &Config{TwentyAPIURL: "https://crm.example.com"}
+	for _, payload := range []string{scriptPayload, imgPayload} {
+		req := ContactRequest{Name: `Jane <img src=x onerror=alert(1)>`, Email: "jane@example.com", Message: payload, ScriptContent: true}
+		out := buildNotificationHTML(cfg, req, nil, false)
+		if out == "" {
+			t.Fatal("buildNotificationHTML rendered nothing")
+		}
+		if strings.Contains(out, "<script") || strings.Contains(out, "<img") {
+			t.Errorf("HTML email contains raw markup:\n%s", out)
+		}
+		if !strings.Contains(out, "&lt;") {
+			t.Errorf("HTML email lacks the escaped markup:\n%s", out)
+		}
+		if !strings.Contains(out, "Flagged: the message contained script-like content") {
+			t.Errorf("HTML email lacks the script flag:\n%s", out)
+		}
+	}
+}
+
+func TestHandleContactStoresPlainTextNote(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+	t.Setenv("FLAG_SCRIPT_CONTENT", "true")
+	out := captureStandardLog(t)
+
+	body := `{"name":"Jane Doe","email":"jane@example.com","message":"<p>Need a site</p><img src=x onerror=\"alert(1)\"><script>alert(2)</script>"}`
+	if w := postContact(cfg, body); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if note := stub.noteBody(); !strings.Contains(note, "Need a site") || strings.ContainsAny(note, "<>") {
+		t.Errorf("note = %q, want the message as plain text", note)
+	}
+	if !strings.Contains(out.String(), "contained script-like content") {
+		t.Errorf("log = %q, want the script content flagged", out.String())
+	}
+}
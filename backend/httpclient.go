@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// twentyHTTPClient is shared by every Twenty request (GraphQL and REST) so
+// connections to the CRM are pooled and reused instead of opened per call.
+// It is built once, from the environment at startup.
+var twentyHTTPClient = newTwentyHTTPClient()
+
+// newTwentyHTTPClient builds the Twenty client. TWENTY_MAX_IDLE_CONNS
+// (default 100) caps the pooled keep-alive connections, which all go to
+// the one CRM host, and TWENTY_IDLE_CONN_TIMEOUT (default 90s) closes
+// unused ones. TWENTY_HTTP_TIMEOUT (default 60s) bounds any single attempt,
+// on top of the per-call context timeouts.
+func newTwentyHTTPClient() *http.Client {
+	maxIdle := 100
+	if n, err := strconv.Atoi(os.Getenv("TWENTY_MAX_IDLE_CONNS")); err == nil && n > 0 {
+		maxIdle = n
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdle
+	transport.MaxIdleConnsPerHost = maxIdle
+	transport.IdleConnTimeout = envDuration("TWENTY_IDLE_CONN_TIMEOUT", 90*time.Second)
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   envDuration("TWENTY_HTTP_TIMEOUT", 60*time.Second),
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyMaxLen bounds the Idempotency-Key header we accept
+const idempotencyKeyMaxLen = 255
+
+// idempotencyEntry is the response recorded for one Idempotency-Key. Until
+// the first request finishes the entry is pending and has no response.
+type idempotencyEntry struct {
+	pending     bool
+	fingerprint string
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyCache remembers contact responses by client and
+// Idempotency-Key so a resubmitted form (a double click, a retry on a flaky
+// connection) gets the original response instead of creating a second lead.
+// Entries live in memory for IDEMPOTENCY_TTL and are swept by the janitor;
+// at most IDEMPOTENCY_MAX_KEYS are kept.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	clock   Clock
+	entries map[string]*idempotencyEntry
+}
+
+var idempotencyKeys = &idempotencyCache{clock: systemClock, entries: make(map[string]*idempotencyEntry)}
+
+// idempotencyTTL returns IDEMPOTENCY_TTL, how long a key's response is
+// replayed (default 24h)
+func idempotencyTTL() time.Duration {
+	return envDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+}
+
+// idempotencyMaxKeys returns IDEMPOTENCY_MAX_KEYS, the most keys kept at
+// once (default 10000)
+func idempotencyMaxKeys(cfg *Config) int {
+	if cfg.IdempotencyMaxKeys > 0 {
+		return cfg.IdempotencyMaxKeys
+	}
+	return 10000
+}
+
+// Begin claims key for a new request with the given body fingerprint,
+// returning nil, or returns the existing entry if the key was already seen
+// and hasn't expired. When the cache is full the entry closest to expiry is
+// evicted to make room; if every entry is still pending, ok is false and
+// the key is not recorded.
+func (c *idempotencyCache) Begin(key, fingerprint string, ttl time.Duration, maxKeys int) (existing *idempotencyEntry, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	if entry, found := c.entries[key]; found {
+		if now.Before(entry.expires) {
+			copied := *entry
+			return &copied, true
+		}
+		delete(c.entries, key)
+	}
+
+	if len(c.entries) >= maxKeys && !c.evictOne() {
+		return nil, false
+	}
+	c.entries[key] = &idempotencyEntry{pending: true, fingerprint: fingerprint, expires: now.Add(ttl)}
+	return nil, true
+}
+
+// evictOne removes the finished entry closest to expiry, reporting whether
+// there was one. Callers must hold c.mu.
+func (c *idempotencyCache) evictOne() bool {
+	victim := ""
+	var earliest time.Time
+	for k, entry := range c.entries {
+		if entry.pending {
+			continue
+		}
+		if victim == "" || entry.expires.Before(earliest) {
+			victim, earliest = k, entry.expires
+		}
+	}
+	if victim == "" {
+		return false
+	}
+	delete(c.entries, victim)
+	return true
+}
+
+// Finish records the response for a claimed key
+func (c *idempotencyCache) Finish(key string, status int, contentType string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.pending = false
+		entry.status = status
+		entry.contentType = contentType
+		entry.body = body
+	}
+}
+
+// Release forgets a claimed key so the request can be retried with it
+func (c *idempotencyCache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Sweep drops expired entries, returning how many were removed
+func (c *idempotencyCache) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	removed := 0
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of keys held, including expired ones not yet swept
+func (c *idempotencyCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// idempotencyFingerprint returns the SHA-256 of a request body, so a key
+// reused for a different submission can be told apart from a resubmission
+func idempotencyFingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder passes a response through while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent replays the recorded response when a client repeats an
+// Idempotency-Key header with the same body, without running next again.
+// Keys are scoped to the client IP, so one client can't replay another's
+// response. Only successful responses are kept: a rejected or failed
+// submission releases its key so the corrected form can be sent with it. A
+// repeat that arrives while the first request is still running gets 409,
+// and a key reused with a different body gets 422. Requests without the
+// header pass straight through.
+func idempotent(cfg *Config, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+		if len(key) > idempotencyKeyMaxLen {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Idempotency-Key is too long",
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		// Oversized bodies pass through for the handler to reject
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes(cfg)+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil || int64(len(body)) > maxBodyBytes(cfg) {
+			next(w, r)
+			return
+		}
+		fingerprint := idempotencyFingerprint(body)
+
+		scoped := clientIP(cfg, r) + "|" + key
+		entry, ok := idempotencyKeys.Begin(scoped, fingerprint, idempotencyTTL(), idempotencyMaxKeys(cfg))
+		if !ok {
+			logThrottled("Warning: Idempotency cache full, not recording key %q", key)
+			next(w, r)
+			return
+		}
+		if entry != nil {
+			if entry.fingerprint != fingerprint {
+				logThrottled("Rejected reuse of Idempotency-Key %q with a different body", key)
+				sendResponse(w, r, http.StatusUnprocessableEntity, Response{
+					Success: false,
+					Message: "Idempotency-Key was already used for a different submission",
+					Code:    codeValidationError,
+				})
+				return
+			}
+
+			suppressions.Record(dedupIdempotency)
+			if entry.pending {
+				logThrottled("Rejected concurrent request for Idempotency-Key %q", key)
+				sendResponse(w, r, http.StatusConflict, Response{
+					Success: false,
+					Message: "This submission is already being processed",
+				})
+				return
+			}
+
+			logThrottled("Replayed response for Idempotency-Key %q", key)
+			w.Header().Set("Content-Type", entry.contentType)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.status >= 200 && rec.status < 300 {
+			idempotencyKeys.Finish(scoped, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		} else {
+			idempotencyKeys.Release(scoped)
+		}
+	}
+}
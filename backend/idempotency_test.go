@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useIdempotencyCache replaces the package idempotency cache with an empty
+// one on a fake clock for the duration of the test
+func useIdempotencyCache(t *testing.T) (*idempotencyCache, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock(testEpoch)
+	cache := &idempotencyCache{clock: clock, entries: make(map[string]*idempotencyEntry)}
+	previous := idempotencyKeys
+	idempotencyKeys = cache
+	t.Cleanup(func() { idempotencyKeys = previous })
+	useSuppressions(t, clock)
+	return cache, clock
+}
+
+// countingHandler answers with status and counts its calls, checking that
+// the body still reaches it after the middleware read it
+func countingHandler(t *testing.T, status int, calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		body, _ := io.ReadAll(r.Body)
+		if len(body) == 0 {
+			t.Error("handler got an empty body")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(*calls) + `}`))
+	}
+}
+
+func idempotentRequest(key, remoteAddr, body string) *http.Request {
+	r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(body))
+	r.RemoteAddr = remoteAddr
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	return r
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	useIdempotencyCache(t)
+	calls := 0
+	handler := idempotent(&Config{}, countingHandler(t, http.StatusOK, &calls))
+
+	first := httptest.NewRecorder()
+	handler(first, idempotentRequest("k1", "192.0.2.1:1000", `{"a":1}`))
+
+	second := httptest.NewRecorder()
+	handler(second, idempotentRequest("k1", "192.0.2.1:2000", `{"a":1}`))
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if second.Body.String() != first.Body.String() || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("second response = %q (replayed %q), want the first replayed", second.Body.String(), second.Header().Get("Idempotent-Replayed"))
+	}
+	if got := suppressions.Counts(time.Hour)[dedupIdempotency]; got != 1 {
+		t.Errorf("idempotency suppressions = %d, want 1", got)
+	}
+}
+
+func TestIdempotentDifferentBody(t *testing.T) {
+	useIdempotencyCache(t)
+	calls := 0
+	handler := idempotent(&Config{}, countingHandler(t, http.StatusOK, &calls))
+
+	handler(httptest.NewRecorder(), idempotentRequest("k1", "192.0.2.1:1000", `{"a":1}`))
+	w := httptest.NewRecorder()
+	handler(w, idempotentRequest("k1", "192.0.2.1:1000", `{"a":2}`))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", w.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotentScopedPerClient(t *testing.T) {
+	useIdempotencyCache(t)
+	calls := 0
+	handler := idempotent(&Config{}, countingHandler(t, http.StatusOK, &calls))
+
+	handler(httptest.NewRecorder(), idempotentRequest("k1", "192.0.2.1:1000", `{"a":1}`))
+	w := httptest.NewRecorder()
+	handler(w, idempotentRequest("k1", "198.51.100.7:1000", `{"a":1}`))
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2 (keys are per client)", calls)
+	}
+	if w.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("another client's response was replayed")
+	}
+}
+
+func TestIdempotentFailureReleasesKey(t *testing.T) {
+	useIdempotencyCache(t)
+	calls := 0
+	handler := idempotent(&Config{}, countingHandler(t, http.StatusBadRequest, &calls))
+
+	handler(httptest.NewRecorder(), idempotentRequest("k1", "192.0.2.1:1000", `{"a":1}`))
+	handler(httptest.NewRecorder(), idempotentRequest("k1", "192.0.2.1:1000", `{"a":2}`))
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2 (failed requests release the key)", calls)
+	}
+}
+
+func TestIdempotentNoHeader(t *testing.T) {
+	cache, _ := useIdempotencyCache(t)
+	calls := 0
+	handler := idempotent(&Config{}, countingHandler(t, http.StatusOK, &calls))
+
+	handler(httptest.NewRecorder(), idempotentRequest("", "192.0.2.1:1000", `{"a":1}`))
+	handler(httptest.NewRecorder(), idempotentRequest("", "192.0.2.1:1000", `{"a":1}`))
+
+	if calls != 2 || cache.Len() != 0 {
+		t.Errorf("calls = %d, keys = %d; want 2 calls and nothing recorded", calls, cache.Len())
+	}
+}
+
+func TestIdempotencyCachePending(t *testing.T) {
+	cache, _ := useIdempotencyCache(t)
+
+	if entry, ok := cache.Begin("k", "fp", time.Hour, 10); entry != nil || !ok {
+		t.Fatalf("first Begin = %v, %v; want nil, true", entry, ok)
+	}
+	entry, _ := cache.Begin("k", "fp", time.Hour, 10)
+	if entry == nil || !entry.pending {
+		t.Errorf("second Begin = %+v, want the pending entry", entry)
+	}
+}
+
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	cache, clock := useIdempotencyCache(t)
+
+	cache.Begin("k", "fp", time.Hour, 10)
+	cache.Finish("k", http.StatusOK, "application/json", []byte("{}"))
+
+	clock.Advance(time.Hour)
+	if entry, _ := cache.Begin("k", "fp", time.Hour, 10); entry != nil {
+		t.Error("expired entry was replayed")
+	}
+
+	cache.Begin("other", "fp", time.Minute, 10)
+	clock.Advance(time.Minute)
+	if removed := cache.Sweep(); removed != 1 || cache.Len() != 1 {
+		t.Errorf("Sweep removed %d, left %d; want 1 and 1", removed, cache.Len())
+	}
+}
+
+func TestIdempotencyCacheCap(t *testing.T) {
+	cache, clock := useIdempotencyCache(t)
+
+	cache.Begin("a", "fp", time.Hour, 2)
+	cache.Finish("a", http.StatusOK, "", nil)
+	clock.Advance(time.Minute)
+	cache.Begin("b", "fp", time.Hour, 2)
+	cache.Finish("b", http.StatusOK, "", nil)
+
+	// The entry closest to expiry makes room
+	if _, ok := cache.Begin("c", "fp", time.Hour, 2); !ok {
+		t.Fatal("Begin refused a key with finished entries to evict")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+	if entry, _ := cache.Begin("a", "fp", time.Hour, 3); entry != nil {
+		t.Error("the oldest entry was not evicted")
+	}
+
+	// Pending entries are never evicted
+	full := &idempotencyCache{clock: clock, entries: make(map[string]*idempotencyEntry)}
+	full.Begin("x", "fp", time.Hour, 1)
+	if _, ok := full.Begin("y", "fp", time.Hour, 1); ok {
+		t.Error("Begin evicted a pending entry")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// jsonLogs reports whether LOG_FORMAT=json selects structured JSON logs
+// instead of the default text lines
+func jsonLogs() bool {
+	return strings.ToLower(os.Getenv("LOG_FORMAT")) == "json"
+}
+
+// initLogging routes the standard logger through a JSON handler when
+// LOG_FORMAT=json. Plain log.Printf lines become records with just a
+// message; the lead-handling paths add fields through logEvent. LOG_PREFIX
+// tags every line so aggregated logs can be filtered by service: as a text
+// prefix, or as a "service" attribute on JSON records.
+func initLogging() {
+	prefix := os.Getenv("LOG_PREFIX")
+	if !jsonLogs() {
+		if prefix != "" {
+			log.SetPrefix(prefix + " ")
+		}
+		return
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	if prefix != "" {
+		logger = logger.With("service", prefix)
+	}
+	slog.SetDefault(logger)
+}
+
+// leadLogFields returns the structured fields describing a lead: its email,
+// the CRM record ID once known, and the error if there was one
+func leadLogFields(email string, lead *LeadResult, err error) []any {
+	fields := []any{"email", email}
+	if lead != nil && lead.OpportunityID != "" {
+		fields = append(fields, "lead_id", lead.OpportunityID)
+	} else if lead != nil && lead.LeadID != "" {
+		fields = append(fields, "lead_id", lead.LeadID)
+	}
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+	return fields
+}
+
+// logEvent logs like log.Printf in text mode. In JSON mode it logs the
+// message with the event name and key/value fields as attributes, at warn
+// level when the fields include an error.
+func logEvent(event string, fields []any, format string, args ...interface{}) {
+	if !jsonLogs() {
+		log.Printf(format, args...)
+		return
+	}
+	emitEvent(event, fields, fmt.Sprintf(format, args...))
+}
+
+// logThrottledEvent is logEvent with the repeat suppression of logThrottled
+func logThrottledEvent(event string, fields []any, format string, args ...interface{}) {
+	if !jsonLogs() {
+		logThrottled(format, args...)
+		return
+	}
+	logThrottler.printf(func(format string, args ...interface{}) {
+		emitEvent(event, fields, fmt.Sprintf(format, args...))
+	}, format, args...)
+}
+
+// emitEvent writes one structured record
+func emitEvent(event string, fields []any, msg string) {
+	level := slog.LevelInfo
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "error" {
+			level = slog.LevelWarn
+		}
+	}
+	slog.Log(context.Background(), level, msg, append([]any{"event", event}, fields...)...)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLogs runs initLogging and returns everything logged by fn, in
+// text or JSON form, restoring the loggers afterwards
+func captureLogs(t *testing.T, fn func()) string {
+	t.Helper()
+	previousSlog := slog.Default()
+	previousWriter, previousPrefix, previousFlags := log.Writer(), log.Prefix(), log.Flags()
+	previousStderr := os.Stderr
+	defer func() {
+		os.Stderr = previousStderr
+		slog.SetDefault(previousSlog)
+		log.SetOutput(previousWriter)
+		log.SetPrefix(previousPrefix)
+		log.SetFlags(previousFlags)
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = w
+	log.SetOutput(w)
+
+	initLogging()
+	fn()
+	w.Close()
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	return buf.String()
+}
+
+func TestLogPrefixText(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "")
+	t.Setenv("LOG_PREFIX", "[contact-api]")
+
+	out := captureLogs(t, func() {
+		log.Printf("plain line")
+		logEvent("lead_created", leadLogFields("jane@example.com", nil, nil), "event line")
+	})
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), out)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "[contact-api] ") {
+			t.Errorf("line %q lacks the prefix", line)
+		}
+	}
+}
+
+func TestLogPrefixJSON(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_PREFIX", "contact-api")
+
+	out := captureLogs(t, func() {
+		log.Printf("plain line")
+		logEvent("lead_created", leadLogFields("jane@example.com", nil, nil), "event line")
+	})
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), out)
+	}
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		if record["service"] != "contact-api" {
+			t.Errorf("record %v lacks service=contact-api", record)
+		}
+	}
+}
+
+func TestLogWithoutPrefix(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "")
+	t.Setenv("LOG_PREFIX", "")
+
+	out := captureLogs(t, func() { log.Printf("plain line") })
+	if strings.Contains(out, "[") {
+		t.Errorf("unexpected prefix in %q", out)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// throttledEntry tracks one repetitive log message
+type throttledEntry struct {
+	lastLogged time.Time
+	suppressed int
+}
+
+// logThrottle collapses repeats of the same message, keyed by its format
+// string, so an outage logs one line per interval instead of one per request
+type logThrottle struct {
+	mu       sync.Mutex
+	clock    Clock
+	interval time.Duration
+	entries  map[string]*throttledEntry
+	logf     func(format string, args ...interface{})
+}
+
+func newLogThrottle(clock Clock, interval time.Duration, logf func(string, ...interface{})) *logThrottle {
+	return &logThrottle{
+		clock:    clock,
+		interval: interval,
+		entries:  make(map[string]*throttledEntry),
+		logf:     logf,
+	}
+}
+
+// logThrottler is used by logThrottled. It logs everything until main
+// applies LOG_THROTTLE_INTERVAL.
+var logThrottler = newLogThrottle(systemClock, 0, log.Printf)
+
+// logThrottleInterval returns LOG_THROTTLE_INTERVAL; zero (default) logs
+// every occurrence
+func logThrottleInterval() time.Duration {
+	return envDuration("LOG_THROTTLE_INTERVAL", 0)
+}
+
+// runLogThrottleFlusher flushes suppressed counts every interval until stop
+// is closed
+func runLogThrottleFlusher(t *logThrottle, interval time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-t.clock.After(interval):
+			t.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// logThrottled logs like log.Printf, but for use on hot paths whose
+// messages repeat during an outage: repeats of the same format within the
+// interval are counted instead of logged
+func logThrottled(format string, args ...interface{}) {
+	logThrottler.Printf(format, args...)
+}
+
+// Printf logs the message if its format hasn't been logged within the
+// interval, noting how many repeats were suppressed since
+func (t *logThrottle) Printf(format string, args ...interface{}) {
+	t.printf(t.logf, format, args...)
+}
+
+// printf is Printf writing through logf instead of the throttle's own
+func (t *logThrottle) printf(logf func(string, ...interface{}), format string, args ...interface{}) {
+	if t.interval <= 0 {
+		logf(format, args...)
+		return
+	}
+
+	t.mu.Lock()
+	now := t.clock.Now()
+	entry, ok := t.entries[format]
+	if ok && now.Sub(entry.lastLogged) < t.interval {
+		entry.suppressed++
+		t.mu.Unlock()
+		return
+	}
+
+	suppressed := 0
+	if ok {
+		suppressed = entry.suppressed
+	}
+	t.entries[format] = &throttledEntry{lastLogged: now}
+	t.mu.Unlock()
+
+	if suppressed > 0 {
+		logf("%s (repeated %d more %s since last logged)", fmt.Sprintf(format, args...), suppressed, pluralize(suppressed, "time", "times"))
+		return
+	}
+	logf(format, args...)
+}
+
+// Flush logs the count of every message with suppressed repeats and forgets
+// messages that have gone quiet
+func (t *logThrottle) Flush() {
+	t.mu.Lock()
+	type pending struct {
+		format string
+		count  int
+	}
+	var flushed []pending
+	now := t.clock.Now()
+	for format, entry := range t.entries {
+		if entry.suppressed > 0 {
+			flushed = append(flushed, pending{format, entry.suppressed})
+			entry.suppressed = 0
+			entry.lastLogged = now
+		} else if now.Sub(entry.lastLogged) >= t.interval {
+			delete(t.entries, format)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, p := range flushed {
+		t.logf("Suppressed %d repeated %s of: %q", p.count, pluralize(p.count, "log", "logs"), p.format)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logLines records what a logThrottle writes
+type logLines struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logLines) logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *logLines) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestLogThrottleCollapsesRepeats(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	out := &logLines{}
+	throttle := newLogThrottle(clock, time.Minute, out.logf)
+
+	for i := 0; i < 5; i++ {
+		throttle.Printf("Warning: Twenty unavailable: %v", fmt.Sprintf("attempt %d", i))
+	}
+	throttle.Printf("Lead created for %s", "jane@example.com")
+	throttle.Printf("Lead created for %s", "john@example.com")
+
+	want := []string{
+		"Warning: Twenty unavailable: attempt 0",
+		"Lead created for jane@example.com",
+	}
+	if got := out.get(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+
+	// The next occurrence after the interval carries the count
+	clock.Advance(time.Minute)
+	throttle.Printf("Warning: Twenty unavailable: %v", "attempt 5")
+	got := out.get()
+	if last := got[len(got)-1]; last != "Warning: Twenty unavailable: attempt 5 (repeated 4 more times since last logged)" {
+		t.Errorf("line = %q, want the repeat count", last)
+	}
+}
+
+func TestLogThrottleFlush(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	out := &logLines{}
+	throttle := newLogThrottle(clock, time.Minute, out.logf)
+
+	throttle.Printf("Warning: Twenty unavailable")
+	throttle.Printf("Warning: Twenty unavailable")
+	throttle.Printf("Warning: Twenty unavailable")
+	throttle.Printf("Quiet message")
+
+	throttle.Flush()
+	got := out.get()
+	if len(got) != 3 || got[2] != `Suppressed 2 repeated logs of: "Warning: Twenty unavailable"` {
+		t.Fatalf("lines = %q, want the suppressed count flushed", got)
+	}
+
+	// Flushed counts aren't repeated, and quiet messages are forgotten
+	clock.Advance(time.Minute)
+	throttle.Flush()
+	if n := len(out.get()); n != 3 {
+		t.Errorf("second flush logged %d lines", n-3)
+	}
+	if len(throttle.entries) != 0 {
+		t.Errorf("entries = %v, want messages quiet for an interval forgotten", throttle.entries)
+	}
+	throttle.Printf("Quiet message")
+	if got := out.get(); got[len(got)-1] != "Quiet message" {
+		t.Errorf("line = %q, want a forgotten message logged plainly", got[len(got)-1])
+	}
+}
+
+func TestLogThrottleDisabled(t *testing.T) {
+	out := &logLines{}
+	throttle := newLogThrottle(newFakeClock(testEpoch), 0, out.logf)
+	for i := 0; i < 3; i++ {
+		throttle.Printf("Warning: Twenty unavailable")
+	}
+	if n := len(out.get()); n != 3 {
+		t.Errorf("logged %d lines, want every occurrence", n)
+	}
+}
+
+func TestRunLogThrottleFlusher(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	out := &logLines{}
+	throttle := newLogThrottle(clock, time.Minute, out.logf)
+	throttle.Printf("Warning: Twenty unavailable")
+	throttle.Printf("Warning: Twenty unavailable")
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runLogThrottleFlusher(throttle, time.Minute, stop)
+		close(done)
+	}()
+
+	waitForWaiters(t, clock, 1)
+	clock.Advance(time.Minute)
+	waitForWaiters(t, clock, 1)
+	if got := out.get(); len(got) != 2 || got[1] != `Suppressed 1 repeated log of: "Warning: Twenty unavailable"` {
+		t.Errorf("lines = %q, want the count flushed on the interval", got)
+	}
+
+	close(stop)
+	<-done
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// mailgunWebhookMaxAge bounds how old a signed webhook timestamp may be
+const mailgunWebhookMaxAge = 15 * time.Minute
+
+// MailgunSignature is the signature block of a Mailgun webhook
+type MailgunSignature struct {
+	Timestamp string `json:"timestamp"`
+	Token     string `json:"token"`
+	Signature string `json:"signature"`
+}
+
+// MailgunWebhook is the body Mailgun posts for delivery events
+type MailgunWebhook struct {
+	Signature MailgunSignature `json:"signature"`
+	EventData struct {
+		Event          string `json:"event"`
+		Recipient      string `json:"recipient"`
+		Severity       string `json:"severity"`
+		Reason         string `json:"reason"`
+		DeliveryStatus struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+// verifyMailgunSignature checks the HMAC-SHA256 of timestamp+token with the
+// webhook signing key, that the timestamp is recent, and that the token
+// hasn't been seen before (replay protection via the shared store)
+func verifyMailgunSignature(sig MailgunSignature, signingKey string, now time.Time) error {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(sig.Signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	ts, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", sig.Timestamp)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > mailgunWebhookMaxAge || age < -mailgunWebhookMaxAge {
+		return fmt.Errorf("timestamp outside the allowed window (%s)", age.Round(time.Second))
+	}
+
+	n, err := store.Incr("mailgun-token:"+sig.Token, 2*mailgunWebhookMaxAge)
+	if err != nil {
+		log.Printf("Warning: Failed to check Mailgun webhook token: %v", err)
+	} else if n > 1 {
+		return fmt.Errorf("token already used")
+	}
+
+	return nil
+}
+
+// handleMailgunWebhook records delivery, bounce and complaint events for
+// notification emails. Requests must be signed with
+// MAILGUN_WEBHOOK_SIGNING_KEY; the route is only registered when it is set.
+func handleMailgunWebhook(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var hook MailgunWebhook
+		if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := verifyMailgunSignature(hook.Signature, cfg.MailgunWebhookSigningKey, systemClock.Now()); err != nil {
+			log.Printf("Rejected Mailgun webhook: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		recordMailgunEvent(r.Context(), cfg, hook)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// recordMailgunEvent logs the event and, for permanent failures when
+// MAILGUN_BOUNCE_PERSON_FIELD is set, flags the recipient's Twenty person
+// (best-effort)
+func recordMailgunEvent(ctx context.Context, cfg *Config, hook MailgunWebhook) {
+	event := hook.EventData
+	switch event.Event {
+	case "delivered":
+		log.Printf("Mailgun: delivered to %s", event.Recipient)
+		return
+	case "complained":
+		log.Printf("Warning: Mailgun: %s marked an email as spam", event.Recipient)
+		return
+	case "failed":
+		log.Printf("Warning: Mailgun: %s delivery to %s failed (%s): %d %s",
+			event.Severity, event.Recipient, event.Reason, event.DeliveryStatus.Code, event.DeliveryStatus.Message)
+	default:
+		log.Printf("Mailgun: %s event for %s", event.Event, event.Recipient)
+		return
+	}
+
+	field := cfg.MailgunBouncePersonField
+	if field == "" || event.Severity != "permanent" || !cfg.CRMConfigured() {
+		return
+	}
+
+	personID, err := findPersonByEmail(ctx, cfg, event.Recipient)
+	if err != nil {
+		log.Printf("Warning: Failed to look up bounced recipient %s: %v", event.Recipient, err)
+		return
+	}
+	if personID == "" {
+		return
+	}
+
+	if err := updatePersonField(ctx, cfg, personID, field, true); err != nil {
+		log.Printf("Warning: Failed to flag bounced person %s: %v", personID, err)
+	}
+}
+
+// updatePersonField sets a single (custom) field on a person
+func updatePersonField(ctx context.Context, cfg *Config, personID, field string, value interface{}) error {
+	query := `
+		mutation UpdatePerson($id: UUID!, $input: PersonUpdateInput!) {
+			updatePerson(id: $id, data: $input) {
+				id
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": personID,
+		"input": map[string]interface{}{
+			field: value,
+		},
+	}
+
+	_, err := executeTwentyGraphQL(ctx, cfg, query, variables, mutationCall())
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningKey = "signing-key"
+
+// signMailgun returns a signature block for token at time ts
+func signMailgun(ts time.Time, token string) MailgunSignature {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSigningKey))
+	mac.Write([]byte(timestamp + token))
+	return MailgunSignature{Timestamp: timestamp, Token: token, Signature: hex.EncodeToString(mac.Sum(nil))}
+}
+
+// mailgunWebhookBody is a sample webhook payload signed with sig
+func mailgunWebhookBody(sig MailgunSignature, eventData string) string {
+	return `{"signature":{"timestamp":"` + sig.Timestamp + `","token":"` + sig.Token + `","signature":"` + sig.Signature + `"},"event-data":` + eventData + `}`
+}
+
+const permanentBounce = `{"event":"failed","severity":"permanent","recipient":"sales@example.com","reason":"bounce","delivery-status":{"code":550,"message":"No such user"}}`
+
+func TestVerifyMailgunSignature(t *testing.T) {
+	_, clock := useMemoryStore(t)
+	now := clock.Now()
+
+	valid := signMailgun(now, "token-1")
+	if err := verifyMailgunSignature(valid, testSigningKey, now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	forged := signMailgun(now, "token-2")
+	forged.Signature = strings.Repeat("0", 64)
+	tampered := signMailgun(now, "token-3")
+	tampered.Timestamp = strconv.FormatInt(now.Unix()+1, 10)
+
+	tests := []struct {
+		name string
+		sig  MailgunSignature
+	}{
+		{"replayed token", valid},
+		{"wrong signature", forged},
+		{"tampered timestamp", tampered},
+		{"stale", signMailgun(now.Add(-time.Hour), "token-4")},
+		{"future", signMailgun(now.Add(time.Hour), "token-5")},
+		{"missing", MailgunSignature{}},
+	}
+	for _, tt := range tests {
+		if err := verifyMailgunSignature(tt.sig, testSigningKey, now); err == nil {
+			t.Errorf("%s: signature accepted", tt.name)
+		}
+	}
+
+	// Small clock skew is fine
+	if err := verifyMailgunSignature(signMailgun(now.Add(5*time.Minute), "token-6"), testSigningKey, now); err != nil {
+		t.Errorf("skewed timestamp rejected: %v", err)
+	}
+}
+
+func postMailgunWebhook(cfg *Config, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handleMailgunWebhook(cfg)(w, httptest.NewRequest("POST", "/api/mailgun-webhook", strings.NewReader(body)))
+	return w
+}
+
+func TestHandleMailgunWebhook(t *testing.T) {
+	useMemoryStore(t)
+	useSystemClock(t)
+	cfg := &Config{MailgunWebhookSigningKey: testSigningKey}
+	out := captureStandardLog(t)
+
+	tests := []struct {
+		event   string
+		wantLog string
+	}{
+		{`{"event":"delivered","recipient":"sales@example.com"}`, "Mailgun: delivered to sales@example.com"},
+		{`{"event":"complained","recipient":"sales@example.com"}`, "Mailgun: sales@example.com marked an email as spam"},
+		{permanentBounce, "Mailgun: permanent delivery to sales@example.com failed (bounce): 550 No such user"},
+		{`{"event":"opened","recipient":"sales@example.com"}`, "Mailgun: opened event for sales@example.com"},
+	}
+	for i, tt := range tests {
+		sig := signMailgun(testEpoch, "token-"+strconv.Itoa(i))
+		if w := postMailgunWebhook(cfg, mailgunWebhookBody(sig, tt.event)); w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", tt.event, w.Code)
+		}
+		if !strings.Contains(out.String(), tt.wantLog) {
+			t.Errorf("log = %q, want %q", out.String(), tt.wantLog)
+		}
+	}
+
+	bad := signMailgun(testEpoch, "token-bad")
+	bad.Signature = strings.Repeat("0", 64)
+	if w := postMailgunWebhook(cfg, mailgunWebhookBody(bad, permanentBounce)); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid signature: status = %d, want 401", w.Code)
+	}
+	if w := postMailgunWebhook(cfg, "not json"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid body: status = %d, want 400", w.Code)
+	}
+}
+
+func TestRecordMailgunEventFlagsBouncedPerson(t *testing.T) {
+	useMemoryStore(t)
+
+	t.Run("permanent bounce", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		cfg.MailgunBouncePersonField = "emailBounced"
+		stub.on("FindPerson", returningPerson)
+
+		var hook MailgunWebhook
+		hook.EventData.Event = "failed"
+		hook.EventData.Severity = "permanent"
+		hook.EventData.Recipient = "sales@example.com"
+		recordMailgunEvent(context.Background(), cfg, hook)
+
+		update := stub.variables("UpdatePerson")
+		if update["id"] != "person-9" || update["input"].(map[string]interface{})["emailBounced"] != true {
+			t.Errorf("update = %v, want person-9 flagged", update)
+		}
+	})
+
+	t.Run("temporary failure", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		cfg.MailgunBouncePersonField = "emailBounced"
+		stub.on("FindPerson", returningPerson)
+
+		var hook MailgunWebhook
+		hook.EventData.Event = "failed"
+		hook.EventData.Severity = "temporary"
+		recordMailgunEvent(context.Background(), cfg, hook)
+
+		if n := len(stub.operations()); n != 0 {
+			t.Errorf("%d CRM calls for a temporary failure, want none", n)
+		}
+	})
+
+	t.Run("unknown recipient", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		cfg.MailgunBouncePersonField = "emailBounced"
+
+		var hook MailgunWebhook
+		hook.EventData.Event = "failed"
+		hook.EventData.Severity = "permanent"
+		hook.EventData.Recipient = "nobody@example.com"
+		recordMailgunEvent(context.Background(), cfg, hook)
+
+		if n := stub.count("UpdatePerson"); n != 0 {
+			t.Errorf("%d people flagged for an unknown recipient, want none", n)
+		}
+	})
+}
@@ -3,46 +3,266 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/mailgun/mailgun-go/v4"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// normalizePhone converts phone to E.164 format for Twenty CRM
-// Returns empty string if phone can't be normalized
-func normalizePhone(phone string) string {
+// trunkPrefixPattern matches the "(0)" written after a country code for the
+// trunk prefix, as in "+44 (0)20 ...", which is not dialled internationally
+var trunkPrefixPattern = regexp.MustCompile(`\(\s*0\s*\)`)
+
+// normalizePhone converts phone to E.164 format for Twenty CRM.
+// Numbers written with a leading "+" or "00" keep their country code, minus
+// any "(0)" trunk prefix; national numbers get the calling code of
+// country (an ISO code, see defaultPhoneCountry), dropping a leading trunk
+// 0. Returns empty string if phone can't be normalized.
+func normalizePhone(phone, country string) string {
+	phone = strings.TrimSpace(phone)
 	if phone == "" {
 		return ""
 	}
-	// Strip all non-digits
-	re := regexp.MustCompile(`\D`)
-	digits := re.ReplaceAllString(phone, "")
+	// Strip the trunk marker, then all non-digits
+	digits := nonDigitPattern.ReplaceAllString(trunkPrefixPattern.ReplaceAllString(phone, ""), "")
+
+	switch {
+	case strings.HasPrefix(phone, "+"):
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	default:
+		digits = nationalToInternational(digits, country)
+	}
 
-	// Need at least 10 digits for US number
-	if len(digits) < 10 {
+	// E.164 numbers have at most 15 digits; anything under 8 is too short
+	// to be a full number in any country we see leads from
+	if len(digits) < 8 || len(digits) > 15 {
 		return ""
 	}
+	return "+" + digits
+}
+
+// defaultPhoneCountry returns DEFAULT_COUNTRY, the ISO country assumed for
+// phone numbers without a country code (default US)
+func defaultPhoneCountry(cfg *Config) string {
+	if cfg.DefaultCountry != "" {
+		return cfg.DefaultCountry
+	}
+	return "US"
+}
+
+// parseDefaultCountry normalizes DEFAULT_COUNTRY, rejecting one that isn't
+// an ISO code with a known calling code, since every national number would
+// then be dropped
+func parseDefaultCountry(v string) (string, error) {
+	country, err := normalizeCountryCode(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid DEFAULT_COUNTRY: %w", err)
+	}
+	if country == "" {
+		return "", nil
+	}
+	if _, ok := callingCodeForCountry(country); !ok {
+		return "", fmt.Errorf("invalid DEFAULT_COUNTRY: no calling code known for %q", country)
+	}
+	return country, nil
+}
 
-	// If 10 digits, assume US and add +1
-	if len(digits) == 10 {
-		return "+1" + digits
+// nationalToInternational prefixes national digits with the country's
+// calling code. Unknown countries return "" since the number can't be
+// placed.
+func nationalToInternational(digits, country string) string {
+	code, ok := callingCodeForCountry(country)
+	if !ok {
+		return ""
 	}
 
-	// If 11 digits starting with 1, add +
-	if len(digits) == 11 && digits[0] == '1' {
-		return "+" + digits
+	// North American numbers: 10 digits, or 11 with the leading 1
+	if code == "1" {
+		switch {
+		case len(digits) == 10:
+			return "1" + digits
+		case len(digits) == 11 && digits[0] == '1':
+			return digits
+		case len(digits) >= 11:
+			// Not a North American number, so it carries its own
+			// country code without the "+"
+			return digits
+		}
+		return ""
 	}
 
-	// Otherwise return with + prefix
-	return "+" + digits
+	// Elsewhere a leading 0 is the trunk prefix, not part of the number
+	return code + strings.TrimPrefix(digits, "0")
+}
+
+// hashEmail returns a salted SHA-256 of the normalized (trimmed, lowercased)
+// email, hex-encoded, for counting unique leads without keeping raw emails
+func hashEmail(email, salt string) string {
+	sum := sha256.Sum256([]byte(salt + strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// hostnamePattern matches a dotted DNS hostname
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// normalizeURL cleans up a website URL for Twenty's domainName field.
+// A missing scheme defaults to https, and values without a valid host are
+// rejected. Empty input returns empty.
+func normalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+
+	if !hostnamePattern.MatchString(u.Hostname()) {
+		return "", fmt.Errorf("invalid host %q", u.Host)
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// maxReferralSourceLength caps free-text referral sources
+const maxReferralSourceLength = 100
+
+// normalizeReferralSource trims the referral source and, when
+// REFERRAL_SOURCES (comma-separated) is configured, requires it to match one
+// of the allowed values (case-insensitively, returning the configured
+// spelling). Without an allowed list, free text is accepted up to
+// maxReferralSourceLength characters.
+func normalizeReferralSource(cfg *Config, source string) (string, error) {
+	source = strings.Join(strings.Fields(source), " ")
+	if source == "" {
+		return "", nil
+	}
+
+	if allowed := cfg.ReferralSources; len(allowed) > 0 {
+		for _, option := range allowed {
+			if strings.EqualFold(option, source) {
+				return option, nil
+			}
+		}
+		return "", fmt.Errorf("unknown referral source %q", source)
+	}
+
+	if runes := []rune(source); len(runes) > maxReferralSourceLength {
+		source = string(runes[:maxReferralSourceLength])
+	}
+	return source, nil
+}
+
+// countryCodePattern matches an ISO 3166-1 alpha-2 code
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// normalizeCountryCode uppercases a submitted country and checks it looks
+// like an ISO 3166-1 alpha-2 code. Empty input returns empty.
+func normalizeCountryCode(country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		return "", nil
+	}
+	if !countryCodePattern.MatchString(country) {
+		return "", fmt.Errorf("invalid country code %q", country)
+	}
+	return country, nil
+}
+
+// personLocationFields maps the submitted city/state/country onto the new
+// person. The city goes to Twenty's standard city field; state and country
+// are written to the ADDRESS field named by PERSON_ADDRESS_FIELD, if set,
+// since people have no standard address. Missing values are omitted.
+func personLocationFields(cfg *Config, req ContactRequest) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if req.City != "" {
+		fields["city"] = req.City
+	}
+
+	if field := cfg.PersonAddressField; field != "" {
+		address := map[string]interface{}{}
+		if req.City != "" {
+			address["addressCity"] = req.City
+		}
+		if req.State != "" {
+			address["addressState"] = req.State
+		}
+		if req.Country != "" {
+			address["addressCountry"] = req.Country
+		}
+		if len(address) > 0 {
+			fields[field] = address
+		}
+	}
+
+	return fields
+}
+
+// normalizeService turns the free-form service into a short single-line
+// label for the opportunity name. Whitespace (including newlines) is
+// collapsed, SERVICE_ALIASES ("web=Web Design,...") maps values to canonical
+// names case-insensitively, and values longer than SERVICE_MAX_LENGTH
+// (default 80) are truncated, or rejected when SERVICE_OVERLENGTH=reject.
+func normalizeService(cfg *Config, service string) (string, error) {
+	service = strings.Join(strings.Fields(service), " ")
+	if service == "" {
+		return "", nil
+	}
+
+	for _, alias := range cfg.ServiceAliases {
+		from, to, ok := strings.Cut(alias, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(from), service) {
+			service = strings.TrimSpace(to)
+			break
+		}
+	}
+
+	maxLen := cfg.ServiceMaxLength
+	if maxLen == 0 {
+		maxLen = 80
+	}
+
+	if runes := []rune(service); len(runes) > maxLen {
+		if cfg.ServiceOverlength == "reject" {
+			return "", fmt.Errorf("service exceeds %d characters", maxLen)
+		}
+		service = strings.TrimSpace(string(runes[:maxLen]))
+	}
+
+	return service, nil
 }
 
 type ContactRequest struct {
@@ -52,13 +272,66 @@ type ContactRequest struct {
 	Phone   string `json:"phone"`
 	Message string `json:"message"`
 	Service string `json:"service"`
+
+	// Optional fields, also filled in by lead enrichment
+	Title       string `json:"title,omitempty"`
+	CompanySize int    `json:"companySize,omitempty"`
+	Website     string `json:"website,omitempty"`
+
+	// ReferralSource is the self-reported "how did you hear about us"
+	ReferralSource string `json:"referralSource,omitempty"`
+
+	// Self-reported location; Country is an ISO 3166-1 alpha-2 code
+	City    string `json:"city,omitempty"`
+	State   string `json:"state,omitempty"`
+	Country string `json:"country,omitempty"`
+
+	// Consent is the explicit consent checkbox, required for visitors from
+	// CONSENT_REQUIRED_COUNTRIES
+	Consent bool `json:"consent,omitempty"`
+
+	// ReferrerChain is the pages visited before converting, oldest first
+	ReferrerChain []string `json:"referrerChain,omitempty"`
+
+	// FormType selects a FORM_PROFILES entry; empty is the plain contact form
+	FormType string `json:"formType,omitempty"`
+
+	// Location is resolved from the client IP, never taken from the body
+	Location *GeoLocation `json:"-"`
+
+	// ScriptContent is set when the message contained script-like markup
+	// (with FLAG_SCRIPT_CONTENT)
+	ScriptContent bool `json:"-"`
+
+	// EmailHash is the salted email hash analytics records carry instead of
+	// the raw email (empty without EMAIL_HASH_SALT)
+	EmailHash string `json:"-"`
 }
 
 type Response struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+	// Reference is the confirmation number, when CONFIRMATION_NUMBERS is set
+	Reference string `json:"reference,omitempty"`
+	// LeadID is the CRM opportunity (or lead) ID, set only when the CRM
+	// records were created
+	LeadID string `json:"leadId,omitempty"`
+	// IsReturning is set when the submitter was already in the CRM
+	IsReturning bool `json:"isReturning,omitempty"`
 }
 
+// Error codes returned in Response.Code
+const (
+	codeValidationError = "VALIDATION_ERROR"
+)
+
+// successMessage is shown to the submitter once a lead is accepted
+const successMessage = "Thank you for reaching out. We'll be in touch within 24 hours."
+
+// bodySampleBytes is how much of an undecodable body is logged
+const bodySampleBytes = 32
+
 // Twenty CRM GraphQL types
 type GraphQLRequest struct {
 	Query     string                 `json:"query"`
@@ -77,277 +350,1174 @@ type LeadResult struct {
 	PersonID      string
 	CompanyID     string
 	OpportunityID string
+	LeadID        string // set instead of OpportunityID in CRM_LEAD_MODE
+	TaskID        string
 	IsNewPerson   bool
+	// AlternateName is the submitted name when it differs from the one
+	// stored on an existing person (recorded by NAME_MISMATCH_MODE=note)
+	AlternateName string
+	// PriorInquiries is how many opportunities a returning person already
+	// had (set when INCLUDE_PRIOR_INQUIRIES is enabled)
+	PriorInquiries int
+	// ReusedOpportunity is set when the lead was appended to an existing
+	// open opportunity instead of creating a new one
+	ReusedOpportunity bool
+	// ReopenedOpportunity is set when the person's closed opportunity was
+	// moved back to the initial stage instead of creating a new one
+	ReopenedOpportunity bool
+	// GroupedWithCompany is set when the lead joined an open opportunity
+	// from another person at the same company
+	GroupedWithCompany bool
+	// OwnerID is the workspace member picked from OPPORTUNITY_OWNER_IDS for
+	// the opportunity. It is kept with the progress so a retry reuses it
+	// instead of advancing the rotation again.
+	OwnerID string
 }
 
-func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	http.HandleFunc("/api/contact", corsMiddleware(handleContact))
-	http.HandleFunc("/health", handleHealth)
+// envBool reports whether the env var is set to a true value ("1", "true", ...).
+// A feature flag for the same key takes precedence.
+func envBool(key string) bool {
+	v, err := strconv.ParseBool(flagValue(key))
+	return err == nil && v
+}
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+// pluralize returns singular when n is 1 and plural otherwise
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
 	}
+	return plural
 }
 
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// splitList splits a comma-separated env value, dropping empty entries
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-
-		next(w, r)
 	}
+	return items
 }
 
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ok"))
+// envBoolDefault is like envBool but returns def when the env var is unset
+// or not a valid boolean
+func envBoolDefault(key string, def bool) bool {
+	v, err := strconv.ParseBool(flagValue(key))
+	if err != nil {
+		return def
+	}
+	return v
 }
 
-func handleContact(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+func main() {
+	initLogging()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	var req ContactRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendJSON(w, http.StatusBadRequest, Response{
-			Success: false,
-			Message: "Invalid request body",
-		})
-		return
+	initGeoIP()
+
+	// Spans are exported in batches; the last batch is flushed on shutdown
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		log.Printf("Warning: Tracing disabled: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
 	}
 
-	// Validate required fields
-	if req.Name == "" || req.Email == "" {
-		sendJSON(w, http.StatusBadRequest, Response{
-			Success: false,
-			Message: "Name and email are required",
-		})
-		return
+	// A broken Sheets setup only disables the spreadsheet copy
+	if err := initGoogleSheets(); err != nil {
+		log.Printf("Warning: Google Sheets disabled: %v", err)
 	}
 
-	// Create lead in Twenty CRM
-	var leadResult *LeadResult
-	var crmErr error
-	leadResult, crmErr = createTwentyLead(req)
-	if crmErr != nil {
-		log.Printf("Warning: Failed to create Twenty CRM lead: %v", crmErr)
-	} else {
-		if leadResult.IsNewPerson {
-			log.Printf("Created new Twenty CRM lead for %s", req.Email)
-		} else {
-			log.Printf("Found existing person for %s, created new opportunity", req.Email)
-		}
+	if err := initStore(); err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
 	}
 
-	// Send notification email with CRM link
-	if err := sendNotificationEmail(req, leadResult); err != nil {
-		log.Printf("Failed to send email: %v", err)
-		sendJSON(w, http.StatusInternalServerError, Response{
-			Success: false,
-			Message: "Failed to send message. Please try again later.",
-		})
-		return
+	if s, ok := store.(sweeper); ok {
+		go runStoreJanitor(s, systemClock, storeSweepInterval(), nil, observeStoreSize)
 	}
+	// Replayable Idempotency-Key responses expire on the same schedule
+	go runStoreJanitor(idempotencyKeys, systemClock, storeSweepInterval(), nil, observeIdempotencySize)
 
-	sendJSON(w, http.StatusOK, Response{
-		Success: true,
-		Message: "Thank you for reaching out. We'll be in touch within 24 hours.",
-	})
-}
+	// Collapse repetitive errors during outages
+	if interval := logThrottleInterval(); interval > 0 {
+		logThrottler = newLogThrottle(systemClock, interval, log.Printf)
+		go runLogThrottleFlusher(logThrottler, interval, nil)
+	}
 
-func createTwentyLead(req ContactRequest) (*LeadResult, error) {
-	apiURL := os.Getenv("TWENTY_API_URL")
-	apiKey := os.Getenv("TWENTY_API_KEY")
+	// Runtime overrides for boolean and duration settings
+	if cfg.FeatureFlagsURL != "" {
+		go runFeatureFlagPoller(flags, cfg.FeatureFlagsURL, systemClock, featureFlagsInterval(), nil)
+	}
 
-	if apiURL == "" || apiKey == "" {
-		return nil, fmt.Errorf("twenty CRM configuration missing")
+	if interval := summaryLogInterval(); interval > 0 {
+		go runSummaryLogger(systemClock, interval, nil)
 	}
 
-	result := &LeadResult{}
+	// The digest keeps running until shutdown, then sends what's buffered
+	stopDigest := make(chan struct{})
+	digestFlushed := make(chan struct{})
+	if digestEnabled(cfg) {
+		digest = newNotificationDigest(systemClock, cfg.DigestMaxLeads, func(recipient string, entries []digestEntry) error {
+			return sendDigestEmail(cfg, recipient, entries)
+		})
+		go func() {
+			runDigest(digest, digestInterval(), stopDigest)
+			close(digestFlushed)
+		}()
+	} else {
+		close(digestFlushed)
+	}
 
-	// Parse name into first/last
-	nameParts := strings.SplitN(strings.TrimSpace(req.Name), " ", 2)
-	firstName := nameParts[0]
-	lastName := ""
-	if len(nameParts) > 1 {
-		lastName = nameParts[1]
+	// Jobs dispatched by other instances are queued and processed here
+	stopLeadWorkers := func() {}
+	if cfg.LeadWorkerSecret != "" {
+		stopLeadWorkers = startLeadWorkers(cfg, leadWorkerConcurrency(cfg), leadWorkerQueueSize(cfg))
 	}
 
-	// Step 1: Create or find Company (if provided)
-	if req.Company != "" {
-		companyID, err := findOrCreateCompany(apiURL, apiKey, req.Company)
-		if err != nil {
-			log.Printf("Warning: Failed to find/create company: %v", err)
+	if envBool("STARTUP_SELFTEST") {
+		go runStartupSelfTest(cfg)
+	}
+
+	srv := newServer(cfg, ":"+cfg.Port, newRouter(cfg))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", cfg.Port)
+		if serveTLS(cfg) {
+			serveErr <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
 		} else {
-			result.CompanyID = companyID
+			serveErr <- srv.ListenAndServe()
 		}
-	}
+	}()
 
-	// Step 2: Find existing person by email or create new one
-	personID, isNew, err := findOrCreatePerson(apiURL, apiKey, firstName, lastName, req.Email, req.Phone, result.CompanyID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find/create person: %w", err)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
 	}
-	result.PersonID = personID
-	result.IsNewPerson = isNew
+	stop()
 
-	// Step 3: Create Opportunity
-	opportunityName := fmt.Sprintf("%s - %s", req.Name, req.Service)
-	if req.Service == "" {
-		opportunityName = fmt.Sprintf("%s - Website Inquiry", req.Name)
+	// Stop accepting connections and let in-flight requests (and their CRM
+	// calls) finish within the grace period
+	grace := shutdownGracePeriod()
+	log.Printf("Shutting down, draining in-flight requests (up to %s)", grace)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: Requests still running after %s were cut off: %v", grace, err)
 	}
 
-	opportunityID, err := createTwentyOpportunity(apiURL, apiKey, opportunityName, req.Message, result.PersonID, result.CompanyID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create opportunity: %w", err)
+	// Finish the lead jobs already acknowledged to their dispatchers
+	log.Printf("Processing queued lead jobs")
+	stopLeadWorkers()
+
+	if digest != nil {
+		log.Printf("Flushing lead digest")
 	}
-	result.OpportunityID = opportunityID
+	close(stopDigest)
+	<-digestFlushed
 
-	return result, nil
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Warning: Failed to flush traces: %v", err)
+	}
+	log.Printf("Shutdown complete")
 }
 
-func findOrCreateCompany(apiURL, apiKey, name string) (string, error) {
-	// First, search for existing company by name
-	searchQuery := `
-		query FindCompany($filter: CompanyFilterInput) {
-			companies(filter: $filter) {
-				edges {
-					node {
-						id
-						name
-					}
-				}
-			}
-		}
-	`
+// shutdownGracePeriod returns SHUTDOWN_GRACE_PERIOD, how long in-flight
+// requests get to finish on SIGINT/SIGTERM (default 15s)
+func shutdownGracePeriod() time.Duration {
+	return envDuration("SHUTDOWN_GRACE_PERIOD", 15*time.Second)
+}
 
-	searchVars := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"name": map[string]interface{}{
-				"ilike": "%" + name + "%",
-			},
-		},
+// contactPaths returns the paths the contact endpoint is served on
+// (CONTACT_PATH, comma-separated, default /api/contact)
+func contactPaths(cfg *Config) []string {
+	if len(cfg.ContactPaths) > 0 {
+		return cfg.ContactPaths
 	}
+	return []string{"/api/contact"}
+}
 
-	resp, err := executeTwentyGraphQL(apiURL, apiKey, searchQuery, searchVars)
-	if err == nil {
-		var searchResult struct {
-			Companies struct {
-				Edges []struct {
-					Node struct {
-						ID   string `json:"id"`
-						Name string `json:"name"`
-					} `json:"node"`
-				} `json:"edges"`
-			} `json:"companies"`
-		}
+// contactMethods returns the HTTP methods accepted by the contact endpoint
+// (CONTACT_METHODS, comma-separated, default POST)
+func contactMethods(cfg *Config) []string {
+	if len(cfg.ContactMethods) > 0 {
+		return cfg.ContactMethods
+	}
+	return []string{"POST"}
+}
 
-		if err := json.Unmarshal(resp.Data, &searchResult); err == nil {
-			if len(searchResult.Companies.Edges) > 0 {
-				return searchResult.Companies.Edges[0].Node.ID, nil
-			}
-		}
+// newRouter registers the application's routes
+func newRouter(cfg *Config) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, path := range contactPaths(cfg) {
+		mux.HandleFunc(path, corsMiddleware(cfg, idempotent(cfg, rateLimit(cfg, traceRequest("contact", handleContact(cfg))))))
+	}
+	mux.HandleFunc("/health", handleHealth)
+	if envBool("ENABLE_METRICS") {
+		mux.Handle("/metrics", metricsHandler())
 	}
+	if len(cfg.PartnerFieldMap) > 0 {
+		mux.HandleFunc("/api/partner/contact", traceRequest("partner-contact", handlePartnerContact(cfg)))
+	}
+	if confirmationNumbersEnabled() {
+		mux.HandleFunc("/api/contact/lookup", handleSubmissionLookup(cfg))
+	}
+	if cfg.MailgunWebhookSigningKey != "" {
+		mux.HandleFunc("/api/mailgun-webhook", handleMailgunWebhook(cfg))
+	}
+	if cfg.LeadWorkerSecret != "" {
+		mux.HandleFunc("/internal/process-lead", traceRequest("process-lead", handleProcessLead(cfg)))
+	}
+	mux.HandleFunc("/api/admin/dedup-stats", requireAdmin(cfg, handleDedupStats))
+	mux.HandleFunc("/api/admin/submissions", requireAdmin(cfg, handleListSubmissions))
+	mux.HandleFunc("/api/admin/company-merges", requireAdmin(cfg, handleListCompanyMerges))
+	mux.HandleFunc("/api/admin/dead-letters", requireAdmin(cfg, handleListDeadLetters))
+	mux.HandleFunc("/api/admin/dead-letters/retry", requireAdmin(cfg, handleRetryDeadLetter(cfg)))
+	mux.HandleFunc("/api/admin/dead-letters/discard", requireAdmin(cfg, handleDiscardDeadLetter))
+	return mux
+}
 
-	// Create new company if not found
-	createQuery := `
-		mutation CreateCompany($input: CompanyCreateInput!) {
-			createCompany(data: $input) {
-				id
-			}
+// allowedOrigin returns the Access-Control-Allow-Origin value for a
+// request's Origin: "*" when ALLOWED_ORIGINS (comma-separated) is unset,
+// the origin itself when it is listed, and "" (no CORS access) otherwise
+func allowedOrigin(cfg *Config, origin string) string {
+	allowed := cfg.AllowedOrigins
+	if len(allowed) == 0 {
+		return "*"
+	}
+	for _, o := range allowed {
+		if origin != "" && strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin
 		}
-	`
-
-	createVars := map[string]interface{}{
-		"input": map[string]interface{}{
-			"name": name,
-		},
 	}
+	return ""
+}
 
-	resp, err = executeTwentyGraphQL(apiURL, apiKey, createQuery, createVars)
-	if err != nil {
-		return "", err
+// setAllowOrigin sets the CORS origin headers for r. A listed origin is
+// echoed back with credentials allowed, and responses vary by Origin so
+// caches don't serve one origin's headers to another.
+func setAllowOrigin(cfg *Config, w http.ResponseWriter, r *http.Request) {
+	origin := allowedOrigin(cfg, r.Header.Get("Origin"))
+	if origin == "*" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
 	}
 
-	var result struct {
-		CreateCompany struct {
-			ID string `json:"id"`
-		} `json:"createCompany"`
+	w.Header().Add("Vary", "Origin")
+	if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
 	}
+}
 
-	if err := json.Unmarshal(resp.Data, &result); err != nil {
-		return "", fmt.Errorf("failed to parse company response: %w", err)
+func corsMiddleware(cfg *Config, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setAllowOrigin(cfg, w, r)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(append(contactMethods(cfg), "OPTIONS"), ", "))
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next(w, r)
 	}
+}
 
-	return result.CreateCompany.ID, nil
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
 }
 
-func findOrCreatePerson(apiURL, apiKey, firstName, lastName, email, phone, companyID string) (string, bool, error) {
-	// Search for existing person by email
-	searchQuery := `
-		query FindPerson($filter: PersonFilterInput) {
-			people(filter: $filter) {
-				edges {
-					node {
-						id
-						emails {
-							primaryEmail
-						}
-					}
-				}
-			}
+func handleContact(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(contactMethods(cfg), r.Method) {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
-	`
 
-	searchVars := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"emails": map[string]interface{}{
-				"primaryEmail": map[string]interface{}{
-					"ilike": email,
-				},
-			},
-		},
-	}
+		stats.Total.Add(1)
+		metricSubmissions.Inc()
 
-	resp, err := executeTwentyGraphQL(apiURL, apiKey, searchQuery, searchVars)
-	if err == nil {
-		var searchResult struct {
-			People struct {
-				Edges []struct {
-					Node struct {
-						ID     string `json:"id"`
-						Emails struct {
-							PrimaryEmail string `json:"primaryEmail"`
-						} `json:"emails"`
-					} `json:"node"`
-				} `json:"edges"`
-			} `json:"people"`
+		if ua := r.UserAgent(); botUserAgentMatch(cfg, ua) {
+			stats.Rejected.Add(1)
+			logEvent("bot_rejected", []any{"user_agent", ua}, "Rejected bot submission (user agent %q)", ua)
+			if botResponseForbidden(cfg) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			sendResponse(w, r, http.StatusOK, Response{
+				Success: true,
+				Message: successMessage,
+			})
+			return
 		}
 
-		if err := json.Unmarshal(resp.Data, &searchResult); err == nil {
-			if len(searchResult.People.Edges) > 0 {
-				// Found existing person
-				return searchResult.People.Edges[0].Node.ID, false, nil
-			}
+		// Silently drop requests the WAF scored as threats, without CRM or
+		// email side effects
+		if score, blocked := wafThreatScore(cfg, r); blocked {
+			stats.Rejected.Add(1)
+			logEvent("waf_dropped", []any{"threat_score", score}, "Dropped submission flagged by WAF (threat score %g)", score)
+			sendResponse(w, r, http.StatusOK, Response{
+				Success: true,
+				Message: successMessage,
+			})
+			return
 		}
-	}
 
-	// Create new person if not found
-	createQuery := `
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes(cfg))
+		body := &countingReader{r: r.Body}
+		defer func() { stats.BodyBytes.Add(body.n) }()
+
+		raw, err := readRequestBody(cfg, body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			stats.Rejected.Add(1)
+			status, message := http.StatusBadRequest, "Invalid request body"
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.Is(err, errBodyTooLarge), errors.As(err, &maxBytesErr):
+				status, message = http.StatusRequestEntityTooLarge, "Request body too large"
+			case errors.Is(err, errUnsupportedEncoding):
+				status, message = http.StatusUnsupportedMediaType, "Unsupported Content-Encoding"
+			}
+			logEvent("body_rejected", []any{"error", err.Error()}, "Rejected request body: %v", err)
+			sendResponse(w, r, status, Response{
+				Success: false,
+				Message: message,
+			})
+			return
+		}
+
+		// Tell binary / badly encoded bodies apart from JSON with wrong fields
+		if trimmed := bytes.TrimSpace(raw); !utf8.Valid(raw) || len(trimmed) == 0 || trimmed[0] != '{' {
+			stats.Rejected.Add(1)
+			logInvalidBody(raw)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Request body must be a UTF-8 encoded JSON object",
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		// A filled-in honeypot means a bot; pretend it worked so it moves on
+		raw, trapped := checkHoneypot(cfg.HoneypotField, raw)
+		if trapped {
+			stats.Rejected.Add(1)
+			logEvent("honeypot_dropped", []any{"field", cfg.HoneypotField}, "Dropped submission with the %s honeypot filled in", cfg.HoneypotField)
+			sendResponse(w, r, http.StatusOK, Response{
+				Success: true,
+				Message: successMessage,
+			})
+			return
+		}
+
+		// Unknown fields usually mean a client built against another version
+		// of the form, so reject them rather than drop data silently
+		var req ContactRequest
+		if err := decodeStrict(raw, &req); err != nil {
+			stats.Rejected.Add(1)
+			message := "Invalid request body"
+			if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+				message = "Unknown field " + field
+			}
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: message,
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		// Site-specific normalization runs before any validation
+		applyFieldTransforms(cfg, &req)
+
+		// Validate required fields
+		if req.Name == "" || req.Email == "" {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Name and email are required",
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		// Catch malformed addresses before they reach the CRM
+		if !isValidEmail(req.Email) {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Please enter a valid email address",
+				Code:    codeValidationError,
+			})
+			return
+		}
+		req.Email = strings.TrimSpace(req.Email)
+
+		profile, ok := lookupFormProfile(cfg, req.FormType)
+		if !ok {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("Unknown form type %q", req.FormType),
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		if missing := missingRequiredFields(&req, profile); len(missing) > 0 {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Missing required fields: " + strings.Join(missing, ", "),
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		if err := checkEmailDomain(req.Email); err != nil {
+			stats.Rejected.Add(1)
+			logEvent("lead_rejected", leadLogFields(req.Email, nil, err), "Rejected lead: %v", err)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Please check your email address — its domain can't receive mail",
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		website, err := normalizeURL(req.Website)
+		if err != nil {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Website must be a valid URL",
+				Code:    codeValidationError,
+			})
+			return
+		}
+		req.Website = website
+
+		service, err := normalizeService(cfg, req.Service)
+		if err != nil {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Service is too long",
+				Code:    codeValidationError,
+			})
+			return
+		}
+		req.Service = service
+
+		referralSource, err := normalizeReferralSource(cfg, req.ReferralSource)
+		if err != nil {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Please choose a valid option for how you heard about us",
+				Code:    codeValidationError,
+			})
+			return
+		}
+		req.ReferralSource = referralSource
+
+		country, err := normalizeCountryCode(req.Country)
+		if err != nil {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Country must be a two-letter ISO country code",
+				Code:    codeValidationError,
+			})
+			return
+		}
+		req.Country = country
+		req.City = strings.Join(strings.Fields(req.City), " ")
+		req.State = strings.Join(strings.Fields(req.State), " ")
+
+		req.ReferrerChain = normalizeReferrerChain(req.ReferrerChain)
+		req.Location = lookupLocation(cfg, r)
+
+		if consentRequired(cfg, req) && !req.Consent {
+			stats.Rejected.Add(1)
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Please confirm your consent so we can process your request",
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		sanitizeMessageMarkup(cfg, &req)
+		if req.ScriptContent {
+			logEvent("script_content", leadLogFields(req.Email, nil, nil), "Warning: Message from %s contained script-like content", req.Email)
+		}
+
+		// Analytics records carry a salted hash instead of the raw email
+		if salt := cfg.EmailHashSalt; salt != "" {
+			req.EmailHash = hashEmail(req.Email, salt)
+			log.Printf("Analytics: lead submitted email_hash=%s service=%q", req.EmailHash, req.Service)
+		}
+
+		if overDailyCap(cfg, req.Email) {
+			stats.Rejected.Add(1)
+			logEvent("daily_cap_reached", leadLogFields(req.Email, nil, nil), "Rejected lead: daily submission cap reached for %s", req.Email)
+			sendResponse(w, r, http.StatusTooManyRequests, Response{
+				Success: false,
+				Message: "We've already received several messages from this address today. Please try again tomorrow.",
+			})
+			return
+		}
+
+		if !cfg.CRMConfigured() && cfg.CRMMissingConfig == "unavailable" {
+			logEvent("crm_not_configured", leadLogFields(req.Email, nil, nil), "Rejecting lead: Twenty CRM is not configured (TWENTY_API_URL/TWENTY_API_KEY)")
+			sendResponse(w, r, http.StatusServiceUnavailable, Response{
+				Success: false,
+				Message: "We can't accept messages right now. Please try again later.",
+			})
+			return
+		}
+
+		// Enrich once, before the submission is stored, so retries and the
+		// worker reuse the same values and the notification email sees them
+		enrichRequest(cfg, &req)
+
+		submission := &Submission{
+			ID:      newSubmissionID(),
+			Status:  submissionReceived,
+			Request: req,
+		}
+		reference := ""
+		if confirmationNumbersEnabled() {
+			submission.ID = newConfirmationNumber()
+			reference = submission.ID
+		}
+		if err := store.SaveSubmission(submission); err != nil {
+			logThrottledEvent("submission_save_failed", leadLogFields(req.Email, nil, err), "Warning: Failed to record submission: %v", err)
+		}
+
+		// Hand the lead to the external worker when one is configured. It is
+		// only processed here as well if the worker certainly didn't get it;
+		// otherwise both sides could create the same records.
+		if cfg.LeadWorkerURL != "" {
+			err := dispatchLead(r.Context(), cfg.LeadWorkerURL, cfg.LeadWorkerSecret, submission.ID, req)
+			if err == nil || !leadJobUndelivered(err) {
+				if err != nil {
+					logEvent("worker_dispatch_unknown", leadLogFields(req.Email, nil, err), "Warning: Lead dispatch to worker may not have arrived, leaving it to the worker: %v", err)
+					markDispatchUnknown(submission.ID, err)
+				}
+				stats.Accepted.Add(1)
+				go sendAutoresponder(cfg, req, reference)
+				sendResponse(w, r, http.StatusAccepted, Response{
+					Success:   true,
+					Message:   successMessage,
+					Reference: reference,
+				})
+				return
+			}
+			logEvent("worker_dispatch_failed", leadLogFields(req.Email, nil, err), "Warning: Failed to dispatch lead to worker, processing in-process: %v", err)
+		}
+
+		lead, err := completeLead(r.Context(), cfg, submission, req, 1)
+		if err != nil {
+			sendResponse(w, r, http.StatusInternalServerError, Response{
+				Success: false,
+				Message: "Failed to send message. Please try again later.",
+			})
+			return
+		}
+
+		resp := Response{
+			Success:   true,
+			Message:   successMessage,
+			Reference: reference,
+		}
+		if lead != nil {
+			resp.LeadID = lead.OpportunityID
+			if resp.LeadID == "" {
+				resp.LeadID = lead.LeadID
+			}
+			resp.IsReturning = !lead.IsNewPerson
+		}
+
+		// Confirm receipt to the submitter (optional, best-effort), only once
+		// the lead was accepted so a failed attempt doesn't also claim success
+		stats.Accepted.Add(1)
+		go sendAutoresponder(cfg, req, reference)
+		sendResponse(w, r, http.StatusOK, resp)
+	}
+}
+
+// completeLead runs the lead pipeline for a stored submission, records the
+// outcome and starts the best-effort mirrors. Steps recorded in the
+// submission's progress are skipped, so replaying a failed submission only
+// redoes what failed. It returns the CRM records (nil if the CRM step
+// failed) and the notification error, since without the email nobody hears
+// about the lead. attempts is passed through to processLead.
+func completeLead(ctx context.Context, cfg *Config, submission *Submission, req ContactRequest, attempts int) (*LeadResult, error) {
+	if submission.Progress == nil {
+		submission.Progress = &LeadProgress{}
+	}
+	progress := submission.Progress
+
+	// Replays of stored submissions lose the hash along with the other
+	// derived fields
+	if req.EmailHash == "" && cfg.EmailHashSalt != "" {
+		req.EmailHash = hashEmail(req.Email, cfg.EmailHashSalt)
+	}
+
+	// Create lead in Twenty CRM and send notification email with CRM link
+	// Keep the request's trace but not its cancellation: a client hanging
+	// up must not abort CRM writes half-way
+	ctx = context.WithoutCancel(ctx)
+
+	leadResult, crmErr, emailErr := processLead(ctx, cfg, req, progress, attempts)
+	defer recordSubmissionOutcome(submission, leadResult, crmErr, emailErr)
+	if crmErr != nil {
+		stats.CRMFailures.Add(1)
+		metricCRMFailures.Inc()
+		logThrottledEvent("crm_failed", leadLogFields(req.Email, leadResult, crmErr), "Warning: Failed to create Twenty CRM lead: %v", crmErr)
+	} else {
+		if leadResult.IsNewPerson {
+			logEvent("lead_created", leadLogFields(req.Email, leadResult, nil), "Created new Twenty CRM lead for %s", req.Email)
+		} else {
+			logEvent("lead_created", append(leadLogFields(req.Email, leadResult, nil), "returning", true), "Found existing person for %s, created new opportunity", req.Email)
+		}
+
+		// Mirror to the secondary target only once the primary succeeded
+		if !progress.Mirrored {
+			progress.Mirrored = true
+			go mirrorLead(cfg, req, leadResult)
+		}
+	}
+
+	// The spreadsheet gets every lead, with or without a CRM link
+	if !progress.SheetAppended {
+		progress.SheetAppended = true
+		go appendLeadToSheet(cfg, req, leadResult)
+	}
+
+	if emailErr != nil {
+		stats.EmailFailures.Add(1)
+		metricEmailFailures.Inc()
+		logThrottledEvent("email_failed", leadLogFields(req.Email, leadResult, emailErr), "Failed to send email: %v", emailErr)
+	}
+	if crmErr != nil {
+		return nil, emailErr
+	}
+	return leadResult, emailErr
+}
+
+// recordSubmissionOutcome updates the stored submission with the result of
+// the lead pipeline. A submission only counts as processed when both the CRM
+// and the notification succeeded.
+func recordSubmissionOutcome(sub *Submission, lead *LeadResult, crmErr, emailErr error) {
+	sub.Status = submissionProcessed
+	sub.LastError = ""
+	if lead != nil {
+		sub.OpportunityID = lead.OpportunityID
+	}
+	if err := errors.Join(crmErr, emailErr); err != nil {
+		sub.Status = submissionFailed
+		sub.LastError = err.Error()
+	}
+
+	if err := store.SaveSubmission(sub); err != nil {
+		logThrottled("Warning: Failed to update submission %s: %v", sub.ID, err)
+	}
+}
+
+// decodeStrict unmarshals a single JSON value into v, failing on fields v
+// doesn't have and on trailing data
+func decodeStrict(raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// logInvalidBody logs a short hex sample of a body that isn't UTF-8 JSON.
+// Set LOG_INVALID_BODY_SAMPLE=false to keep body contents out of the logs.
+func logInvalidBody(raw []byte) {
+	if !envBoolDefault("LOG_INVALID_BODY_SAMPLE", true) {
+		log.Printf("Rejected malformed request body (%d bytes)", len(raw))
+		return
+	}
+
+	sample := raw
+	if len(sample) > bodySampleBytes {
+		sample = sample[:bodySampleBytes]
+	}
+	log.Printf("Rejected malformed request body (%d bytes, valid UTF-8: %t): %x", len(raw), utf8.Valid(raw), sample)
+}
+
+// errCRMNotConfigured is returned when TWENTY_API_URL or TWENTY_API_KEY is unset
+var errCRMNotConfigured = errors.New("twenty CRM configuration missing")
+
+// createTwentyLead creates the company, person and opportunity for a lead.
+// IDs are recorded in progress as each step completes, and steps whose IDs
+// are already present are skipped, so a failed lead can be resumed by
+// calling again with the same progress.
+func createTwentyLead(ctx context.Context, cfg *Config, req ContactRequest, progress *LeadResult) (*LeadResult, error) {
+	if !cfg.CRMConfigured() {
+		return nil, errCRMNotConfigured
+	}
+
+	result := progress
+	if result == nil {
+		result = &LeadResult{}
+	}
+	crm := newCRMClient(cfg)
+
+	// Fix ALL-CAPS / all-lowercase names before splitting (off by default,
+	// since some names shouldn't be re-cased)
+	if envBool("NORMALIZE_NAME_CASE") {
+		req.Name = normalizeNameCase(req.Name)
+	}
+
+	// Parse name into first/last
+	firstName, lastName := parseName(req.Name)
+
+	// Step 1: Create or find Company (if provided)
+	if req.Company != "" && result.CompanyID == "" {
+		companyID, err := crm.FindOrCreateCompany(ctx, req.Company, req.Website, req.CompanySize)
+		if err != nil {
+			// In strict mode a lead whose company couldn't be recorded fails
+			// (and can be retried) instead of creating a company-less opportunity
+			if cfg.CompanyFailureMode == "strict" {
+				return nil, fmt.Errorf("failed to find/create company: %w", err)
+			}
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to find/create company: %v", err)
+		} else {
+			result.CompanyID = companyID
+		}
+	}
+
+	// Step 2: Find existing person by email or create new one
+	descReq := req
+	descReq.Message = messageOrPlaceholder(cfg, req.Message)
+	opportunityMessage := renderOpportunityDescription(cfg, descReq)
+	if result.PersonID == "" {
+		personFields := personLocationFields(cfg, req)
+		for field, value := range environmentFields(cfg) {
+			personFields[field] = value
+		}
+		personID, isNew, err := crm.FindOrCreatePerson(ctx, firstName, lastName, req.Email, req.Phone, req.Title, result.CompanyID, personFields)
+		if err != nil {
+			// Without a person the opportunity has no point of contact, so either
+			// give up (the email still goes out) or carry the contact details along
+			if orphanOpportunityMode(cfg) != "embed" {
+				return nil, fmt.Errorf("failed to find/create person: %w", err)
+			}
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to find/create person, embedding contact details in opportunity: %v", err)
+			opportunityMessage = strings.TrimSpace(contactDetailsMarkdown(req) + "\n\n" + opportunityMessage)
+		} else {
+			result.PersonID = personID
+			result.IsNewPerson = isNew
+
+			if !isNew {
+				handleNameMismatch(ctx, cfg, crm, result, firstName, lastName)
+
+				// Count earlier inquiries before this lead adds its own
+				if envBool("INCLUDE_PRIOR_INQUIRIES") {
+					count, err := crm.CountPersonOpportunities(ctx, personID)
+					if err != nil {
+						logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to count prior inquiries: %v", err)
+					} else {
+						result.PriorInquiries = count
+					}
+				}
+			}
+		}
+	}
+
+	opportunityName := taggedOpportunityName(cfg, renderOpportunityName(cfg, req))
+
+	// In lead mode, a Lead record replaces steps 3 and 4
+	leadMode := envBool("CRM_LEAD_MODE")
+	if leadMode && result.LeadID == "" {
+		leadID, err := crm.CreateLead(ctx, opportunityName, opportunityMessage, req.Service, result.PersonID, result.CompanyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create lead: %w", err)
+		}
+		result.LeadID = leadID
+	}
+
+	// Step 3: Append to a recent open opportunity for returning people (optional)
+	if window := opportunityReuseWindow(); !leadMode && window > 0 && result.OpportunityID == "" && result.PersonID != "" && !result.IsNewPerson {
+		existingID, err := crm.FindRecentOpenOpportunity(ctx, "pointOfContactId", result.PersonID, systemClock.Now().Add(-window))
+		if err != nil {
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to look up recent opportunities: %v", err)
+		} else if existingID != "" {
+			if opportunityMessage != "" {
+				if err := crm.CreateNote(ctx, "Follow-up Inquiry", opportunityMessage, "opportunityId", existingID); err != nil {
+					logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to add note to existing opportunity: %v", err)
+				}
+			}
+			result.OpportunityID = existingID
+			result.ReusedOpportunity = true
+		}
+	}
+
+	// Step 3b: Reopen the returning person's latest opportunity if it was
+	// closed (optional; some teams always want a fresh opportunity)
+	if envBool("REOPEN_CLOSED_OPPORTUNITY") && !leadMode && result.OpportunityID == "" && result.PersonID != "" && !result.IsNewPerson {
+		latestID, stage, err := crm.FindLatestOpportunity(ctx, result.PersonID)
+		if err != nil {
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to look up latest opportunity: %v", err)
+		} else if latestID != "" && slices.Contains(closedOpportunityStages(cfg), stage) {
+			if err := crm.UpdateOpportunityStage(ctx, latestID, initialOpportunityStage(cfg, req)); err != nil {
+				logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to reopen opportunity %s, creating a new one: %v", latestID, err)
+			} else {
+				body := fmt.Sprintf("Reopened from stage %s after a new inquiry.", stage)
+				if opportunityMessage != "" {
+					body += "\n\n" + opportunityMessage
+				}
+				if err := crm.CreateNote(ctx, "Reopened: New Inquiry", body, "opportunityId", latestID); err != nil {
+					logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to add note to reopened opportunity: %v", err)
+				}
+				result.OpportunityID = latestID
+				result.ReopenedOpportunity = true
+			}
+		}
+	}
+
+	// Step 3c: Group with a recent open opportunity from the same company,
+	// recording this person on it instead of opening a separate one (optional)
+	if window := companyOpportunityWindow(); !leadMode && window > 0 && result.OpportunityID == "" && result.CompanyID != "" {
+		existingID, err := crm.FindRecentOpenOpportunity(ctx, "companyId", result.CompanyID, systemClock.Now().Add(-window))
+		if err != nil {
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to look up recent company opportunities: %v", err)
+		} else if existingID != "" {
+			body := strings.TrimSpace(contactDetailsMarkdown(req) + "\n\n" + opportunityMessage)
+			if err := crm.CreateNote(ctx, "Additional Contact", body, "opportunityId", existingID); err != nil {
+				logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to add contact note to company opportunity, creating a new one: %v", err)
+			} else {
+				result.OpportunityID = existingID
+				result.GroupedWithCompany = true
+			}
+		}
+	}
+
+	// Step 4: Create Opportunity
+	if !leadMode && result.OpportunityID == "" {
+		// Tell repeat opportunities apart when names would collide (optional)
+		if cfg.OpportunityNameDisambiguate != "" {
+			existing, err := crm.CountSameNamedOpportunities(ctx, opportunityName, result.PersonID, result.CompanyID)
+			if err != nil {
+				logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to check for same-named opportunities: %v", err)
+			} else {
+				opportunityName = disambiguateOpportunityName(opportunityName, cfg.OpportunityNameDisambiguate, existing, systemClock.Now())
+			}
+		}
+
+		if result.OwnerID == "" {
+			ownerID, err := nextOpportunityOwner(cfg)
+			if err != nil {
+				logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to pick opportunity owner: %v", err)
+			}
+			result.OwnerID = ownerID
+		}
+
+		opportunityID, err := crm.CreateOpportunity(ctx, opportunityName, opportunityMessage, initialOpportunityStage(cfg, req), result.PersonID, result.CompanyID, result.OwnerID, opportunityCustomFields(cfg, req, result, opportunityMessage))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create opportunity: %w", err)
+		}
+		result.OpportunityID = opportunityID
+	}
+
+	// Record a differing submitted name on the opportunity (best-effort)
+	targetField, targetID := "opportunityId", result.OpportunityID
+	if leadMode {
+		targetField, targetID = "leadId", result.LeadID
+	}
+	if result.AlternateName != "" && targetID != "" {
+		body := fmt.Sprintf("This lead was submitted under the name **%s**, which differs from the name stored on the contact.", result.AlternateName)
+		if err := crm.CreateNote(ctx, "Alternate Name", body, targetField, targetID); err != nil {
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to record alternate name: %v", err)
+		}
+	}
+
+	// Step 5: Create a follow-up task (optional, best-effort)
+	if envBool("CREATE_FOLLOWUP_TASK") && result.TaskID == "" {
+		taskID, err := crm.CreateTask(ctx, fmt.Sprintf("Follow up with %s", req.Name), result.PersonID, result.OpportunityID)
+		if err != nil {
+			logEvent("crm_step_failed", leadLogFields(req.Email, result, err), "Warning: Failed to create follow-up task: %v", err)
+		} else {
+			result.TaskID = taskID
+		}
+	}
+
+	metricLeadsCreated.Inc()
+	return result, nil
+}
+
+// messageOrPlaceholder returns the message, or for a blank message the
+// EMPTY_MESSAGE_PLACEHOLDER text when EMPTY_MESSAGE_MODE=placeholder. In the
+// default "omit" mode a blank message yields "" so callers can leave the
+// message section or note out entirely.
+func messageOrPlaceholder(cfg *Config, message string) string {
+	if strings.TrimSpace(message) != "" {
+		return message
+	}
+	if cfg.EmptyMessageMode != "placeholder" {
+		return ""
+	}
+	if placeholder := cfg.EmptyMessagePlaceholder; placeholder != "" {
+		return placeholder
+	}
+	return "(no message provided)"
+}
+
+// orphanOpportunityMode controls what happens when no person could be created.
+// "skip" (default) fails the lead, "embed" creates the opportunity anyway with
+// the contact details in its note.
+func orphanOpportunityMode(cfg *Config) string {
+	if cfg.OpportunityWithoutContact == "embed" {
+		return "embed"
+	}
+	return "skip"
+}
+
+// contactDetailsMarkdown renders the submitter's contact details for a note
+func contactDetailsMarkdown(req ContactRequest) string {
+	var b strings.Builder
+	b.WriteString("**Contact details**\n\n")
+	fmt.Fprintf(&b, "- Name: %s\n", req.Name)
+	fmt.Fprintf(&b, "- Email: %s\n", req.Email)
+	if req.Phone != "" {
+		fmt.Fprintf(&b, "- Phone: %s\n", req.Phone)
+	}
+	if req.Company != "" {
+		fmt.Fprintf(&b, "- Company: %s\n", req.Company)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func findOrCreateCompany(ctx context.Context, cfg *Config, name, website string, employees int) (string, error) {
+	// First, search for existing company by name
+	searchQuery := `
+		query FindCompany($filter: CompanyFilterInput) {
+			companies(filter: $filter) {
+				edges {
+					node {
+						id
+						name
+						domainName {
+							primaryLinkUrl
+						}
+					}
+				}
+			}
+		}
+	`
+
+	filter := map[string]interface{}{
+		"name": map[string]interface{}{
+			"ilike": "%" + name + "%",
+		},
+	}
+
+	// With the merge queue on, also look for companies with the same domain
+	// so duplicates stored under other names are detected
+	mergeQueue := envBool("COMPANY_MERGE_QUEUE")
+	if host := companyHost(website); mergeQueue && host != "" {
+		filter = map[string]interface{}{
+			"or": []map[string]interface{}{
+				filter,
+				{"domainName": map[string]interface{}{
+					"primaryLinkUrl": map[string]interface{}{"ilike": "%" + host + "%"},
+				}},
+			},
+		}
+	}
+
+	searchVars := map[string]interface{}{
+		"filter": filter,
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, searchQuery, searchVars, searchCall())
+	if err == nil {
+		var searchResult struct {
+			Companies struct {
+				Edges []struct {
+					Node struct {
+						ID         string `json:"id"`
+						Name       string `json:"name"`
+						DomainName struct {
+							PrimaryLinkURL string `json:"primaryLinkUrl"`
+						} `json:"domainName"`
+					} `json:"node"`
+				} `json:"edges"`
+			} `json:"companies"`
+		}
+
+		if err := json.Unmarshal(resp.Data, &searchResult); err == nil {
+			var matches []CompanyMatch
+			for _, edge := range searchResult.Companies.Edges {
+				matches = append(matches, CompanyMatch{ID: edge.Node.ID, Name: edge.Node.Name, Domain: edge.Node.DomainName.PrimaryLinkURL})
+			}
+
+			if len(matches) > 0 && !mergeQueue {
+				return matches[0].ID, nil
+			}
+			if len(matches) > 0 {
+				best, candidates, ambiguous := bestCompanyMatch(matches, name, website)
+				if ambiguous {
+					queueCompanyMerge(name, website, candidates, best.ID)
+				}
+				return best.ID, nil
+			}
+		}
+	}
+
+	// Create new company if not found
+	createQuery := `
+		mutation CreateCompany($input: CompanyCreateInput!) {
+			createCompany(data: $input) {
+				id
+			}
+		}
+	`
+
+	createVars := map[string]interface{}{
+		"input": companyCreateInput(name, website, employees),
+	}
+
+	resp, err = executeTwentyGraphQL(ctx, cfg, createQuery, createVars, mutationCall())
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		CreateCompany struct {
+			ID string `json:"id"`
+		} `json:"createCompany"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse company response: %w", err)
+	}
+
+	return result.CreateCompany.ID, nil
+}
+
+// companyCreateInput returns the fields for a new company. The name is
+// tidied for display here only (off by default), so searches for existing
+// companies keep using the name as submitted.
+func companyCreateInput(name, website string, employees int) map[string]interface{} {
+	input := map[string]interface{}{
+		"name": normalizeCompanyName(name),
+	}
+
+	if employees > 0 {
+		input["employees"] = employees
+	}
+
+	// website is expected to be normalized already (see normalizeURL)
+	if website != "" {
+		input["domainName"] = map[string]interface{}{
+			"primaryLinkUrl": website,
+		}
+	}
+
+	return input
+}
+
+// findPersonByEmail returns the ID of the person with the given email, or ""
+// if there is none. The match is exact, like the REST client's: ilike would
+// treat "_" and "%" in addresses as wildcards.
+func findPersonByEmail(ctx context.Context, cfg *Config, email string) (string, error) {
+	searchQuery := `
+		query FindPerson($filter: PersonFilterInput) {
+			people(filter: $filter) {
+				edges {
+					node {
+						id
+						emails {
+							primaryEmail
+						}
+					}
+				}
+			}
+		}
+	`
+
+	searchVars := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"emails": map[string]interface{}{
+				"primaryEmail": map[string]interface{}{
+					"eq": email,
+				},
+			},
+		},
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, searchQuery, searchVars, searchCall())
+	if err != nil {
+		return "", err
+	}
+
+	var searchResult struct {
+		People struct {
+			Edges []struct {
+				Node struct {
+					ID     string `json:"id"`
+					Emails struct {
+						PrimaryEmail string `json:"primaryEmail"`
+					} `json:"emails"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"people"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &searchResult); err != nil {
+		return "", fmt.Errorf("failed to parse person search response: %w", err)
+	}
+
+	if len(searchResult.People.Edges) == 0 {
+		return "", nil
+	}
+	return searchResult.People.Edges[0].Node.ID, nil
+}
+
+// isDuplicateError reports whether a Twenty error looks like a uniqueness
+// constraint violation
+func isDuplicateError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "duplicate") || strings.Contains(msg, "unique") || strings.Contains(msg, "already exists")
+}
+
+func findOrCreatePerson(ctx context.Context, cfg *Config, firstName, lastName, email, phone, jobTitle, companyID string, extraFields map[string]interface{}) (string, bool, error) {
+	// Search for existing person by email
+	if personID, err := findPersonByEmail(ctx, cfg, email); err == nil && personID != "" {
+		return personID, false, nil
+	}
+	searchPhone := func(ctx context.Context, phone string) (string, error) {
+		return findPersonByPhone(ctx, cfg, phone)
+	}
+	if personID := findExistingPersonByPhone(ctx, phone, searchPhone); personID != "" {
+		return personID, false, nil
+	}
+
+	// Create new person if not found
+	createQuery := `
 		mutation CreatePerson($input: PersonCreateInput!) {
 			createPerson(data: $input) {
 				id
@@ -355,6 +1525,38 @@ func findOrCreatePerson(apiURL, apiKey, firstName, lastName, email, phone, compa
 		}
 	`
 
+	createVars := map[string]interface{}{
+		"input": personCreateInput(cfg, firstName, lastName, email, phone, jobTitle, companyID, extraFields),
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, createQuery, createVars, mutationCall())
+	if err != nil {
+		// A concurrent submission for the same email may have created the
+		// person between our search and create; use theirs if so
+		if isDuplicateError(err) && envBoolDefault("PERSON_DUPLICATE_RETRY", true) {
+			if personID, searchErr := findPersonByEmail(ctx, cfg, email); searchErr == nil && personID != "" {
+				log.Printf("Person for %s was created concurrently, using existing record", email)
+				return personID, false, nil
+			}
+		}
+		return "", false, err
+	}
+
+	var result struct {
+		CreatePerson struct {
+			ID string `json:"id"`
+		} `json:"createPerson"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", false, fmt.Errorf("failed to parse person response: %w", err)
+	}
+
+	return result.CreatePerson.ID, true, nil
+}
+
+// personCreateInput returns the fields for a new person
+func personCreateInput(cfg *Config, firstName, lastName, email, phone, jobTitle, companyID string, extraFields map[string]interface{}) map[string]interface{} {
 	input := map[string]interface{}{
 		"name": map[string]interface{}{
 			"firstName": firstName,
@@ -365,52 +1567,552 @@ func findOrCreatePerson(apiURL, apiKey, firstName, lastName, email, phone, compa
 		},
 	}
 
-	// Normalize phone to E.164 format for Twenty CRM
-	normalizedPhone := normalizePhone(phone)
-	if normalizedPhone != "" {
-		input["phones"] = map[string]interface{}{
-			"primaryPhoneNumber": normalizedPhone,
-		}
+	// Normalize phone to E.164 format for Twenty CRM
+	normalizedPhone := normalizePhone(phone, defaultPhoneCountry(cfg))
+	if normalizedPhone != "" {
+		input["phones"] = map[string]interface{}{
+			"primaryPhoneNumber": normalizedPhone,
+		}
+	}
+
+	if jobTitle != "" {
+		input["jobTitle"] = jobTitle
+	}
+
+	if companyID != "" {
+		input["companyId"] = companyID
+	}
+
+	for field, value := range extraFields {
+		input[field] = value
+	}
+
+	return input
+}
+
+// opportunityReuseWindow returns OPPORTUNITY_REUSE_WINDOW, how far back an
+// open opportunity for the same person is reused instead of creating a new
+// one; zero (default) disables reuse
+func opportunityReuseWindow() time.Duration {
+	return envDuration("OPPORTUNITY_REUSE_WINDOW", 0)
+}
+
+// companyOpportunityWindow returns COMPANY_OPPORTUNITY_WINDOW, how recent
+// an open opportunity from the same company must be for a new person's
+// inquiry to join it; zero (default) always creates separate opportunities
+func companyOpportunityWindow() time.Duration {
+	return envDuration("COMPANY_OPPORTUNITY_WINDOW", 0)
+}
+
+// closedOpportunityStages returns the stages that count as closed
+// (OPPORTUNITY_CLOSED_STAGES, comma-separated, default "CUSTOMER")
+func closedOpportunityStages(cfg *Config) []string {
+	if len(cfg.OpportunityClosedStages) > 0 {
+		return cfg.OpportunityClosedStages
+	}
+	return []string{"CUSTOMER"}
+}
+
+// findLatestOpportunity returns the ID and stage of the person's most
+// recently created opportunity, or "" if they have none
+func findLatestOpportunity(ctx context.Context, cfg *Config, personID string) (string, string, error) {
+	query := `
+		query FindLatestOpportunity($filter: OpportunityFilterInput, $orderBy: [OpportunityOrderByInput]) {
+			opportunities(filter: $filter, orderBy: $orderBy, first: 1) {
+				edges {
+					node {
+						id
+						stage
+					}
+				}
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"pointOfContactId": map[string]interface{}{
+				"eq": personID,
+			},
+		},
+		"orderBy": []map[string]interface{}{
+			{"createdAt": "DescNullsLast"},
+		},
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, searchCall())
+	if err != nil {
+		return "", "", err
+	}
+
+	var result struct {
+		Opportunities struct {
+			Edges []struct {
+				Node struct {
+					ID    string `json:"id"`
+					Stage string `json:"stage"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"opportunities"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", "", fmt.Errorf("failed to parse opportunities response: %w", err)
+	}
+
+	if len(result.Opportunities.Edges) == 0 {
+		return "", "", nil
+	}
+	node := result.Opportunities.Edges[0].Node
+	return node.ID, node.Stage, nil
+}
+
+// updateOpportunityStage moves an opportunity to the given stage
+func updateOpportunityStage(ctx context.Context, cfg *Config, opportunityID, stage string) error {
+	query := `
+		mutation UpdateOpportunity($id: UUID!, $input: OpportunityUpdateInput!) {
+			updateOpportunity(id: $id, data: $input) {
+				id
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": opportunityID,
+		"input": map[string]interface{}{
+			"stage": stage,
+		},
+	}
+
+	_, err := executeTwentyGraphQL(ctx, cfg, query, variables, mutationCall())
+	return err
+}
+
+// initialOpportunityStage returns the stage new (or reopened) opportunities
+// start in: the form profile's stage, else OPPORTUNITY_STAGE (default NEW)
+// for workspaces that renamed their pipeline stages
+func initialOpportunityStage(cfg *Config, req ContactRequest) string {
+	if profile, _ := lookupFormProfile(cfg, req.FormType); profile.Stage != "" {
+		return profile.Stage
+	}
+	if cfg.OpportunityStage != "" {
+		return cfg.OpportunityStage
+	}
+	return "NEW"
+}
+
+// findRecentOpenOpportunity returns the newest opportunity whose field
+// (pointOfContactId or companyId) equals id, created since the given time
+// and not in a closed stage, or "" if none
+func findRecentOpenOpportunity(ctx context.Context, cfg *Config, field, id string, since time.Time) (string, error) {
+	query := `
+		query FindRecentOpportunities($filter: OpportunityFilterInput, $orderBy: [OpportunityOrderByInput]) {
+			opportunities(filter: $filter, orderBy: $orderBy, first: 20) {
+				edges {
+					node {
+						id
+						stage
+					}
+				}
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"filter": map[string]interface{}{
+			field: map[string]interface{}{
+				"eq": id,
+			},
+			"createdAt": map[string]interface{}{
+				"gte": since.UTC().Format(time.RFC3339),
+			},
+		},
+		"orderBy": []map[string]interface{}{
+			{"createdAt": "DescNullsLast"},
+		},
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, searchCall())
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Opportunities struct {
+			Edges []struct {
+				Node struct {
+					ID    string `json:"id"`
+					Stage string `json:"stage"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"opportunities"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse opportunities response: %w", err)
+	}
+
+	closed := closedOpportunityStages(cfg)
+	for _, edge := range result.Opportunities.Edges {
+		if !slices.Contains(closed, edge.Node.Stage) {
+			return edge.Node.ID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// nextOpportunityOwner picks the next workspace member from
+// OPPORTUNITY_OWNER_IDS (comma-separated) in round-robin order. The rotation
+// is kept in the shared store. Returns "" when no owners are configured.
+func nextOpportunityOwner(cfg *Config) (string, error) {
+	owners := cfg.OpportunityOwnerIDs
+	if len(owners) == 0 {
+		return "", nil
+	}
+
+	n, err := store.Incr("round-robin:opportunity-owner", 0)
+	if err != nil {
+		return "", err
+	}
+	return owners[(n-1)%int64(len(owners))], nil
+}
+
+// nameMismatchMode returns how a differing name on an existing person is
+// handled: "ignore" (default), "update" the person, or "note" it on the
+// opportunity
+func nameMismatchMode(cfg *Config) string {
+	switch mode := cfg.NameMismatchMode; mode {
+	case "update", "note":
+		return mode
+	default:
+		return "ignore"
+	}
+}
+
+// handleNameMismatch compares the submitted name against the one stored on
+// an existing person and applies NAME_MISMATCH_MODE. Failures are logged.
+func handleNameMismatch(ctx context.Context, cfg *Config, crm CRMClient, result *LeadResult, firstName, lastName string) {
+	mode := nameMismatchMode(cfg)
+	if mode == "ignore" {
+		return
+	}
+
+	storedFirst, storedLast, err := crm.FetchPersonName(ctx, result.PersonID)
+	if err != nil {
+		log.Printf("Warning: Failed to fetch person name: %v", err)
+		return
+	}
+
+	if strings.EqualFold(strings.TrimSpace(storedFirst), firstName) && strings.EqualFold(strings.TrimSpace(storedLast), lastName) {
+		return
+	}
+
+	switch mode {
+	case "update":
+		if err := crm.UpdatePersonName(ctx, result.PersonID, firstName, lastName); err != nil {
+			log.Printf("Warning: Failed to update person name: %v", err)
+		}
+	case "note":
+		result.AlternateName = strings.TrimSpace(firstName + " " + lastName)
+	}
+}
+
+func fetchPersonName(ctx context.Context, cfg *Config, personID string) (string, string, error) {
+	query := `
+		query FindPersonName($filter: PersonFilterInput) {
+			people(filter: $filter) {
+				edges {
+					node {
+						id
+						name {
+							firstName
+							lastName
+						}
+					}
+				}
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"id": map[string]interface{}{
+				"eq": personID,
+			},
+		},
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, searchCall())
+	if err != nil {
+		return "", "", err
+	}
+
+	var result struct {
+		People struct {
+			Edges []struct {
+				Node struct {
+					Name struct {
+						FirstName string `json:"firstName"`
+						LastName  string `json:"lastName"`
+					} `json:"name"`
+				} `json:"node"`
+			} `json:"edges"`
+		} `json:"people"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", "", fmt.Errorf("failed to parse person response: %w", err)
+	}
+
+	if len(result.People.Edges) == 0 {
+		return "", "", fmt.Errorf("person %s not found", personID)
+	}
+
+	name := result.People.Edges[0].Node.Name
+	return name.FirstName, name.LastName, nil
+}
+
+func updatePersonName(ctx context.Context, cfg *Config, personID, firstName, lastName string) error {
+	query := `
+		mutation UpdatePerson($id: UUID!, $input: PersonUpdateInput!) {
+			updatePerson(id: $id, data: $input) {
+				id
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"id": personID,
+		"input": map[string]interface{}{
+			"name": map[string]interface{}{
+				"firstName": firstName,
+				"lastName":  lastName,
+			},
+		},
+	}
+
+	_, err := executeTwentyGraphQL(ctx, cfg, query, variables, mutationCall())
+	return err
+}
+
+// leadCreateInput returns the fields for a new Lead record
+func leadCreateInput(name, service, personID, companyID string) map[string]interface{} {
+	input := map[string]interface{}{
+		"name":   name,
+		"source": "WEBSITE",
+	}
+
+	if service != "" {
+		input["service"] = service
+	}
+
+	if personID != "" {
+		input["personId"] = personID
+	}
+
+	if companyID != "" {
+		input["companyId"] = companyID
+	}
+
+	return input
+}
+
+// createTwentyLeadObject creates a record in Twenty's Lead object, used
+// instead of an opportunity in CRM_LEAD_MODE. The description goes into a
+// note linked to the lead.
+func createTwentyLeadObject(ctx context.Context, cfg *Config, name, description, service, personID, companyID string) (string, error) {
+	query := `
+		mutation CreateLead($input: LeadCreateInput!) {
+			createLead(data: $input) {
+				id
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"input": leadCreateInput(name, service, personID, companyID),
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, mutationCall())
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		CreateLead struct {
+			ID string `json:"id"`
+		} `json:"createLead"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse lead response: %w", err)
+	}
+
+	leadID := result.CreateLead.ID
+
+	if description != "" && leadID != "" {
+		if err := createTwentyNoteFor(ctx, cfg, "Project Details", description, "leadId", leadID); err != nil {
+			log.Printf("Warning: Failed to create note for lead: %v", err)
+		}
+	}
+
+	return leadID, nil
+}
+
+// opportunityCustomFields returns the workspace-specific opportunity fields
+// for a lead. Each is only written when its field name is configured, since
+// the mutation fails on fields the workspace doesn't have. description is
+// the rendered OPPORTUNITY_DESC_TEMPLATE.
+func opportunityCustomFields(cfg *Config, req ContactRequest, result *LeadResult, description string) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if field := cfg.OpportunityDescriptionField; field != "" && description != "" {
+		fields[field] = description
+	}
+
+	if field := cfg.GeoIPOpportunityField; field != "" && req.Location != nil {
+		fields[field] = req.Location.String()
+	}
+
+	if field := cfg.TwentyReferralField; field != "" && req.ReferralSource != "" {
+		fields[field] = req.ReferralSource
+	}
+
+	if field := cfg.ReferrerChainField; field != "" && len(req.ReferrerChain) > 0 {
+		fields[field] = strings.Join(req.ReferrerChain, "\n")
+	}
+
+	if field := cfg.PriorInquiriesField; field != "" && result.PriorInquiries > 0 {
+		fields[field] = result.PriorInquiries
+	}
+
+	for field, value := range environmentFields(cfg) {
+		fields[field] = value
+	}
+
+	if field := cfg.PhoneCountryMismatchField; field != "" {
+		if warning := phoneCountryWarning(req); warning != "" {
+			fields[field] = warning
+		}
+	}
+
+	return fields
+}
+
+// countPersonOpportunities returns how many opportunities the person is the
+// point of contact for
+func countPersonOpportunities(ctx context.Context, cfg *Config, personID string) (int, error) {
+	query := `
+		query CountOpportunities($filter: OpportunityFilterInput) {
+			opportunities(filter: $filter) {
+				totalCount
+			}
+		}
+	`
+
+	variables := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"pointOfContactId": map[string]interface{}{
+				"eq": personID,
+			},
+		},
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, searchCall())
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Opportunities struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"opportunities"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse opportunity count: %w", err)
 	}
 
+	return result.Opportunities.TotalCount, nil
+}
+
+// countSameNamedOpportunities returns how many of the person's or company's
+// opportunities are named name, including ones already numbered "name #N"
+func countSameNamedOpportunities(ctx context.Context, cfg *Config, name, personID, companyID string) (int, error) {
+	query := `
+		query CountOpportunities($filter: OpportunityFilterInput) {
+			opportunities(filter: $filter) {
+				totalCount
+			}
+		}
+	`
+
+	var owners []map[string]interface{}
+	if personID != "" {
+		owners = append(owners, map[string]interface{}{"pointOfContactId": map[string]interface{}{"eq": personID}})
+	}
 	if companyID != "" {
-		input["companyId"] = companyID
+		owners = append(owners, map[string]interface{}{"companyId": map[string]interface{}{"eq": companyID}})
+	}
+	if len(owners) == 0 {
+		return 0, nil
 	}
 
-	createVars := map[string]interface{}{
-		"input": input,
+	variables := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"and": []map[string]interface{}{
+				{"or": []map[string]interface{}{
+					{"name": map[string]interface{}{"eq": name}},
+					{"name": map[string]interface{}{"like": name + " #%"}},
+				}},
+				{"or": owners},
+			},
+		},
 	}
 
-	resp, err = executeTwentyGraphQL(apiURL, apiKey, createQuery, createVars)
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, searchCall())
 	if err != nil {
-		return "", false, err
+		return 0, err
 	}
 
 	var result struct {
-		CreatePerson struct {
-			ID string `json:"id"`
-		} `json:"createPerson"`
+		Opportunities struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"opportunities"`
 	}
 
 	if err := json.Unmarshal(resp.Data, &result); err != nil {
-		return "", false, fmt.Errorf("failed to parse person response: %w", err)
+		return 0, fmt.Errorf("failed to parse opportunity count: %w", err)
 	}
 
-	return result.CreatePerson.ID, true, nil
+	return result.Opportunities.TotalCount, nil
 }
 
-func createTwentyOpportunity(apiURL, apiKey, name, message, personID, companyID string) (string, error) {
-	query := `
-		mutation CreateOpportunity($input: OpportunityCreateInput!) {
-			createOpportunity(data: $input) {
-				id
-			}
-		}
-	`
+// disambiguateOpportunityName suffixes name when existing opportunities
+// already use it. mode (OPPORTUNITY_NAME_DISAMBIGUATE) selects the suffix:
+// "date" appends the submission date, "number" appends the next "#N". Empty
+// (the default) keeps duplicate names.
+func disambiguateOpportunityName(name, mode string, existing int, now time.Time) string {
+	if existing == 0 {
+		return name
+	}
 
+	switch mode {
+	case "date":
+		return fmt.Sprintf("%s (%s)", name, now.UTC().Format("2006-01-02"))
+	case "number":
+		return fmt.Sprintf("%s #%d", name, existing+1)
+	}
+	return name
+}
+
+// opportunityCreateInput returns the fields for a new opportunity, assigning
+// ownerID when set
+func opportunityCreateInput(name, stage, personID, companyID, ownerID string, customFields map[string]interface{}) map[string]interface{} {
 	input := map[string]interface{}{
 		"name":  name,
-		"stage": "NEW",
+		"stage": stage,
 	}
 
 	if personID != "" {
@@ -421,11 +2123,31 @@ func createTwentyOpportunity(apiURL, apiKey, name, message, personID, companyID
 		input["companyId"] = companyID
 	}
 
+	for field, value := range customFields {
+		input[field] = value
+	}
+
+	if ownerID != "" {
+		input["ownerId"] = ownerID
+	}
+
+	return input
+}
+
+func createTwentyOpportunity(ctx context.Context, cfg *Config, name, message, stage, personID, companyID, ownerID string, customFields map[string]interface{}) (string, error) {
+	query := `
+		mutation CreateOpportunity($input: OpportunityCreateInput!) {
+			createOpportunity(data: $input) {
+				id
+			}
+		}
+	`
+
 	variables := map[string]interface{}{
-		"input": input,
+		"input": opportunityCreateInput(name, stage, personID, companyID, ownerID, customFields),
 	}
 
-	resp, err := executeTwentyGraphQL(apiURL, apiKey, query, variables)
+	resp, err := executeTwentyGraphQL(ctx, cfg, query, variables, mutationCall())
 	if err != nil {
 		return "", err
 	}
@@ -444,7 +2166,7 @@ func createTwentyOpportunity(apiURL, apiKey, name, message, personID, companyID
 
 	// Create a note with the message if provided
 	if message != "" && opportunityID != "" {
-		if err := createTwentyNote(apiURL, apiKey, "Project Details", message, opportunityID); err != nil {
+		if err := createTwentyNote(ctx, cfg, "Project Details", message, opportunityID); err != nil {
 			log.Printf("Warning: Failed to create note for opportunity: %v", err)
 		}
 	}
@@ -452,7 +2174,49 @@ func createTwentyOpportunity(apiURL, apiKey, name, message, personID, companyID
 	return opportunityID, nil
 }
 
-func createTwentyNote(apiURL, apiKey, title, body, opportunityID string) error {
+// noteMaxLength returns the maximum note body length in characters (default 5000)
+func noteMaxLength(cfg *Config) int {
+	if cfg.NoteMaxLength > 0 {
+		return cfg.NoteMaxLength
+	}
+	return 5000
+}
+
+// sanitizeNoteBody makes a body safe for Twenty's rich-text note editor.
+// Invalid UTF-8 and control characters (other than newlines and tabs) are
+// dropped, line endings are normalized, and bodies longer than maxLen
+// characters are truncated with an ellipsis and a marker.
+func sanitizeNoteBody(body string, maxLen int) string {
+	body = strings.ToValidUTF8(body, "")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == '\u200b' || r == '\ufeff' {
+			return -1
+		}
+		return r
+	}, body)
+
+	runes := []rune(body)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return body
+	}
+	return strings.TrimRightFunc(string(runes[:maxLen]), unicode.IsSpace) + "…\n\n_(truncated)_"
+}
+
+func createTwentyNote(ctx context.Context, cfg *Config, title, body, opportunityID string) error {
+	return createTwentyNoteFor(ctx, cfg, title, body, "opportunityId", opportunityID)
+}
+
+// createTwentyNoteFor creates a note linked to the record whose ID is given
+// by targetField (e.g. "opportunityId", "personId", "leadId")
+func createTwentyNoteFor(ctx context.Context, cfg *Config, title, body, targetField, targetID string) error {
+	// The full message still goes out in the email; the note only needs to
+	// stay readable in the CRM
+	body = sanitizeNoteBody(body, noteMaxLength(cfg))
+
 	// Step 1: Create the note
 	noteQuery := `
 		mutation CreateNote($input: NoteCreateInput!) {
@@ -473,7 +2237,7 @@ func createTwentyNote(apiURL, apiKey, title, body, opportunityID string) error {
 		"input": noteInput,
 	}
 
-	noteResp, err := executeTwentyGraphQL(apiURL, apiKey, noteQuery, noteVars)
+	noteResp, err := executeTwentyGraphQL(ctx, cfg, noteQuery, noteVars, mutationCall())
 	if err != nil {
 		return fmt.Errorf("failed to create note: %w", err)
 	}
@@ -490,7 +2254,7 @@ func createTwentyNote(apiURL, apiKey, title, body, opportunityID string) error {
 
 	noteID := noteResult.CreateNote.ID
 
-	// Step 2: Link the note to the opportunity via NoteTarget
+	// Step 2: Link the note to its record via NoteTarget
 	targetQuery := `
 		mutation CreateNoteTarget($input: NoteTargetCreateInput!) {
 			createNoteTarget(data: $input) {
@@ -501,20 +2265,167 @@ func createTwentyNote(apiURL, apiKey, title, body, opportunityID string) error {
 
 	targetVars := map[string]interface{}{
 		"input": map[string]interface{}{
-			"noteId":        noteID,
-			"opportunityId": opportunityID,
+			"noteId":    noteID,
+			targetField: targetID,
 		},
 	}
 
-	_, err = executeTwentyGraphQL(apiURL, apiKey, targetQuery, targetVars)
+	_, err = executeTwentyGraphQL(ctx, cfg, targetQuery, targetVars, mutationCall())
 	if err != nil {
-		return fmt.Errorf("failed to link note to opportunity: %w", err)
+		return fmt.Errorf("failed to link note to %s: %w", strings.TrimSuffix(targetField, "Id"), err)
 	}
 
 	return nil
 }
 
-func executeTwentyGraphQL(apiURL, apiKey, query string, variables map[string]interface{}) (*GraphQLResponse, error) {
+// followUpTaskDue returns how long after submission the follow-up task is due (default 24h)
+func followUpTaskDue(cfg *Config) time.Duration {
+	if cfg.FollowUpTaskDueHours > 0 {
+		return time.Duration(cfg.FollowUpTaskDueHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// taskCreateInput returns the fields for a new follow-up task
+func taskCreateInput(cfg *Config, title string) map[string]interface{} {
+	input := map[string]interface{}{
+		"title":  title,
+		"status": "TODO",
+		"dueAt":  systemClock.Now().Add(followUpTaskDue(cfg)).UTC().Format(time.RFC3339),
+	}
+
+	if assigneeID := cfg.FollowUpTaskAssigneeID; assigneeID != "" {
+		input["assigneeId"] = assigneeID
+	}
+
+	return input
+}
+
+// taskTargets returns the links for a new task to the person and opportunity
+func taskTargets(taskID, personID, opportunityID string) []map[string]interface{} {
+	targets := []map[string]interface{}{}
+	if personID != "" {
+		targets = append(targets, map[string]interface{}{"taskId": taskID, "personId": personID})
+	}
+	if opportunityID != "" {
+		targets = append(targets, map[string]interface{}{"taskId": taskID, "opportunityId": opportunityID})
+	}
+	return targets
+}
+
+func createTwentyTask(ctx context.Context, cfg *Config, title, personID, opportunityID string) (string, error) {
+	// Step 1: Create the task
+	taskQuery := `
+		mutation CreateTask($input: TaskCreateInput!) {
+			createTask(data: $input) {
+				id
+			}
+		}
+	`
+
+	taskVars := map[string]interface{}{
+		"input": taskCreateInput(cfg, title),
+	}
+
+	taskResp, err := executeTwentyGraphQL(ctx, cfg, taskQuery, taskVars, mutationCall())
+	if err != nil {
+		return "", fmt.Errorf("failed to create task: %w", err)
+	}
+
+	var taskResult struct {
+		CreateTask struct {
+			ID string `json:"id"`
+		} `json:"createTask"`
+	}
+
+	if err := json.Unmarshal(taskResp.Data, &taskResult); err != nil {
+		return "", fmt.Errorf("failed to parse task response: %w", err)
+	}
+
+	taskID := taskResult.CreateTask.ID
+
+	// Step 2: Link the task to the person and opportunity via TaskTarget
+	targetQuery := `
+		mutation CreateTaskTarget($input: TaskTargetCreateInput!) {
+			createTaskTarget(data: $input) {
+				id
+			}
+		}
+	`
+
+	for _, target := range taskTargets(taskID, personID, opportunityID) {
+		targetVars := map[string]interface{}{
+			"input": target,
+		}
+		if _, err := executeTwentyGraphQL(ctx, cfg, targetQuery, targetVars, mutationCall()); err != nil {
+			return taskID, fmt.Errorf("failed to link task: %w", err)
+		}
+	}
+
+	return taskID, nil
+}
+
+// graphQLOptions tunes a single executeTwentyGraphQL call
+type graphQLOptions struct {
+	timeout time.Duration
+}
+
+// GraphQLOption configures a single executeTwentyGraphQL call
+type GraphQLOption func(*graphQLOptions)
+
+// withTimeout bounds the call to d
+func withTimeout(d time.Duration) GraphQLOption {
+	return func(o *graphQLOptions) {
+		o.timeout = d
+	}
+}
+
+// envDuration returns the duration in the env var (or its feature flag), or
+// def when it is unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(flagValue(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// searchCall is the option for read queries (TWENTY_SEARCH_TIMEOUT, default 10s)
+func searchCall() GraphQLOption {
+	return withTimeout(envDuration("TWENTY_SEARCH_TIMEOUT", 10*time.Second))
+}
+
+// mutationCall is the option for writes (TWENTY_MUTATION_TIMEOUT, default 30s)
+func mutationCall() GraphQLOption {
+	return withTimeout(envDuration("TWENTY_MUTATION_TIMEOUT", 30*time.Second))
+}
+
+// validateCRMURL requires an https URL, unless ALLOW_INSECURE_CRM is set for
+// local development
+func validateCRMURL(apiURL string) error {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme == "https" || (u.Scheme == "http" && envBool("ALLOW_INSECURE_CRM")) {
+		return nil
+	}
+	return fmt.Errorf("%s URLs are not allowed, use https (or set ALLOW_INSECURE_CRM for local development)", u.Scheme)
+}
+
+func executeTwentyGraphQL(ctx context.Context, cfg *Config, query string, variables map[string]interface{}, opts ...GraphQLOption) (gqlResp *GraphQLResponse, err error) {
+	// One span per call, covering all of its attempts
+	ctx, span := startSpan(ctx, "twenty.graphql", attribute.String("graphql.operation.name", graphQLOperationName(query)))
+	defer func() { endSpan(span, err) }()
+
+	if err := validateCRMURL(cfg.TwentyAPIURL); err != nil {
+		return nil, err
+	}
+
+	options := graphQLOptions{timeout: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	reqBody := GraphQLRequest{
 		Query:     query,
 		Variables: variables,
@@ -525,75 +2436,400 @@ func executeTwentyGraphQL(apiURL, apiKey, query string, variables map[string]int
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// The timeout bounds all attempts together, including backoff waits
+	ctx, cancel := context.WithTimeout(ctx, options.timeout)
 	defer cancel()
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL+"/graphql", bytes.NewBuffer(jsonBody))
+	start := systemClock.Now()
+	defer func() { metricGraphQLDuration.Observe(systemClock.Now().Sub(start).Seconds()) }()
+
+	attempts := twentyRequestAttempts(cfg)
+	backoff := twentyRetryBackoff(cfg)
+	mutation := isGraphQLMutation(query)
+	for attempt := 1; ; attempt++ {
+		gqlResp, retryable, err := postTwentyGraphQL(ctx, cfg, jsonBody, mutation)
+		if err == nil || !retryable || attempt >= attempts {
+			span.SetAttributes(attribute.Int("attempts", attempt))
+			return gqlResp, err
+		}
+
+		select {
+		case <-systemClock.After(backoff.Delay(attempt)):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// twentyRequestAttempts returns TWENTY_REQUEST_ATTEMPTS, how many times a
+// single Twenty request is tried on transient failures (default 3; 1
+// disables retries). Delays follow twentyRetryBackoff.
+func twentyRequestAttempts(cfg *Config) int {
+	if cfg.TwentyRequestAttempts > 0 {
+		return cfg.TwentyRequestAttempts
+	}
+	return 3
+}
+
+// twentyRetryBackoff returns the delays between Twenty request attempts:
+// exponential from TWENTY_RETRY_BASE_DELAY (default 200ms), with the
+// RETRY_BACKOFF jitter strategy and RETRY_MAX_DELAY cap
+func twentyRetryBackoff(cfg *Config) Backoff {
+	backoff := retryBackoff(cfg)
+	backoff.Base = envDuration("TWENTY_RETRY_BASE_DELAY", 200*time.Millisecond)
+	return backoff
+}
+
+// graphQLOperationPattern matches the operation type and name at the start
+// of a GraphQL document
+var graphQLOperationPattern = regexp.MustCompile(`^\s*(query|mutation)\s+(\w+)`)
+
+// graphQLOperationName returns the operation name of a GraphQL document
+// (e.g. "CreateOpportunity"), or "anonymous" if it has none
+func graphQLOperationName(query string) string {
+	if m := graphQLOperationPattern.FindStringSubmatch(query); m != nil {
+		return m[2]
+	}
+	return "anonymous"
+}
+
+// isGraphQLMutation reports whether a GraphQL document is a mutation
+func isGraphQLMutation(query string) bool {
+	return strings.HasPrefix(strings.TrimSpace(query), "mutation")
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying:
+// rate limiting and server errors, but not other client errors
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// isDialError reports whether err happened while connecting, i.e. before
+// anything was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// postTwentyGraphQL makes one GraphQL request. It also reports whether a
+// failure is transient: connection errors, 429 and 5xx are; other 4xx
+// responses and GraphQL errors are not. A mutation may already have been
+// applied when a 5xx or a broken response comes back, and retrying it would
+// create the record twice, so mutations are only retried when the request
+// never reached Twenty (a dial error) or was rate limited.
+func postTwentyGraphQL(ctx context.Context, cfg *Config, jsonBody []byte, mutation bool) (*GraphQLResponse, bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", cfg.TwentyAPIURL+"/graphql", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	httpReq.Header.Set("Authorization", "Bearer "+cfg.TwentyAPIKey)
 
-	client := &http.Client{}
-	httpResp, err := client.Do(httpReq)
+	httpResp, err := twentyHTTPClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		// Out of time means out of retries too
+		retryable := ctx.Err() == nil && (!mutation || isDialError(err))
+		return nil, retryable, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer httpResp.Body.Close()
 
 	body, err := io.ReadAll(httpResp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, ctx.Err() == nil && !mutation, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(body))
+		retryable := retryableStatus(httpResp.StatusCode)
+		if mutation {
+			retryable = httpResp.StatusCode == http.StatusTooManyRequests
+		}
+		return nil, retryable, fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(body))
 	}
 
 	var gqlResp GraphQLResponse
 	if err := json.Unmarshal(body, &gqlResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, false, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if len(gqlResp.Errors) > 0 {
-		return nil, fmt.Errorf("graphql error: %s", gqlResp.Errors[0].Message)
+		return nil, false, fmt.Errorf("graphql error: %s", gqlResp.Errors[0].Message)
 	}
 
-	return &gqlResp, nil
+	return &gqlResp, false, nil
 }
 
-func sendNotificationEmail(req ContactRequest, lead *LeadResult) error {
-	apiKey := os.Getenv("MAILGUN_API_KEY")
-	domain := os.Getenv("MAILGUN_DOMAIN")
-	recipient := os.Getenv("CONTACT_EMAIL")
-	crmURL := os.Getenv("TWENTY_API_URL")
-
+func sendNotificationEmail(cfg *Config, req ContactRequest, lead *LeadResult) error {
+	apiKey := cfg.MailgunAPIKey
+	domain := cfg.MailgunDomain
+	recipient := notificationRecipient(cfg, req.Service)
+	if profile, _ := lookupFormProfile(cfg, req.FormType); profile.Recipient != "" {
+		recipient = profile.Recipient
+	}
 	if apiKey == "" || domain == "" {
 		return fmt.Errorf("mailgun configuration missing")
 	}
 
-	if recipient == "" {
-		recipient = "john@sogos.io"
+	mg := mailgun.NewMailgun(domain, apiKey)
+
+	subject := notificationSubject(cfg, req)
+
+	// Suppress repeat notifications for the same person and service
+	throttleKey, throttled := throttleNotification(cfg, req)
+	if throttled {
+		suppressions.Record(dedupThrottle)
+		logEvent("email_suppressed", append(leadLogFields(req.Email, lead, nil), "service", req.Service), "Suppressed duplicate notification email for %s (%s)", req.Email, req.Service)
+		return nil
 	}
 
-	mg := mailgun.NewMailgun(domain, apiKey)
+	// Digest mode batches notifications into a periodic summary email
+	if digest != nil {
+		digest.Add(recipient, req, lead)
+		return nil
+	}
 
-	subject := fmt.Sprintf("🎯 New Lead: %s", req.Name)
+	send := func(body, html string, recipients ...string) error {
+		subject, recipients, err := applyMailgunSandbox(cfg, subject, recipients)
+		if err != nil {
+			return err
+		}
 
-	// Build CRM link if we have an opportunity ID
-	crmLink := ""
-	if lead != nil && lead.OpportunityID != "" {
-		crmLink = fmt.Sprintf("\n\n📊 View in CRM: %s/object/opportunity/%s", crmURL, lead.OpportunityID)
+		m := mg.NewMessage(
+			fmt.Sprintf("Sogos CRM <noreply@%s>", domain),
+			subject,
+			body,
+			recipients...,
+		)
+
+		// HTML alternative; the plain text stays as the multipart fallback
+		if html != "" {
+			m.SetHtml(html)
+		}
+
+		// Reply to the submitter, unless their email can't receive replies
+		if replyTo := replyToAddress(cfg, req.Email); replyTo != "" {
+			m.SetReplyTo(replyTo)
+		}
+
+		// Attach the lead as a contact card when NOTIFICATION_VCARD is set
+		if envBool("NOTIFICATION_VCARD") {
+			m.AddBufferAttachment(vcardFilename(req), []byte(buildVCard(cfg, req)))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		_, _, err = mg.Send(ctx, m)
+		return err
+	}
+
+	if err := send(buildNotificationBody(cfg, req, lead, true), buildNotificationHTML(cfg, req, lead, true), recipient); err != nil {
+		// Release the throttle so a retry can still notify
+		if throttleKey != "" {
+			store.Delete(throttleKey)
+		}
+		return err
+	}
+
+	// CC recipients (e.g. a shared inbox) get their own copy, without the
+	// CRM deep link unless CRM_LINK_FOR_CC is set
+	if cc := cfg.ContactEmailCC; len(cc) > 0 {
+		includeLink := envBool("CRM_LINK_FOR_CC")
+		if err := send(buildNotificationBody(cfg, req, lead, includeLink), buildNotificationHTML(cfg, req, lead, includeLink), cc...); err != nil {
+			logEvent("email_cc_failed", leadLogFields(req.Email, lead, err), "Warning: Failed to send CC notification: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// throttleNotification reports whether a notification for this email and
+// service was already sent within EMAIL_THROTTLE_WINDOW (disabled when
+// unset), recording this one otherwise. It returns the store key used so a
+// failed send can release it.
+func throttleNotification(cfg *Config, req ContactRequest) (string, bool) {
+	window := cfg.EmailThrottleWindow
+	if window <= 0 {
+		return "", false
+	}
+
+	key := "email-throttle:" + strings.ToLower(strings.TrimSpace(req.Email)) + "|" + strings.ToLower(req.Service)
+	n, err := store.Incr(key, window)
+	if err != nil {
+		log.Printf("Warning: Failed to check notification throttle: %v", err)
+		return "", false
+	}
+	return key, n > 1
+}
+
+// notificationRecipient picks the notification address for a service.
+// SERVICE_RECIPIENTS maps services to addresses ("Branding=a@x.com,Web=b@x.com",
+// matched case-insensitively). When routing is configured but the service has
+// no mapping, UNROUTED_RECIPIENT is used so odd leads can be triaged; otherwise
+// leads go to CONTACT_EMAIL.
+func notificationRecipient(cfg *Config, service string) string {
+	defaultRecipient := cfg.ContactEmail
+	if defaultRecipient == "" {
+		defaultRecipient = "john@sogos.io"
+	}
+
+	routes := cfg.ServiceRecipients
+	if len(routes) == 0 {
+		return defaultRecipient
+	}
+
+	service = strings.TrimSpace(service)
+	for _, route := range routes {
+		routeService, address, ok := strings.Cut(route, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(routeService), service) {
+			return strings.TrimSpace(address)
+		}
+	}
+
+	if unrouted := cfg.UnroutedRecipient; unrouted != "" {
+		return unrouted
+	}
+	return defaultRecipient
+}
+
+// crmMissingNotice returns the line shown when a lead couldn't be written to
+// the CRM (CRM_MISSING_NOTICE, with a default asking for manual entry)
+func crmMissingNotice(cfg *Config) string {
+	if notice := cfg.CRMMissingNotice; notice != "" {
+		return notice
+	}
+	return "⚠️ Not yet in CRM — manual entry needed. Please add this lead to Twenty using the details in this email."
+}
+
+// notificationField is one labelled value in a notification email
+type notificationField struct {
+	Label string
+	Value string
+}
+
+// manualEntryFields lists the captured fields that the contact section of
+// the email doesn't show, for entering the lead by hand
+func manualEntryFields(req ContactRequest) []notificationField {
+	var fields []notificationField
+	for _, field := range []notificationField{
+		{"Title", req.Title},
+		{"Website", req.Website},
+		{"City", req.City},
+		{"State", req.State},
+		{"Country", req.Country},
+	} {
+		if field.Value != "" {
+			fields = append(fields, field)
+		}
+	}
+	if req.CompanySize > 0 {
+		fields = append(fields, notificationField{"Company Size", strconv.Itoa(req.CompanySize)})
+	}
+	return fields
+}
+
+// manualEntryDetails renders manualEntryFields as text, one per line
+func manualEntryDetails(req ContactRequest) string {
+	var b strings.Builder
+	for _, field := range manualEntryFields(req) {
+		fmt.Fprintf(&b, "\n%s: %s", field.Label, field.Value)
 	}
+	return b.String()
+}
+
+// notificationCRMStatus returns the CRM deep link for the lead when
+// includeCRMLink is set and the lead was written, or the notice to show
+// instead. The notice is "missing" when the CRM write failed and the lead
+// needs entering by hand.
+func notificationCRMStatus(cfg *Config, lead *LeadResult, includeCRMLink bool) (link, notice string, missing bool) {
+	crmURL := cfg.TwentyAPIURL
+	if !cfg.CRMConfigured() {
+		notice = "⚠️ CRM skipped: Twenty is not configured, so this lead was NOT added to the CRM. Please enter it manually."
+	}
+	if includeCRMLink && lead != nil && lead.OpportunityID != "" {
+		return fmt.Sprintf("%s/object/opportunity/%s", crmURL, lead.OpportunityID), "", false
+	} else if includeCRMLink && lead != nil && lead.LeadID != "" {
+		return fmt.Sprintf("%s/object/lead/%s", crmURL, lead.LeadID), "", false
+	} else if cfg.CRMConfigured() && (lead == nil || (lead.OpportunityID == "" && lead.LeadID == "")) {
+		// The CRM write failed, so say so rather than silently omitting the link
+		return "", crmMissingNotice(cfg), true
+	}
+	return "", notice, false
+}
 
+// notificationPersonStatus describes whether the lead is a new or returning
+// contact
+func notificationPersonStatus(lead *LeadResult) string {
 	personStatus := "New contact"
 	if lead != nil && !lead.IsNewPerson {
 		personStatus = "Existing contact (returning lead)"
+		if lead.PriorInquiries > 0 {
+			personStatus = fmt.Sprintf("Returning lead — %d prior %s", lead.PriorInquiries, pluralize(lead.PriorInquiries, "inquiry", "inquiries"))
+		}
+		if lead.ReusedOpportunity {
+			personStatus = "Existing contact (added to open opportunity)"
+		}
+		if lead.ReopenedOpportunity {
+			personStatus = "Existing contact (reopened closed opportunity)"
+		}
+	}
+	if lead != nil && lead.GroupedWithCompany {
+		personStatus += " — added to an open opportunity for their company"
+	}
+	return personStatus
+}
+
+// notificationDetails returns the optional contact details and warnings,
+// one line each
+func notificationDetails(cfg *Config, req ContactRequest) []string {
+	var details []string
+	if req.ScriptContent {
+		details = append(details, "⚠️ Flagged: the message contained script-like content")
+	}
+	if warning := phoneCountryWarning(req); warning != "" {
+		details = append(details, "⚠️ Check: "+warning)
+	}
+	if req.Email != "" && !isValidEmail(req.Email) {
+		details = append(details, fmt.Sprintf("⚠️ Invalid email, not used for Reply-To: %q", req.Email))
+	}
+	if req.Location != nil {
+		details = append(details, fmt.Sprintf("Location: %s", req.Location))
+	}
+	if req.ReferralSource != "" {
+		details = append(details, fmt.Sprintf("Heard About Us: %s", req.ReferralSource))
+	}
+	if summary := referrerChainSummary(req.ReferrerChain); summary != "" {
+		details = append(details, strings.Split(summary, "\n")...)
+	}
+	return details
+}
+
+// buildNotificationBody renders the plain-text notification email. The CRM
+// link is only included when includeCRMLink is set.
+func buildNotificationBody(cfg *Config, req ContactRequest, lead *LeadResult, includeCRMLink bool) string {
+	crmLink := ""
+	link, notice, missing := notificationCRMStatus(cfg, lead, includeCRMLink)
+	if link != "" {
+		crmLink = "\n\n📊 View in CRM: " + link
+	} else if missing {
+		crmLink = "\n\n" + notice + manualEntryDetails(req)
+	} else if notice != "" {
+		crmLink = "\n\n" + notice
+	}
+
+	// Optional contact details, each on its own line
+	details := ""
+	for _, line := range notificationDetails(cfg, req) {
+		details += "\n" + line
+	}
+
+	// Blank messages get a placeholder or no section at all
+	messageSection := ""
+	if message := messageOrPlaceholder(cfg, req.Message); message != "" {
+		messageSection = fmt.Sprintf("\n\n💬 Message\n━━━━━━━━━━━━━━━━━━━━\n%s", message)
 	}
 
-	body := fmt.Sprintf(`New lead from sogos.io website!
+	return fmt.Sprintf(`New lead from sogos.io website!
 
 👤 Contact Information
 ━━━━━━━━━━━━━━━━━━━━
@@ -602,33 +2838,65 @@ Company: %s
 Email: %s
 Phone: %s
 Service Interest: %s
-Status: %s
-
-💬 Message
-━━━━━━━━━━━━━━━━━━━━
-%s
+Status: %s%s%s
 %s
-`, req.Name, req.Company, req.Email, req.Phone, req.Service, personStatus, req.Message, crmLink)
+`, req.Name, req.Company, req.Email, req.Phone, req.Service, notificationPersonStatus(lead), details, messageSection, crmLink)
+}
+
+// sendResponse renders resp as JSON, or as plain text when the client's
+// Accept header prefers text/plain
+func sendResponse(w http.ResponseWriter, r *http.Request, status int, resp Response) {
+	if negotiateContentType(r.Header.Get("Accept")) == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, resp.Message)
+		if resp.Reference != "" {
+			fmt.Fprintf(w, "Confirmation number: %s\n", resp.Reference)
+		}
+		return
+	}
 
-	m := mg.NewMessage(
-		fmt.Sprintf("Sogos CRM <noreply@%s>", domain),
-		subject,
-		body,
-		recipient,
-	)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
 
-	// Set reply-to as the submitter's email
-	m.SetReplyTo(req.Email)
+// negotiateContentType picks "application/json" or "text/plain" from an
+// Accept header. JSON wins when the header is absent or only has wildcards,
+// and on ties with an explicitly listed JSON type.
+func negotiateContentType(accept string) string {
+	jsonQ, textQ, wildcardQ := -1.0, -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
+		switch mediaType {
+		case "application/json", "application/*":
+			jsonQ = max(jsonQ, q)
+		case "text/plain", "text/*":
+			textQ = max(textQ, q)
+		case "*/*":
+			wildcardQ = max(wildcardQ, q)
+		}
+	}
 
-	_, _, err := mg.Send(ctx, m)
-	return err
-}
+	if jsonQ < 0 {
+		// Only reachable through the wildcard, so an explicit text/plain
+		// of equal weight is the more specific match
+		jsonQ = wildcardQ - 0.0001
+	}
 
-func sendJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+	if textQ > 0 && textQ > jsonQ {
+		return "text/plain"
+	}
+	return "application/json"
 }
@@ -0,0 +1,1879 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// twentyCall is one GraphQL request received by a twentyStub
+type twentyCall struct {
+	Operation string
+	Variables map[string]interface{}
+}
+
+// twentyStub is a fake Twenty GraphQL API. Operations answer with the
+// responses queued for them by on, the last one repeating; without one,
+// creates return a generated ID and everything else returns no records.
+type twentyStub struct {
+	mu        sync.Mutex
+	responses map[string][]string
+	calls     []twentyCall
+}
+
+// useTwentyStub starts a twentyStub and returns it with a config pointing at it
+func useTwentyStub(t *testing.T) (*twentyStub, *Config) {
+	t.Helper()
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	stub := &twentyStub{responses: map[string][]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		op := graphQLOperationName(req.Query)
+
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		stub.calls = append(stub.calls, twentyCall{Operation: op, Variables: req.Variables})
+
+		if queued := stub.responses[op]; len(queued) > 0 {
+			if len(queued) > 1 {
+				stub.responses[op] = queued[1:]
+			}
+			w.Write([]byte(queued[0]))
+			return
+		}
+		if object, ok := strings.CutPrefix(op, "Create"); ok {
+			w.Write([]byte(`{"data":{"create` + object + `":{"id":"` + strings.ToLower(object) + `-1"}}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return stub, &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyRequestAttempts: 1}
+}
+
+// on queues responses for the GraphQL operation op
+func (s *twentyStub) on(op string, responses ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[op] = append(s.responses[op], responses...)
+}
+
+// operations returns the names of the operations called, in order
+func (s *twentyStub) operations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ops []string
+	for _, call := range s.calls {
+		ops = append(ops, call.Operation)
+	}
+	return ops
+}
+
+// variables returns the variables of the last call to op, or nil
+func (s *twentyStub) variables(op string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		if s.calls[i].Operation == op {
+			return s.calls[i].Variables
+		}
+	}
+	return nil
+}
+
+// input returns the input variable of the last call to op, or nil
+func (s *twentyStub) input(op string) map[string]interface{} {
+	input, _ := s.variables(op)["input"].(map[string]interface{})
+	return input
+}
+
+// inputs returns the input variables of every call to op, in order
+func (s *twentyStub) inputs(op string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var inputs []map[string]interface{}
+	for _, call := range s.calls {
+		if call.Operation == op {
+			input, _ := call.Variables["input"].(map[string]interface{})
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// count returns how many times op was called
+func (s *twentyStub) count(op string) int {
+	n := 0
+	for _, called := range s.operations() {
+		if called == op {
+			n++
+		}
+	}
+	return n
+}
+
+// noteBody returns the markdown body of the last note created
+func (s *twentyStub) noteBody() string {
+	body, _ := s.input("CreateNote")["bodyV2"].(map[string]interface{})
+	markdown, _ := body["markdown"].(string)
+	return markdown
+}
+
+func TestHashEmail(t *testing.T) {
+	a := hashEmail("jane@example.com", "salt")
+	if len(a) != 64 {
+		t.Fatalf("hash %q is not hex SHA-256", a)
+	}
+	if b := hashEmail("jane@example.com", "salt"); b != a {
+		t.Errorf("hash is not stable: %q != %q", a, b)
+	}
+	if b := hashEmail("  Jane@Example.COM ", "salt"); b != a {
+		t.Errorf("hash of the unnormalized email differs: %q != %q", a, b)
+	}
+	if b := hashEmail("jane@example.com", "pepper"); b == a {
+		t.Error("hash does not depend on the salt")
+	}
+	if b := hashEmail("john@example.com", "salt"); b == a {
+		t.Error("different emails hash the same")
+	}
+}
+
+func TestEmailHashOnAnalyticsRecords(t *testing.T) {
+	req := ContactRequest{Name: "Jane", Email: "jane@example.com", EmailHash: hashEmail("jane@example.com", "salt")}
+
+	row := buildSheetRow(req, &LeadResult{OpportunityID: "opp-1"}, "https://crm.example.com", testEpoch)
+	if got := row[len(row)-1]; got != req.EmailHash {
+		t.Errorf("sheet row ends with %v, want the email hash", got)
+	}
+
+	payloads := make(chan SecondaryLeadPayload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SecondaryLeadPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer srv.Close()
+
+	mirrorLead(&Config{SecondaryWebhookURL: srv.URL}, req, &LeadResult{})
+	select {
+	case payload := <-payloads:
+		if payload.EmailHash != req.EmailHash {
+			t.Errorf("mirror payload emailHash = %q, want %q", payload.EmailHash, req.EmailHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mirror payload not received")
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		country string
+		phone   string
+		want    string
+	}{
+		{"empty", "", "", ""},
+		{"formatted US", "", "(555) 123-4567", "+15551234567"},
+		{"bare US", "", "5551234567", "+15551234567"},
+		{"US with leading 1", "", "15551234567", "+15551234567"},
+		{"international", "", "+44 20 7946 0958", "+442079460958"},
+		{"not a number", "", "call me", ""},
+		{"00 prefix", "", "0044 20 7946 0958", "+442079460958"},
+		{"(0) trunk marker", "", "+44 (0)20 7946 0958", "+442079460958"},
+		{"(0) trunk marker with 00", "", "0044 (0) 20 7946 0958", "+442079460958"},
+		{"foreign number without +", "", "442079460958", "+442079460958"},
+		{"too short", "", "+1 555", ""},
+		{"too long", "", "+1234567890123456", ""},
+		{"DEFAULT_COUNTRY drops trunk 0", "GB", "020 7946 0958", "+442079460958"},
+		{"DEFAULT_COUNTRY keeps +", "GB", "+1 555 123 4567", "+15551234567"},
+		{"unknown DEFAULT_COUNTRY", "ZZ", "020 7946 0958", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizePhone(tt.phone, defaultPhoneCountry(&Config{DefaultCountry: tt.country})); got != tt.want {
+				t.Errorf("normalizePhone(%q) = %q, want %q", tt.phone, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDefaultCountry(t *testing.T) {
+	tests := []struct {
+		country string
+		wantErr bool
+	}{
+		{"", false},
+		{"US", false},
+		{"gb", false},
+		{"ZZ", true},
+		{"USA", true},
+		{"1", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseDefaultCountry(tt.country); (err != nil) != tt.wantErr {
+			t.Errorf("parseDefaultCountry(%q): err = %v, wantErr %v", tt.country, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCreateTwentyLeadWithoutPerson(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Phone: "555-123-4567", Service: "Branding", Message: "Hello"}
+
+	t.Run("skip", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreatePerson", `{"errors":[{"message":"boom"}]}`)
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err == nil {
+			t.Fatal("expected the lead to fail without a person")
+		}
+		if n := stub.count("CreateOpportunity"); n != 0 {
+			t.Errorf("%d opportunities created, want none", n)
+		}
+	})
+
+	t.Run("embed", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreatePerson", `{"errors":[{"message":"boom"}]}`)
+		cfg.OpportunityWithoutContact = "embed"
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.PersonID != "" || lead.OpportunityID != "opportunity-1" {
+			t.Errorf("lead = %+v, want an opportunity without a person", lead)
+		}
+		if _, ok := stub.input("CreateOpportunity")["pointOfContactId"]; ok {
+			t.Error("opportunity has a point of contact")
+		}
+		note := stub.noteBody()
+		if !strings.Contains(note, "**Contact details**") || !strings.Contains(note, "jane@example.com") || !strings.Contains(note, "Hello") {
+			t.Errorf("note = %q, want the contact details and the message", note)
+		}
+	})
+}
+
+func TestCreateTwentyLeadResumes(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	stub.on("CreateOpportunity", `{"errors":[{"message":"boom"}]}`, `{"data":{"createOpportunity":{"id":"opportunity-1"}}}`)
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Company: "Acme", Service: "Branding"}
+
+	progress := &LeadResult{}
+	if _, err := createTwentyLead(context.Background(), cfg, req, progress); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if progress.CompanyID != "company-1" || progress.PersonID != "person-1" {
+		t.Fatalf("progress = %+v, want the company and person recorded", progress)
+	}
+
+	lead, err := createTwentyLead(context.Background(), cfg, req, progress)
+	if err != nil {
+		t.Fatalf("resumed createTwentyLead: %v", err)
+	}
+	if lead.OpportunityID != "opportunity-1" {
+		t.Errorf("OpportunityID = %q, want opportunity-1", lead.OpportunityID)
+	}
+	for _, op := range []string{"CreateCompany", "CreatePerson", "FindPerson"} {
+		if n := stub.count(op); n != 1 {
+			t.Errorf("%s called %d times, want once", op, n)
+		}
+	}
+}
+
+func TestSanitizeNoteBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		maxLen int
+		want   string
+	}{
+		{"at the limit", "abcde", 5, "abcde"},
+		{"one over the limit", "abcdef", 5, "abcde…\n\n_(truncated)_"},
+		{"counts runes, not bytes", "ééééé", 5, "ééééé"},
+		{"trailing space before the cut", "abc  def", 5, "abc…\n\n_(truncated)_"},
+		{"no limit", "abcdef", 0, "abcdef"},
+		{"CRLF and control characters", "a\r\nb\x00c\td\u200b", 0, "a\nbc\td"},
+		{"invalid UTF-8", "a\xffb", 0, "ab"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeNoteBody(tt.body, tt.maxLen); got != tt.want {
+			t.Errorf("%s: sanitizeNoteBody(%q, %d) = %q, want %q", tt.name, tt.body, tt.maxLen, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTwentyNoteTruncates(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	cfg.NoteMaxLength = 10
+
+	if err := createTwentyNote(context.Background(), cfg, "Title", strings.Repeat("x", 11), "opportunity-1"); err != nil {
+		t.Fatalf("createTwentyNote: %v", err)
+	}
+	if want := strings.Repeat("x", 10) + "…\n\n_(truncated)_"; stub.noteBody() != want {
+		t.Errorf("note body = %q, want %q", stub.noteBody(), want)
+	}
+}
+
+func TestCreateTwentyTask(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	useSystemClock(t)
+	cfg.FollowUpTaskDueHours = 48
+	cfg.FollowUpTaskAssigneeID = "member-7"
+
+	taskID, err := createTwentyTask(context.Background(), cfg, "Follow up with Jane", "person-1", "opportunity-1")
+	if err != nil {
+		t.Fatalf("createTwentyTask: %v", err)
+	}
+	if taskID != "task-1" {
+		t.Errorf("taskID = %q, want task-1", taskID)
+	}
+
+	task := stub.input("CreateTask")
+	if task["title"] != "Follow up with Jane" || task["status"] != "TODO" || task["assigneeId"] != "member-7" {
+		t.Errorf("task input = %v", task)
+	}
+	if want := testEpoch.Add(48 * time.Hour).Format(time.RFC3339); task["dueAt"] != want {
+		t.Errorf("dueAt = %v, want %s", task["dueAt"], want)
+	}
+
+	targets := stub.inputs("CreateTaskTarget")
+	if len(targets) != 2 || targets[0]["personId"] != "person-1" || targets[1]["opportunityId"] != "opportunity-1" {
+		t.Errorf("task targets = %v, want the person and the opportunity", targets)
+	}
+}
+
+func TestCreateTwentyLeadFollowUpTask(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+
+	t.Run("enabled", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("CREATE_FOLLOWUP_TASK", "true")
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.TaskID != "task-1" {
+			t.Errorf("TaskID = %q, want task-1", lead.TaskID)
+		}
+		if _, ok := stub.input("CreateTask")["assigneeId"]; ok {
+			t.Error("task assigned without FOLLOWUP_TASK_ASSIGNEE_ID")
+		}
+	})
+
+	t.Run("failure is not fatal", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreateTask", `{"errors":[{"message":"boom"}]}`)
+		t.Setenv("CREATE_FOLLOWUP_TASK", "true")
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.TaskID != "" || lead.OpportunityID == "" {
+			t.Errorf("lead = %+v, want an opportunity and no task", lead)
+		}
+	})
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/json", "application/json"},
+		{"text/plain", "text/plain"},
+		{"text/*", "text/plain"},
+		{"text/plain, */*", "text/plain"},
+		{"text/plain, application/json", "application/json"},
+		{"text/plain;q=0.5, application/json;q=0.9", "application/json"},
+		{"text/plain;q=0.9, application/json;q=0.5", "text/plain"},
+		{"text/plain;q=0", "application/json"},
+		{"TEXT/PLAIN", "text/plain"},
+		{"text/html", "application/json"},
+	}
+	for _, tt := range tests {
+		if got := negotiateContentType(tt.accept); got != tt.want {
+			t.Errorf("negotiateContentType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestSendResponsePlainText(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/contact", nil)
+	r.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+
+	sendResponse(w, r, http.StatusOK, Response{Success: true, Message: "Thanks!", Reference: "SG-123"})
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if want := "Thanks!\nConfirmation number: SG-123\n"; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+}
+
+// returningPerson is a FindPerson response with an existing person
+const returningPerson = `{"data":{"people":{"edges":[{"node":{"id":"person-9"}}]}}}`
+
+func TestOpportunityReuseWindow(t *testing.T) {
+	tests := map[string]time.Duration{
+		"72h":  72 * time.Hour,
+		"":     0,
+		"soon": 0,
+		"-1h":  0,
+	}
+	for v, want := range tests {
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", v)
+		if got := opportunityReuseWindow(); got != want {
+			t.Errorf("OPPORTUNITY_REUSE_WINDOW=%q: %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestCreateTwentyLeadReusesOpportunity(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding", Message: "One more thing"}
+
+	t.Run("recent open opportunity", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		useSystemClock(t)
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", "72h")
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindRecentOpportunities", `{"data":{"opportunities":{"edges":[
+			{"node":{"id":"opportunity-won","stage":"CUSTOMER"}},
+			{"node":{"id":"opportunity-open","stage":"MEETING"}}]}}}`)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-open" || !lead.ReusedOpportunity {
+			t.Errorf("lead = %+v, want opportunity-open reused", lead)
+		}
+		if n := stub.count("CreateOpportunity"); n != 0 {
+			t.Errorf("%d opportunities created, want none", n)
+		}
+		if note := stub.input("CreateNote"); note["title"] != "Follow-up Inquiry" || !strings.Contains(stub.noteBody(), "One more thing") {
+			t.Errorf("note = %v, want a follow-up note with the message", note)
+		}
+		if target := stub.input("CreateNoteTarget"); target["opportunityId"] != "opportunity-open" {
+			t.Errorf("note target = %v, want opportunity-open", target)
+		}
+
+		filter := stub.variables("FindRecentOpportunities")["filter"].(map[string]interface{})
+		since := testEpoch.Add(-72 * time.Hour).Format(time.RFC3339)
+		if filter["createdAt"].(map[string]interface{})["gte"] != since {
+			t.Errorf("filter = %v, want createdAt since %s", filter, since)
+		}
+	})
+
+	t.Run("no open opportunity", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", "72h")
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindRecentOpportunities", `{"data":{"opportunities":{"edges":[{"node":{"id":"opportunity-won","stage":"CUSTOMER"}}]}}}`)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-1" || lead.ReusedOpportunity {
+			t.Errorf("lead = %+v, want a new opportunity", lead)
+		}
+	})
+
+	t.Run("new person", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", "72h")
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if n := stub.count("FindRecentOpportunities"); n != 0 {
+			t.Errorf("looked up recent opportunities %d times for a new person", n)
+		}
+	})
+}
+
+func TestCreateTwentyLeadReopensClosedOpportunity(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding", Message: "We're back"}
+	closedLatest := `{"data":{"opportunities":{"edges":[{"node":{"id":"opportunity-lost","stage":"CUSTOMER"}}]}}}`
+
+	t.Run("closed latest opportunity", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindLatestOpportunity", closedLatest)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-lost" || !lead.ReopenedOpportunity {
+			t.Errorf("lead = %+v, want opportunity-lost reopened", lead)
+		}
+		if n := stub.count("CreateOpportunity"); n != 0 {
+			t.Errorf("%d opportunities created, want none", n)
+		}
+		if update := stub.variables("UpdateOpportunity"); update["id"] != "opportunity-lost" || update["input"].(map[string]interface{})["stage"] != "NEW" {
+			t.Errorf("update = %v, want opportunity-lost moved to NEW", update)
+		}
+		if note := stub.input("CreateNote"); note["title"] != "Reopened: New Inquiry" || !strings.Contains(stub.noteBody(), "Reopened from stage CUSTOMER") || !strings.Contains(stub.noteBody(), "We're back") {
+			t.Errorf("note = %v (%q), want a reopen note with the message", note, stub.noteBody())
+		}
+		if target := stub.input("CreateNoteTarget"); target["opportunityId"] != "opportunity-lost" {
+			t.Errorf("note target = %v, want opportunity-lost", target)
+		}
+
+		filter := stub.variables("FindLatestOpportunity")["filter"].(map[string]interface{})
+		if filter["pointOfContactId"].(map[string]interface{})["eq"] != "person-9" {
+			t.Errorf("filter = %v, want the returning person", filter)
+		}
+	})
+
+	t.Run("open latest opportunity", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindLatestOpportunity", `{"data":{"opportunities":{"edges":[{"node":{"id":"opportunity-open","stage":"MEETING"}}]}}}`)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-1" || lead.ReopenedOpportunity || stub.count("UpdateOpportunity") != 0 {
+			t.Errorf("lead = %+v, want a new opportunity", lead)
+		}
+	})
+
+	t.Run("custom closed stages", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+		cfg.OpportunityClosedStages = []string{"LOST", "WON"}
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindLatestOpportunity", `{"data":{"opportunities":{"edges":[{"node":{"id":"opportunity-lost","stage":"LOST"}}]}}}`)
+
+		lead, _ := createTwentyLead(context.Background(), cfg, req, nil)
+		if lead == nil || !lead.ReopenedOpportunity {
+			t.Errorf("lead = %+v, want the LOST opportunity reopened", lead)
+		}
+	})
+
+	t.Run("reopen fails", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindLatestOpportunity", closedLatest)
+		stub.on("UpdateOpportunity", `{"errors":[{"message":"boom"}]}`)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-1" || lead.ReopenedOpportunity {
+			t.Errorf("lead = %+v, want a new opportunity", lead)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "")
+		stub.on("FindPerson", returningPerson)
+		stub.on("FindLatestOpportunity", closedLatest)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-1" || stub.count("FindLatestOpportunity") != 0 {
+			t.Errorf("lead = %+v, want a new opportunity without a lookup", lead)
+		}
+	})
+
+	t.Run("new person", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("REOPEN_CLOSED_OPPORTUNITY", "true")
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if n := stub.count("FindLatestOpportunity"); n != 0 {
+			t.Errorf("looked up the latest opportunity %d times for a new person", n)
+		}
+	})
+}
+
+func TestCreateTwentyLeadGroupsCompanyOpportunities(t *testing.T) {
+	req := ContactRequest{Name: "John Roe", Email: "john@acme.com", Company: "Acme", Message: "Also interested"}
+	openOpportunity := `{"data":{"opportunities":{"edges":[{"node":{"id":"opportunity-acme","stage":"MEETING"}}]}}}`
+
+	t.Run("grouped", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		useSystemClock(t)
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", "")
+		t.Setenv("COMPANY_OPPORTUNITY_WINDOW", "168h")
+		stub.on("FindRecentOpportunities", openOpportunity)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-acme" || !lead.GroupedWithCompany || lead.PersonID != "person-1" {
+			t.Errorf("lead = %+v, want the new person grouped on opportunity-acme", lead)
+		}
+		if n := stub.count("CreateOpportunity"); n != 0 {
+			t.Errorf("%d opportunities created, want none", n)
+		}
+		if note := stub.input("CreateNote"); note["title"] != "Additional Contact" || !strings.Contains(stub.noteBody(), "- Email: john@acme.com") || !strings.Contains(stub.noteBody(), "Also interested") {
+			t.Errorf("note = %v (%q), want the contact details and message", note, stub.noteBody())
+		}
+		if target := stub.input("CreateNoteTarget"); target["opportunityId"] != "opportunity-acme" {
+			t.Errorf("note target = %v, want opportunity-acme", target)
+		}
+
+		filter := stub.variables("FindRecentOpportunities")["filter"].(map[string]interface{})
+		since := testEpoch.Add(-168 * time.Hour).Format(time.RFC3339)
+		if filter["companyId"].(map[string]interface{})["eq"] != "company-1" || filter["createdAt"].(map[string]interface{})["gte"] != since {
+			t.Errorf("filter = %v, want company-1's opportunities since %s", filter, since)
+		}
+
+		if body := buildNotificationBody(cfg, req, lead, true); !strings.Contains(body, "added to an open opportunity for their company") {
+			t.Errorf("notification doesn't mention the grouping:\n%s", body)
+		}
+	})
+
+	t.Run("separate", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("COMPANY_OPPORTUNITY_WINDOW", "")
+		stub.on("FindRecentOpportunities", openOpportunity)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.OpportunityID != "opportunity-1" || lead.GroupedWithCompany || stub.count("FindRecentOpportunities") != 0 {
+			t.Errorf("lead = %+v, want a separate opportunity without a lookup", lead)
+		}
+	})
+
+	t.Run("only closed opportunities", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", "")
+		t.Setenv("COMPANY_OPPORTUNITY_WINDOW", "168h")
+		stub.on("FindRecentOpportunities", `{"data":{"opportunities":{"edges":[{"node":{"id":"opportunity-won","stage":"CUSTOMER"}}]}}}`)
+
+		lead, _ := createTwentyLead(context.Background(), cfg, req, nil)
+		if lead == nil || lead.OpportunityID != "opportunity-1" || lead.GroupedWithCompany {
+			t.Errorf("lead = %+v, want a separate opportunity", lead)
+		}
+	})
+
+	t.Run("note fails", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("OPPORTUNITY_REUSE_WINDOW", "")
+		t.Setenv("COMPANY_OPPORTUNITY_WINDOW", "168h")
+		stub.on("FindRecentOpportunities", openOpportunity)
+		stub.on("CreateNote", `{"errors":[{"message":"boom"}]}`)
+
+		lead, _ := createTwentyLead(context.Background(), cfg, req, nil)
+		if lead == nil || lead.OpportunityID != "opportunity-1" || lead.GroupedWithCompany {
+			t.Errorf("lead = %+v, want a separate opportunity", lead)
+		}
+	})
+}
+
+func TestNormalizeCountryCode(t *testing.T) {
+	tests := []struct {
+		country string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{" us ", "US", false},
+		{"DE", "DE", false},
+		{"USA", "", true},
+		{"United States", "", true},
+		{"1A", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeCountryCode(tt.country)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("normalizeCountryCode(%q) = %q, %v; want %q, error %v", tt.country, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPersonLocationFields(t *testing.T) {
+	full := ContactRequest{City: "Austin", State: "TX", Country: "US"}
+	tests := []struct {
+		name  string
+		field string
+		req   ContactRequest
+		want  map[string]interface{}
+	}{
+		{"nothing submitted", "address", ContactRequest{}, map[string]interface{}{}},
+		{"city only without an address field", "", full, map[string]interface{}{"city": "Austin"}},
+		{"full address", "address", full, map[string]interface{}{
+			"city":    "Austin",
+			"address": map[string]interface{}{"addressCity": "Austin", "addressState": "TX", "addressCountry": "US"},
+		}},
+		{"missing parts omitted", "address", ContactRequest{Country: "DE"}, map[string]interface{}{
+			"address": map[string]interface{}{"addressCountry": "DE"},
+		}},
+	}
+	for _, tt := range tests {
+		if got := personLocationFields(&Config{PersonAddressField: tt.field}, tt.req); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: personLocationFields = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTwentyLeadWritesPersonAddress(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	cfg.PersonAddressField = "address"
+
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", City: "Austin", State: "TX", Country: "US"}
+	if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+
+	person := stub.input("CreatePerson")
+	if person["city"] != "Austin" {
+		t.Errorf("city = %v, want Austin", person["city"])
+	}
+	want := map[string]interface{}{"addressCity": "Austin", "addressState": "TX", "addressCountry": "US"}
+	if !reflect.DeepEqual(person["address"], want) {
+		t.Errorf("address = %v, want %v", person["address"], want)
+	}
+}
+
+func TestHandleContactRejectsInvalidCountry(t *testing.T) {
+	useMemoryStore(t)
+	w := postContact(&Config{CRMMissingConfig: "unavailable"}, `{"name":"Jane Doe","email":"jane@example.com","country":"USA"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if resp := responseOf(t, w); resp.Code != codeValidationError {
+		t.Errorf("code = %q, want %q", resp.Code, codeValidationError)
+	}
+}
+
+func TestHandleContactValidationErrorCodes(t *testing.T) {
+	useMemoryStore(t)
+	tests := []struct {
+		name, body string
+	}{
+		{"missing name", `{"email":"jane@example.com"}`},
+		{"invalid website", `{"name":"Jane Doe","email":"jane@example.com","website":"ftp://acme.com"}`},
+		{"service too long", `{"name":"Jane Doe","email":"jane@example.com","service":"` + strings.Repeat("x", 200) + `"}`},
+		{"unknown referral source", `{"name":"Jane Doe","email":"jane@example.com","referralSource":"Billboard"}`},
+	}
+	for _, tt := range tests {
+		w := postContact(&Config{CRMMissingConfig: "unavailable", ReferralSources: []string{"Google", "Friend"}, ServiceOverlength: "reject"}, tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, w.Code)
+			continue
+		}
+		if resp := responseOf(t, w); resp.Code != codeValidationError {
+			t.Errorf("%s: code = %q, want %q", tt.name, resp.Code, codeValidationError)
+		}
+	}
+}
+
+func TestNextOpportunityOwner(t *testing.T) {
+	useMemoryStore(t)
+	cfg := &Config{OpportunityOwnerIDs: []string{"alice", "bob", "carol"}}
+
+	var got []string
+	for i := 0; i < 7; i++ {
+		owner, err := nextOpportunityOwner(cfg)
+		if err != nil {
+			t.Fatalf("nextOpportunityOwner: %v", err)
+		}
+		got = append(got, owner)
+	}
+	want := "alice bob carol alice bob carol alice"
+	if strings.Join(got, " ") != want {
+		t.Errorf("owners = %v, want %s", got, want)
+	}
+}
+
+func TestNextOpportunityOwnerConcurrent(t *testing.T) {
+	useMemoryStore(t)
+	cfg := &Config{OpportunityOwnerIDs: []string{"alice", "bob", "carol"}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			owner, err := nextOpportunityOwner(cfg)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			counts[owner]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, owner := range []string{"alice", "bob", "carol"} {
+		if counts[owner] != 100 {
+			t.Errorf("counts = %v, want 100 each", counts)
+			break
+		}
+	}
+}
+
+func TestOpportunityCreateInputOwner(t *testing.T) {
+	if _, ok := opportunityCreateInput("Lead", "NEW", "", "", "", nil)["ownerId"]; ok {
+		t.Error("owner assigned without an owner ID")
+	}
+	if owner := opportunityCreateInput("Lead", "NEW", "", "", "alice", nil)["ownerId"]; owner != "alice" {
+		t.Errorf("ownerId = %v, want alice", owner)
+	}
+}
+
+func TestCreateTwentyLeadKeepsOwnerOnRetry(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.OpportunityOwnerIDs = []string{"alice", "bob"}
+	stub.on("CreateOpportunity", `{"errors":[{"message":"boom"}]}`, `{"data":{"createOpportunity":{"id":"opportunity-1"}}}`)
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+
+	progress := &LeadResult{}
+	if _, err := createTwentyLead(context.Background(), cfg, req, progress); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if _, err := createTwentyLead(context.Background(), cfg, req, progress); err != nil {
+		t.Fatalf("resumed createTwentyLead: %v", err)
+	}
+
+	for i, input := range stub.inputs("CreateOpportunity") {
+		if input["ownerId"] != "alice" {
+			t.Errorf("attempt %d ownerId = %v, want alice", i+1, input["ownerId"])
+		}
+	}
+	if next, _ := nextOpportunityOwner(cfg); next != "bob" {
+		t.Errorf("next owner = %q, want bob (the retry advanced the rotation)", next)
+	}
+}
+
+func TestMessageOrPlaceholder(t *testing.T) {
+	tests := []struct {
+		mode        string
+		placeholder string
+		message     string
+		want        string
+	}{
+		{"", "", "Hello", "Hello"},
+		{"", "", "  \n ", ""},
+		{"omit", "", "", ""},
+		{"placeholder", "", "", "(no message provided)"},
+		{"placeholder", "No message.", " ", "No message."},
+		{"placeholder", "No message.", "Hello", "Hello"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{EmptyMessageMode: tt.mode, EmptyMessagePlaceholder: tt.placeholder}
+		if got := messageOrPlaceholder(cfg, tt.message); got != tt.want {
+			t.Errorf("mode %q: messageOrPlaceholder(%q) = %q, want %q", tt.mode, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestEmptyMessage(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Message: "  "}
+
+	t.Run("omit", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if n := stub.count("CreateNote"); n != 0 {
+			t.Errorf("%d notes created for an empty message, want none", n)
+		}
+		if body := buildNotificationBody(cfg, req, nil, false); strings.Contains(body, "💬 Message") {
+			t.Errorf("notification has a message section:\n%s", body)
+		}
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		cfg.EmptyMessageMode = "placeholder"
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if note := stub.noteBody(); note != "(no message provided)" {
+			t.Errorf("note = %q, want the placeholder", note)
+		}
+		if body := buildNotificationBody(cfg, req, nil, false); !strings.Contains(body, "💬 Message\n━━━━━━━━━━━━━━━━━━━━\n(no message provided)") {
+			t.Errorf("notification lacks the placeholder:\n%s", body)
+		}
+	})
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"   ", "", false},
+		{"example.com", "https://example.com", false},
+		{"www.Example.COM/about", "https://www.example.com/about", false},
+		{"  acme.io/  ", "https://acme.io", false},
+		{"http://example.com", "http://example.com", false},
+		{"https://example.com/", "https://example.com", false},
+		{"https://example.com:8443/path#team", "https://example.com:8443/path", false},
+		{"ftp://example.com", "", true},
+		{"javascript://alert(1)", "", true},
+		{"localhost", "", true},
+		{"not a url", "", true},
+		{"https://-bad-.com", "", true},
+		{"https://exa mple.com", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeURL(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, %v; want %q, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCreateTwentyLeadCompanyFailure(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Company: "Acme", Service: "Branding"}
+
+	t.Run("lenient", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreateCompany", `{"errors":[{"message":"boom"}]}`)
+
+		lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+		if err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		if lead.CompanyID != "" || lead.OpportunityID != "opportunity-1" {
+			t.Errorf("lead = %+v, want an opportunity without a company", lead)
+		}
+		if _, ok := stub.input("CreateOpportunity")["companyId"]; ok {
+			t.Error("opportunity linked to a company")
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreateCompany", `{"errors":[{"message":"boom"}]}`)
+		cfg.CompanyFailureMode = "strict"
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err == nil {
+			t.Fatal("expected the lead to fail in strict mode")
+		}
+		for _, op := range []string{"CreatePerson", "CreateOpportunity"} {
+			if n := stub.count(op); n != 0 {
+				t.Errorf("%s called %d times, want none", op, n)
+			}
+		}
+	})
+}
+
+func TestNameMismatchModes(t *testing.T) {
+	storedName := `{"data":{"people":{"edges":[{"node":{"id":"person-9","name":{"firstName":"Janet","lastName":"Doe"}}}]}}}`
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+
+	tests := []struct {
+		mode          string
+		wantUpdate    bool
+		wantAlternate string
+	}{
+		{"", false, ""},
+		{"update", true, ""},
+		{"note", false, "Jane Doe"},
+	}
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			stub, cfg := useTwentyStub(t)
+			stub.on("FindPerson", returningPerson)
+			stub.on("FindPersonName", storedName)
+			cfg.NameMismatchMode = tt.mode
+
+			lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+			if err != nil {
+				t.Fatalf("createTwentyLead: %v", err)
+			}
+
+			if updated := stub.count("UpdatePerson") == 1; updated != tt.wantUpdate {
+				t.Errorf("person updated = %v, want %v", updated, tt.wantUpdate)
+			}
+			if tt.wantUpdate {
+				vars := stub.variables("UpdatePerson")
+				name := vars["input"].(map[string]interface{})["name"].(map[string]interface{})
+				if vars["id"] != "person-9" || name["firstName"] != "Jane" || name["lastName"] != "Doe" {
+					t.Errorf("update = %v, want person-9 renamed Jane Doe", vars)
+				}
+			}
+
+			if lead.AlternateName != tt.wantAlternate {
+				t.Errorf("AlternateName = %q, want %q", lead.AlternateName, tt.wantAlternate)
+			}
+			if tt.wantAlternate != "" {
+				if note := stub.input("CreateNote"); note["title"] != "Alternate Name" || !strings.Contains(stub.noteBody(), "**Jane Doe**") {
+					t.Errorf("note = %v, want the alternate name recorded", note)
+				}
+				if target := stub.input("CreateNoteTarget"); target["opportunityId"] != "opportunity-1" {
+					t.Errorf("note target = %v, want the opportunity", target)
+				}
+			}
+		})
+	}
+}
+
+func TestNameMismatchSameName(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	stub.on("FindPerson", returningPerson)
+	stub.on("FindPersonName", `{"data":{"people":{"edges":[{"node":{"name":{"firstName":"JANE","lastName":"doe "}}}]}}}`)
+	cfg.NameMismatchMode = "note"
+
+	lead, err := createTwentyLead(context.Background(), cfg, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, nil)
+	if err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if lead.AlternateName != "" {
+		t.Errorf("AlternateName = %q for a name differing only in case", lead.AlternateName)
+	}
+}
+
+func TestNormalizeReferralSource(t *testing.T) {
+	long := strings.Repeat("é", maxReferralSourceLength+5)
+	tests := []struct {
+		allowed string
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"", "  a   friend ", "a friend", false},
+		{"", long, strings.Repeat("é", maxReferralSourceLength), false},
+		{"Google, LinkedIn,Referral", "linkedin", "LinkedIn", false},
+		{"Google, LinkedIn,Referral", " GOOGLE ", "Google", false},
+		{"Google, LinkedIn,Referral", "Twitter", "", true},
+		{"Google, LinkedIn,Referral", "", "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeReferralSource(&Config{ReferralSources: splitList(tt.allowed)}, tt.source)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("allowed %q: normalizeReferralSource(%q) = %q, %v; want %q, error %v", tt.allowed, tt.source, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFindOrCreatePersonDuplicate(t *testing.T) {
+	duplicate := `{"errors":[{"message":"Duplicate key value violates unique constraint"}]}`
+
+	t.Run("re-search finds the concurrent person", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("FindPerson", `{"data":{"people":{"edges":[]}}}`, returningPerson)
+		stub.on("CreatePerson", duplicate)
+
+		personID, isNew, err := findOrCreatePerson(context.Background(), cfg, "Jane", "Doe", "jane@example.com", "", "", "", nil)
+		if err != nil {
+			t.Fatalf("findOrCreatePerson: %v", err)
+		}
+		if personID != "person-9" || isNew {
+			t.Errorf("got %q, new %v; want the existing person-9", personID, isNew)
+		}
+		if want := "FindPerson CreatePerson FindPerson"; strings.Join(stub.operations(), " ") != want {
+			t.Errorf("operations = %v, want %s", stub.operations(), want)
+		}
+	})
+
+	t.Run("re-search finds nothing", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreatePerson", duplicate)
+
+		if _, _, err := findOrCreatePerson(context.Background(), cfg, "Jane", "Doe", "jane@example.com", "", "", "", nil); err == nil {
+			t.Error("expected the duplicate error")
+		}
+	})
+
+	t.Run("retry disabled", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("FindPerson", `{"data":{"people":{"edges":[]}}}`, returningPerson)
+		stub.on("CreatePerson", duplicate)
+		t.Setenv("PERSON_DUPLICATE_RETRY", "false")
+
+		if _, _, err := findOrCreatePerson(context.Background(), cfg, "Jane", "Doe", "jane@example.com", "", "", "", nil); err == nil {
+			t.Error("expected the duplicate error")
+		}
+		if n := stub.count("FindPerson"); n != 1 {
+			t.Errorf("FindPerson called %d times, want once", n)
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		stub, cfg := useTwentyStub(t)
+		stub.on("CreatePerson", `{"errors":[{"message":"boom"}]}`)
+
+		if _, _, err := findOrCreatePerson(context.Background(), cfg, "Jane", "Doe", "jane@example.com", "", "", "", nil); err == nil {
+			t.Error("expected an error")
+		}
+		if n := stub.count("FindPerson"); n != 1 {
+			t.Errorf("FindPerson called %d times, want once", n)
+		}
+	})
+}
+
+func TestFindPersonByEmailExact(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+
+	if _, err := findPersonByEmail(context.Background(), cfg, "jane_doe@example.com"); err != nil {
+		t.Fatalf("findPersonByEmail: %v", err)
+	}
+	filter, _ := json.Marshal(stub.variables("FindPerson")["filter"])
+	if want := `{"emails":{"primaryEmail":{"eq":"jane_doe@example.com"}}}`; string(filter) != want {
+		t.Errorf("filter = %s, want %s", filter, want)
+	}
+}
+
+func TestIsDuplicateError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"graphql error: Duplicate key value", true},
+		{"violates UNIQUE constraint", true},
+		{"record already exists", true},
+		{"timeout", false},
+	}
+	for _, tt := range tests {
+		if got := isDuplicateError(errors.New(tt.msg)); got != tt.want {
+			t.Errorf("isDuplicateError(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationCRMLinkForCC(t *testing.T) {
+	cfg := &Config{TwentyAPIURL: "https://crm.example.com", TwentyAPIKey: "key"}
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}
+	lead := &LeadResult{OpportunityID: "opportunity-1"}
+	link := "https://crm.example.com/object/opportunity/opportunity-1"
+
+	for _, build := range []func(*Config, ContactRequest, *LeadResult, bool) string{buildNotificationBody, buildNotificationHTML} {
+		if primary := build(cfg, req, lead, true); !strings.Contains(primary, link) {
+			t.Errorf("primary notification lacks the CRM link:\n%s", primary)
+		}
+		cc := build(cfg, req, lead, false)
+		if strings.Contains(cc, "/object/") {
+			t.Errorf("CC notification has a CRM link:\n%s", cc)
+		}
+		if strings.Contains(cc, "Not yet in CRM") {
+			t.Errorf("CC notification claims the lead is missing from the CRM:\n%s", cc)
+		}
+	}
+
+	lead = &LeadResult{LeadID: "lead-1"}
+	if primary := buildNotificationBody(cfg, req, lead, true); !strings.Contains(primary, "https://crm.example.com/object/lead/lead-1") {
+		t.Errorf("lead mode notification lacks the lead link:\n%s", primary)
+	}
+}
+
+func TestNotificationWithoutCRMRecord(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Title: "CTO", Website: "https://acme.com", Country: "US", CompanySize: 50}
+	manual := []string{"Title: CTO", "Website: https://acme.com", "Country: US", "Company Size: 50"}
+
+	t.Run("CRM write failed", func(t *testing.T) {
+		cfg := &Config{TwentyAPIURL: "https://crm.example.com", TwentyAPIKey: "key"}
+		for _, lead := range []*LeadResult{nil, {PersonID: "person-1"}} {
+			body := buildNotificationBody(cfg, req, lead, true)
+			if !strings.Contains(body, "⚠️ Not yet in CRM — manual entry needed.") || strings.Contains(body, "/object/") {
+				t.Errorf("notification lacks the manual entry notice:\n%s", body)
+			}
+			for _, field := range manual {
+				if !strings.Contains(body, field) {
+					t.Errorf("notification lacks %q for manual entry:\n%s", field, body)
+				}
+			}
+
+			html := buildNotificationHTML(cfg, req, lead, true)
+			if !strings.Contains(html, "Not yet in CRM — manual entry needed.") || !strings.Contains(html, "<th align=\"left\" style=\"padding-right: 16px;\">Company Size</th><td>50</td>") {
+				t.Errorf("HTML notification lacks the manual entry details:\n%s", html)
+			}
+		}
+
+		cfg.CRMMissingNotice = "Add this one by hand"
+		if body := buildNotificationBody(cfg, req, nil, true); !strings.Contains(body, "\n\nAdd this one by hand\nTitle: CTO") || strings.Contains(body, "Not yet in CRM") {
+			t.Errorf("notification ignores CRM_MISSING_NOTICE:\n%s", body)
+		}
+	})
+
+	// With no CRM configured nothing was meant to be written, so the email
+	// says the CRM was skipped rather than asking for missing details
+	t.Run("CRM skipped", func(t *testing.T) {
+		cfg := &Config{CRMMissingConfig: "degraded"}
+		body := buildNotificationBody(cfg, req, nil, true)
+		if !strings.Contains(body, "CRM skipped") || strings.Contains(body, "Not yet in CRM") || strings.Contains(body, "Company Size: 50") {
+			t.Errorf("notification = \n%s\nwant only the skipped notice", body)
+		}
+		if html := buildNotificationHTML(cfg, req, nil, true); !strings.Contains(html, "CRM skipped") || strings.Contains(html, "Company Size") {
+			t.Errorf("HTML notification = \n%s\nwant only the skipped notice", html)
+		}
+	})
+}
+
+func TestNotificationRecipient(t *testing.T) {
+	routed := []string{"Branding=brand@sogos.io", " web design = web@sogos.io "}
+	tests := []struct {
+		name    string
+		cfg     Config
+		service string
+		want    string
+	}{
+		{"no routing", Config{ContactEmail: "team@sogos.io"}, "Branding", "team@sogos.io"},
+		{"default contact email", Config{}, "Branding", "john@sogos.io"},
+		{"mapped service", Config{ContactEmail: "team@sogos.io", ServiceRecipients: routed}, "Branding", "brand@sogos.io"},
+		{"mapped case-insensitively", Config{ContactEmail: "team@sogos.io", ServiceRecipients: routed}, " Web Design", "web@sogos.io"},
+		{"unrouted service", Config{ContactEmail: "team@sogos.io", ServiceRecipients: routed, UnroutedRecipient: "triage@sogos.io"}, "SEO", "triage@sogos.io"},
+		{"unrouted without a triage address", Config{ContactEmail: "team@sogos.io", ServiceRecipients: routed}, "SEO", "team@sogos.io"},
+		{"no service", Config{ContactEmail: "team@sogos.io", ServiceRecipients: routed, UnroutedRecipient: "triage@sogos.io"}, "", "triage@sogos.io"},
+	}
+	for _, tt := range tests {
+		if got := notificationRecipient(&tt.cfg, tt.service); got != tt.want {
+			t.Errorf("%s: notificationRecipient(%q) = %q, want %q", tt.name, tt.service, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeService(t *testing.T) {
+	tests := []struct {
+		name       string
+		aliases    string
+		maxLen     int
+		overlength string
+		service    string
+		want       string
+		wantErr    bool
+	}{
+		{"empty", "", 0, "", " \n ", "", false},
+		{"multi-line", "", 0, "", "Web\r\nDesign\n\tand SEO", "Web Design and SEO", false},
+		{"alias", "web=Web Design, seo = Search Optimization", 0, "", " WEB ", "Web Design", false},
+		{"alias after collapsing", "web design=Web Design", 0, "", "web\ndesign", "Web Design", false},
+		{"truncated", "", 5, "", "Branding", "Brand", false},
+		{"truncated without trailing space", "", 4, "", "Web Design", "Web", false},
+		{"rejected", "", 5, "reject", "Branding", "", true},
+		{"default limit", "", 0, "", strings.Repeat("a", 81), strings.Repeat("a", 80), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{ServiceAliases: splitList(tt.aliases), ServiceMaxLength: tt.maxLen, ServiceOverlength: tt.overlength}
+			got, err := normalizeService(cfg, tt.service)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("normalizeService(%q) = %q, %v; want %q, error %v", tt.service, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMultiLineServiceOpportunityName(t *testing.T) {
+	cfg := &Config{}
+	service, err := normalizeService(cfg, "Branding\n\nand\r\nWeb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := renderOpportunityName(cfg, ContactRequest{Name: "Jane Doe", Service: service})
+	if name != "Jane Doe - Branding and Web" {
+		t.Errorf("opportunity name = %q, want a single line", name)
+	}
+}
+
+func TestNewRouterContactPath(t *testing.T) {
+	useMemoryStore(t)
+	router := newRouter(&Config{ContactPaths: []string{"/contact", "/v2/contact"}, ContactMethods: []string{"POST", "PUT"}})
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		// An empty object reaches the handler and fails validation
+		{"POST", "/contact", http.StatusBadRequest},
+		{"PUT", "/v2/contact", http.StatusBadRequest},
+		{"GET", "/contact", http.StatusMethodNotAllowed},
+		{"POST", "/api/contact", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/v2/contact", nil))
+	if methods := w.Header().Get("Access-Control-Allow-Methods"); methods != "POST, PUT, OPTIONS" {
+		t.Errorf("Access-Control-Allow-Methods = %q", methods)
+	}
+}
+
+func TestCreateTwentyLeadLeadMode(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	t.Setenv("CRM_LEAD_MODE", "true")
+	t.Setenv("OPPORTUNITY_REUSE_WINDOW", "72h")
+
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Company: "Acme", Service: "Branding", Message: "Hello"}
+	lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+	if err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if lead.LeadID != "lead-1" || lead.OpportunityID != "" {
+		t.Errorf("lead = %+v, want a Lead record and no opportunity", lead)
+	}
+
+	input := stub.input("CreateLead")
+	want := map[string]interface{}{"name": "Jane Doe - Branding", "source": "WEBSITE", "service": "Branding", "personId": "person-1", "companyId": "company-1"}
+	for field, value := range want {
+		if input[field] != value {
+			t.Errorf("lead input %s = %v, want %v", field, input[field], value)
+		}
+	}
+	for _, op := range []string{"CreateOpportunity", "FindRecentOpportunities"} {
+		if n := stub.count(op); n != 0 {
+			t.Errorf("%s called %d times in lead mode", op, n)
+		}
+	}
+	if target := stub.input("CreateNoteTarget"); target["leadId"] != "lead-1" {
+		t.Errorf("note target = %v, want the lead", target)
+	}
+}
+
+func TestCreateTwentyLeadLeadModeFailure(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	stub.on("CreateLead", `{"errors":[{"message":"Unknown type LeadCreateInput"}]}`)
+	t.Setenv("CRM_LEAD_MODE", "true")
+
+	if _, err := createTwentyLead(context.Background(), cfg, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, nil); err == nil {
+		t.Error("expected an error when the Lead object can't be created")
+	}
+}
+
+func TestThrottleNotification(t *testing.T) {
+	_, clock := useMemoryStore(t)
+	cfg := &Config{EmailThrottleWindow: 10 * time.Minute}
+	req := ContactRequest{Email: "jane@example.com", Service: "Branding"}
+
+	if _, throttled := throttleNotification(cfg, req); throttled {
+		t.Fatal("first notification throttled")
+	}
+	if _, throttled := throttleNotification(cfg, ContactRequest{Email: " JANE@example.com", Service: "branding"}); !throttled {
+		t.Error("repeat notification within the window not throttled")
+	}
+	if _, throttled := throttleNotification(cfg, ContactRequest{Email: "jane@example.com", Service: "Web"}); throttled {
+		t.Error("notification for another service throttled")
+	}
+
+	clock.Advance(10 * time.Minute)
+	if _, throttled := throttleNotification(cfg, req); throttled {
+		t.Error("notification after the window throttled")
+	}
+}
+
+func TestThrottleNotificationReleased(t *testing.T) {
+	useMemoryStore(t)
+	cfg := &Config{EmailThrottleWindow: 10 * time.Minute}
+	req := ContactRequest{Email: "jane@example.com", Service: "Branding"}
+
+	key, _ := throttleNotification(cfg, req)
+	store.Delete(key)
+	if _, throttled := throttleNotification(cfg, req); throttled {
+		t.Error("notification throttled after its key was released")
+	}
+}
+
+func TestThrottleNotificationDisabled(t *testing.T) {
+	useMemoryStore(t)
+	req := ContactRequest{Email: "jane@example.com", Service: "Branding"}
+
+	for i := 0; i < 3; i++ {
+		if key, throttled := throttleNotification(&Config{}, req); throttled || key != "" {
+			t.Fatalf("throttleNotification = %q, %v with no window", key, throttled)
+		}
+	}
+}
+
+func TestSendNotificationEmailThrottled(t *testing.T) {
+	_, clock := useMemoryStore(t)
+	useSuppressions(t, clock)
+	cfg := &Config{MailgunAPIKey: "key", MailgunDomain: "mg.example.com", EmailThrottleWindow: 10 * time.Minute}
+	req := ContactRequest{Email: "jane@example.com", Service: "Branding"}
+	throttleNotification(cfg, req)
+
+	// Throttled notifications return before anything is sent
+	if err := sendNotificationEmail(cfg, req, nil); err != nil {
+		t.Fatalf("sendNotificationEmail: %v", err)
+	}
+	if got := suppressions.Counts(time.Hour)[dedupThrottle]; got != 1 {
+		t.Errorf("throttle suppressions = %d, want 1", got)
+	}
+}
+
+func TestCreateTwentyLeadNormalizesNameCase(t *testing.T) {
+	req := ContactRequest{Name: "JANE MCDONALD", Email: "jane@example.com"}
+	tests := []struct {
+		enabled   string
+		wantFirst string
+		wantLast  string
+	}{
+		{"", "JANE", "MCDONALD"},
+		{"true", "Jane", "McDonald"},
+	}
+	for _, tt := range tests {
+		stub, cfg := useTwentyStub(t)
+		t.Setenv("NORMALIZE_NAME_CASE", tt.enabled)
+
+		if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+			t.Fatalf("createTwentyLead: %v", err)
+		}
+		name := stub.input("CreatePerson")["name"].(map[string]interface{})
+		if name["firstName"] != tt.wantFirst || name["lastName"] != tt.wantLast {
+			t.Errorf("NORMALIZE_NAME_CASE=%q: person name = %v, want %s %s", tt.enabled, name, tt.wantFirst, tt.wantLast)
+		}
+	}
+}
+
+func TestGraphQLCallTimeouts(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	t.Setenv("TWENTY_SEARCH_TIMEOUT", "50ms")
+	t.Setenv("TWENTY_MUTATION_TIMEOUT", "2s")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	cfg := &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyRequestAttempts: 1}
+	start := time.Now()
+	_, err := executeTwentyGraphQL(context.Background(), cfg, `query FindPerson { people { edges { node { id } } } }`, nil, searchCall())
+	if err == nil {
+		t.Error("search outlived TWENTY_SEARCH_TIMEOUT")
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("search gave up after %v, want about 50ms", elapsed)
+	}
+
+	if _, err := executeTwentyGraphQL(context.Background(), cfg, `mutation CreatePerson { createPerson { id } }`, nil, mutationCall()); err != nil {
+		t.Errorf("mutation within TWENTY_MUTATION_TIMEOUT failed: %v", err)
+	}
+}
+
+func TestGraphQLCallTimeoutDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		option func() GraphQLOption
+		want   time.Duration
+	}{
+		{"search default", "", searchCall, 10 * time.Second},
+		{"mutation default", "", mutationCall, 30 * time.Second},
+		{"search configured", "3s", searchCall, 3 * time.Second},
+		{"invalid falls back", "soon", searchCall, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Setenv("TWENTY_SEARCH_TIMEOUT", tt.search)
+		t.Setenv("TWENTY_MUTATION_TIMEOUT", "")
+		var options graphQLOptions
+		tt.option()(&options)
+		if options.timeout != tt.want {
+			t.Errorf("%s: timeout = %v, want %v", tt.name, options.timeout, tt.want)
+		}
+	}
+}
+
+// postContact sends body to handleContact and returns the recorded response
+func postContact(cfg *Config, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	handleContact(cfg)(w, r)
+	return w
+}
+
+// responseOf decodes a JSON Response from w
+func responseOf(t *testing.T, w *httptest.ResponseRecorder) Response {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q is not JSON: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestHandleContactMalformedBody(t *testing.T) {
+	useMemoryStore(t)
+	out := captureStandardLog(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid UTF-8", "{\"name\":\"J\xffane\",\"email\":\"jane@example.com\"}"},
+		{"binary", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"},
+		{"UTF-16", "\xff\xfe{\x00\"\x00n\x00"},
+		{"not an object", `["jane@example.com"]`},
+		{"empty", "   "},
+	}
+	for _, tt := range tests {
+		w := postContact(&Config{}, tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, w.Code)
+			continue
+		}
+		if resp := responseOf(t, w); resp.Code != codeValidationError || resp.Message != "Request body must be a UTF-8 encoded JSON object" {
+			t.Errorf("%s: response = %+v", tt.name, resp)
+		}
+	}
+
+	if !strings.Contains(out.String(), "valid UTF-8: false): 89504e470d0a1a0a") {
+		t.Errorf("log lacks a hex sample of the binary body:\n%s", out.String())
+	}
+}
+
+func TestLogInvalidBodyWithoutSample(t *testing.T) {
+	out := captureStandardLog(t)
+	t.Setenv("LOG_INVALID_BODY_SAMPLE", "false")
+
+	logInvalidBody([]byte("secret\xff"))
+	if strings.Contains(out.String(), "736563726574") || !strings.Contains(out.String(), "(7 bytes)") {
+		t.Errorf("log = %q, want the size only", out.String())
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr bool
+	}{
+		{`{"name":"Jane","email":"jane@example.com"}`, false},
+		{`{"name":"Jane","favoriteColor":"blue"}`, true},
+		{`{"name":"Jane"} {"name":"John"}`, true},
+		{`{"name":"Jane"} trailing`, true},
+		{`{"name":"Jane"}   `, false},
+	}
+	for _, tt := range tests {
+		var req ContactRequest
+		if err := decodeStrict([]byte(tt.raw), &req); (err != nil) != tt.wantErr {
+			t.Errorf("decodeStrict(%s) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPriorInquiriesInNotification(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	stub.on("FindPerson", returningPerson)
+	stub.on("CountOpportunities", `{"data":{"opportunities":{"totalCount":3}}}`)
+	t.Setenv("INCLUDE_PRIOR_INQUIRIES", "true")
+	cfg.PriorInquiriesField = "priorInquiries"
+
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+	lead, err := createTwentyLead(context.Background(), cfg, req, nil)
+	if err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if lead.PriorInquiries != 3 {
+		t.Fatalf("PriorInquiries = %d, want 3", lead.PriorInquiries)
+	}
+	if got := stub.input("CreateOpportunity")["priorInquiries"]; got != float64(3) {
+		t.Errorf("opportunity priorInquiries = %v, want 3", got)
+	}
+
+	// Counted before the new opportunity is created
+	ops := strings.Join(stub.operations(), " ")
+	if strings.Index(ops, "CountOpportunities") > strings.Index(ops, "CreateOpportunity") {
+		t.Errorf("operations = %s, want the count first", ops)
+	}
+
+	if body := buildNotificationBody(cfg, req, lead, true); !strings.Contains(body, "Status: Returning lead — 3 prior inquiries") {
+		t.Errorf("notification lacks the prior inquiry count:\n%s", body)
+	}
+}
+
+func TestNotificationPersonStatus(t *testing.T) {
+	tests := []struct {
+		lead *LeadResult
+		want string
+	}{
+		{nil, "New contact"},
+		{&LeadResult{IsNewPerson: true}, "New contact"},
+		{&LeadResult{}, "Existing contact (returning lead)"},
+		{&LeadResult{PriorInquiries: 1}, "Returning lead — 1 prior inquiry"},
+		{&LeadResult{PriorInquiries: 2}, "Returning lead — 2 prior inquiries"},
+		{&LeadResult{PriorInquiries: 2, ReusedOpportunity: true}, "Existing contact (added to open opportunity)"},
+		{&LeadResult{IsNewPerson: true, GroupedWithCompany: true}, "New contact — added to an open opportunity for their company"},
+	}
+	for _, tt := range tests {
+		if got := notificationPersonStatus(tt.lead); got != tt.want {
+			t.Errorf("notificationPersonStatus(%+v) = %q, want %q", tt.lead, got, tt.want)
+		}
+	}
+}
+
+func TestPriorInquiriesDisabled(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	stub.on("FindPerson", returningPerson)
+	t.Setenv("INCLUDE_PRIOR_INQUIRIES", "")
+
+	if _, err := createTwentyLead(context.Background(), cfg, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, nil); err != nil {
+		t.Fatalf("createTwentyLead: %v", err)
+	}
+	if n := stub.count("CountOpportunities"); n != 0 {
+		t.Errorf("counted opportunities %d times with INCLUDE_PRIOR_INQUIRIES unset", n)
+	}
+}
+
+func TestExecuteTwentyGraphQLRetries(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	t.Setenv("TWENTY_RETRY_BASE_DELAY", "1s")
+	clock := useSystemClock(t)
+
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	errs := make(chan error)
+	go func() {
+		cfg := &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyRequestAttempts: 3, RetryBackoff: "fixed"}
+		_, err := executeTwentyGraphQL(context.Background(), cfg, `query FindPerson { people { totalCount } }`, nil)
+		errs <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		waitForWaiters(t, clock, 1)
+		clock.Advance(time.Second)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("executeTwentyGraphQL: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("%d requests, want 3", requests)
+	}
+}
+
+func TestExecuteTwentyGraphQLMutationNotRetried(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	useSystemClock(t)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyRequestAttempts: 3}
+	if _, err := executeTwentyGraphQL(context.Background(), cfg, `mutation CreatePerson { createPerson { id } }`, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1 (a 5xx mutation may have been applied)", requests)
+	}
+}
+
+func TestValidateCRMURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		insecure string
+		wantErr  bool
+	}{
+		{"https://crm.example.com", "", false},
+		{"http://crm.example.com", "", true},
+		{"http://localhost:3000", "true", false},
+		{"ftp://crm.example.com", "true", true},
+		{"crm.example.com", "", true},
+		{"://bad", "", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("ALLOW_INSECURE_CRM", tt.insecure)
+		if err := validateCRMURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("validateCRMURL(%q) with ALLOW_INSECURE_CRM=%q: err = %v, wantErr %v", tt.url, tt.insecure, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExecuteTwentyGraphQLRejectsHTTP(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	cfg := &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key"}
+	t.Setenv("ALLOW_INSECURE_CRM", "")
+	if _, err := executeTwentyGraphQL(context.Background(), cfg, `query SelfTest { people { totalCount } }`, nil); err == nil {
+		t.Error("http Twenty URL accepted")
+	}
+	if requests != 0 {
+		t.Error("the API key was sent over http")
+	}
+
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	if _, err := executeTwentyGraphQL(context.Background(), cfg, `query SelfTest { people { totalCount } }`, nil); err != nil {
+		t.Errorf("http Twenty URL rejected with ALLOW_INSECURE_CRM: %v", err)
+	}
+}
+
+const validContactBody = `{"name":"Jane Doe","email":"jane@example.com","service":"Branding","message":"Hello"}`
+
+func TestHandleContactCRMUnavailable(t *testing.T) {
+	useMemoryStore(t)
+
+	w := postContact(&Config{CRMMissingConfig: "unavailable"}, validContactBody)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if subs, _ := store.ListSubmissions(time.Time{}); len(subs) != 0 {
+		t.Errorf("%d submissions stored, want none", len(subs))
+	}
+}
+
+func TestCRMMissingDegraded(t *testing.T) {
+	cfg := &Config{CRMMissingConfig: "degraded"}
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Title: "CTO"}
+
+	if _, err := createTwentyLead(context.Background(), cfg, req, nil); !errors.Is(err, errCRMNotConfigured) {
+		t.Fatalf("createTwentyLead error = %v, want errCRMNotConfigured", err)
+	}
+
+	body := buildNotificationBody(cfg, req, nil, true)
+	if !strings.Contains(body, "CRM skipped: Twenty is not configured") {
+		t.Errorf("notification lacks the CRM skipped notice:\n%s", body)
+	}
+	if strings.Contains(body, "Not yet in CRM") {
+		t.Errorf("notification reports a CRM failure:\n%s", body)
+	}
+}
+
+func TestProcessLeadStopsRetryingWithoutCRM(t *testing.T) {
+	useSystemClock(t)
+	cfg := &Config{CRMMissingConfig: "degraded", NotifyChannels: []string{"teams"}}
+
+	_, crmErr, _ := processLead(context.Background(), cfg, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, &LeadProgress{}, 3)
+	if !errors.Is(crmErr, errCRMNotConfigured) {
+		t.Fatalf("crmErr = %v, want errCRMNotConfigured", crmErr)
+	}
+	if now := systemClock.Now(); !now.Equal(testEpoch) {
+		t.Errorf("pipeline backed off for %v, want no retries", now.Sub(testEpoch))
+	}
+}
+
+func TestDisambiguateOpportunityName(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		mode     string
+		existing int
+		want     string
+	}{
+		{"date", 0, "Jane Doe - Branding"},
+		{"number", 0, "Jane Doe - Branding"},
+		{"date", 1, "Jane Doe - Branding (2024-03-02)"},
+		{"number", 1, "Jane Doe - Branding #2"},
+		{"number", 4, "Jane Doe - Branding #5"},
+		{"", 3, "Jane Doe - Branding"},
+		{"bogus", 3, "Jane Doe - Branding"},
+	}
+	for _, tt := range tests {
+		if got := disambiguateOpportunityName("Jane Doe - Branding", tt.mode, tt.existing, now); got != tt.want {
+			t.Errorf("disambiguateOpportunityName(%q, %d) = %q, want %q", tt.mode, tt.existing, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTwentyLeadDisambiguatesOpportunityName(t *testing.T) {
+	useSystemClock(t)
+	tests := []struct {
+		name      string
+		mode      string
+		existing  int
+		want      string
+		wantCount int
+	}{
+		{"number with a same-named opportunity", "number", 2, "Jane Doe - Branding #3", 1},
+		{"date with a same-named opportunity", "date", 1, "Jane Doe - Branding (2024-03-01)", 1},
+		{"no same-named opportunity", "number", 0, "Jane Doe - Branding", 1},
+		{"disabled", "", 2, "Jane Doe - Branding", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, cfg := useTwentyStub(t)
+			cfg.OpportunityNameDisambiguate = tt.mode
+			stub.on("FindPerson", returningPerson)
+			stub.on("CountOpportunities", fmt.Sprintf(`{"data":{"opportunities":{"totalCount":%d}}}`, tt.existing))
+
+			req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}
+			if _, err := createTwentyLead(context.Background(), cfg, req, nil); err != nil {
+				t.Fatalf("createTwentyLead: %v", err)
+			}
+			if got := stub.input("CreateOpportunity")["name"]; got != tt.want {
+				t.Errorf("opportunity name = %v, want %q", got, tt.want)
+			}
+			if n := stub.count("CountOpportunities"); n != tt.wantCount {
+				t.Errorf("counted same-named opportunities %d times, want %d", n, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestCountSameNamedOpportunitiesFilter(t *testing.T) {
+	stub, cfg := useTwentyStub(t)
+	stub.on("CountOpportunities", `{"data":{"opportunities":{"totalCount":2}}}`)
+
+	n, err := countSameNamedOpportunities(context.Background(), cfg, "Jane Doe - Branding", "person-9", "company-1")
+	if err != nil || n != 2 {
+		t.Fatalf("countSameNamedOpportunities = %d, %v; want 2", n, err)
+	}
+	filter, _ := json.Marshal(stub.variables("CountOpportunities")["filter"])
+	for _, want := range []string{`"eq":"Jane Doe - Branding"`, `"like":"Jane Doe - Branding #%"`, `"pointOfContactId":{"eq":"person-9"}`, `"companyId":{"eq":"company-1"}`} {
+		if !strings.Contains(string(filter), want) {
+			t.Errorf("filter %s lacks %s", filter, want)
+		}
+	}
+
+	// Without a person or company there is nothing to collide with
+	if n, err := countSameNamedOpportunities(context.Background(), cfg, "Jane Doe - Branding", "", ""); err != nil || n != 0 {
+		t.Errorf("countSameNamedOpportunities without owners = %d, %v; want 0", n, err)
+	}
+	if n := stub.count("CountOpportunities"); n != 1 {
+		t.Errorf("CountOpportunities called %d times, want 1", n)
+	}
+}
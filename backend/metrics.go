@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics. They are only exported, on /metrics, when
+// ENABLE_METRICS is set.
+var (
+	metricSubmissions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sogos_contact_submissions_total",
+		Help: "Contact form submissions received.",
+	})
+	metricLeadsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sogos_crm_leads_created_total",
+		Help: "Leads successfully created in Twenty.",
+	})
+	metricCRMFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sogos_crm_failures_total",
+		Help: "Leads that could not be created in Twenty.",
+	})
+	metricEmailFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sogos_email_failures_total",
+		Help: "Notification emails that failed to send.",
+	})
+	metricGraphQLDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sogos_twenty_graphql_duration_seconds",
+		Help:    "Time spent in Twenty GraphQL calls, including retries.",
+		Buckets: prometheus.DefBuckets,
+	})
+	metricStoreEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sogos_store_entries",
+		Help: "Entries, submissions and company merges held by the in-memory store after the last sweep.",
+	})
+	metricIdempotencyKeys = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sogos_idempotency_keys",
+		Help: "Idempotency keys held after the last sweep.",
+	})
+	metricRateLimitKeys = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sogos_rate_limit_keys",
+		Help: "Rate limit counters held by the in-memory store after the last sweep.",
+	})
+)
+
+// observeStoreSize updates the store size gauges after a sweep
+func observeStoreSize(s sweeper) {
+	metricStoreEntries.Set(float64(s.Len()))
+	if counter, ok := s.(interface{ CountPrefix(prefix string) int }); ok {
+		metricRateLimitKeys.Set(float64(counter.CountPrefix(rateLimitKeyPrefix)))
+	}
+}
+
+// observeIdempotencySize updates the idempotency gauge after a sweep
+func observeIdempotencySize(s sweeper) {
+	metricIdempotencyKeys.Set(float64(s.Len()))
+}
+
+// metricsHandler returns the /metrics handler for a registry holding our
+// metrics plus the Go runtime and process collectors
+func metricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metricSubmissions,
+		metricLeadsCreated,
+		metricCRMFailures,
+		metricEmailFailures,
+		metricGraphQLDuration,
+		metricStoreEntries,
+		metricIdempotencyKeys,
+		metricRateLimitKeys,
+	)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
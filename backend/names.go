@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// nameParticles stay lowercase unless they start the name
+var nameParticles = map[string]bool{
+	"de": true, "da": true, "di": true, "do": true, "dos": true, "das": true,
+	"del": true, "della": true, "der": true, "den": true, "du": true,
+	"la": true, "le": true, "van": true, "von": true, "ter": true, "bin": true,
+}
+
+// romanSuffixes are uppercased
+var romanSuffixes = map[string]bool{
+	"ii": true, "iii": true, "iv": true, "vi": true,
+}
+
+// normalizeNameCase title-cases a name typed entirely in upper or lower
+// case ("JOHN SMITH", "john smith"). Names with mixed case are assumed to be
+// intentional and returned unchanged. Particles like "van" and "de" stay
+// lowercase after the first word, initials are capitalized, hyphenated and
+// apostrophe parts are cased separately (Smith-Jones, O'Brien), and "Mc"
+// prefixes capitalize the following letter (McDonald).
+func normalizeNameCase(name string) string {
+	if name != strings.ToUpper(name) && name != strings.ToLower(name) {
+		return name
+	}
+
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		switch {
+		case i > 0 && nameParticles[word]:
+			// keep lowercase
+		case romanSuffixes[word]:
+			words[i] = strings.ToUpper(word)
+		default:
+			words[i] = capitalizeNamePart(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// capitalizeNamePart capitalizes each hyphen- or apostrophe-separated
+// segment of a lowercase word
+func capitalizeNamePart(word string) string {
+	runes := []rune(word)
+	capitalizeNext := true
+	for i, r := range runes {
+		if capitalizeNext && unicode.IsLetter(r) {
+			runes[i] = unicode.ToUpper(r)
+			capitalizeNext = false
+		}
+		if r == '-' || r == '\'' || r == '’' {
+			capitalizeNext = true
+		}
+	}
+
+	// McDonald, McKay: capitalize the letter after "Mc"
+	if len(runes) > 2 && runes[0] == 'M' && runes[1] == 'c' && unicode.IsLetter(runes[2]) {
+		runes[2] = unicode.ToUpper(runes[2])
+	}
+	return string(runes)
+}
+
+// nameTitles are honorifics dropped from the front of a name
+var nameTitles = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "miss": true, "mx": true,
+	"dr": true, "prof": true, "rev": true, "sir": true,
+}
+
+// nameSuffixes are kept with the last name
+var nameSuffixes = map[string]bool{
+	"jr": true, "sr": true, "ii": true, "iii": true, "iv": true,
+	"phd": true, "md": true, "esq": true,
+}
+
+// nameWordKey folds a name word for the title/suffix/particle tables
+// ("Dr." and "Ph.D." become "dr" and "phd")
+func nameWordKey(word string) string {
+	return strings.ToLower(strings.NewReplacer(".", "", ",", "").Replace(word))
+}
+
+// parseName splits a full name into first and last names for the CRM.
+// Leading titles ("Dr.") are dropped and suffixes ("Jr.", "III") stay with
+// the last name. The last name is the final word plus any particles before
+// it ("van der Berg"); everything else is the first name, so "Mary Anne
+// Smith" is Mary Anne / Smith. "Smith, John" is read as last, first. A
+// single word is a first name only.
+func parseName(name string) (first, last string) {
+	// "Last, First", unless the comma only sets off a suffix ("Doe, Jr.")
+	if before, after, ok := strings.Cut(name, ","); ok && !strings.Contains(after, ",") {
+		if rest := strings.Fields(after); len(rest) > 0 && !nameSuffixes[nameWordKey(rest[0])] {
+			first, _ = parseName(after)
+			last = strings.Join(strings.Fields(before), " ")
+			if first == "" || last == "" {
+				return first + last, ""
+			}
+			return first, last
+		}
+	}
+
+	words := strings.Fields(strings.ReplaceAll(name, ",", " "))
+	for len(words) > 1 && nameTitles[nameWordKey(words[0])] {
+		words = words[1:]
+	}
+
+	var suffixes []string
+	for len(words) > 1 && nameSuffixes[nameWordKey(words[len(words)-1])] {
+		suffixes = append([]string{words[len(words)-1]}, suffixes...)
+		words = words[:len(words)-1]
+	}
+
+	if len(words) == 0 {
+		return "", ""
+	}
+	if len(words) == 1 {
+		return words[0], strings.Join(suffixes, " ")
+	}
+
+	start := len(words) - 1
+	for start > 1 && nameParticles[nameWordKey(words[start-1])] {
+		start--
+	}
+	return strings.Join(words[:start], " "), strings.Join(append(words[start:], suffixes...), " ")
+}
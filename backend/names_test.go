@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantFirst string
+		wantLast  string
+	}{
+		{"", "", ""},
+		{"   ", "", ""},
+		{"Cher", "Cher", ""},
+		{"John Smith", "John", "Smith"},
+		{"  John   Smith  ", "John", "Smith"},
+		{"Mary Anne Smith", "Mary Anne", "Smith"},
+		{"Ludwig van Beethoven", "Ludwig", "van Beethoven"},
+		{"Anna van der Berg", "Anna", "van der Berg"},
+		{"Maria da Silva", "Maria", "da Silva"},
+		{"Dr. Jane Doe", "Jane", "Doe"},
+		{"Mr Mrs John Smith", "John", "Smith"},
+		{"Prof. Madonna", "Madonna", ""},
+		{"Dr.", "Dr.", ""},
+		{"John Smith Jr.", "John", "Smith Jr."},
+		{"Martin Luther King Jr", "Martin Luther", "King Jr"},
+		{"Henry Ford III", "Henry", "Ford III"},
+		{"Jane Doe, PhD", "Jane", "Doe PhD"},
+		{"Dr. Jane Doe Ph.D.", "Jane", "Doe Ph.D."},
+		{"Smith, John", "John", "Smith"},
+		{"Smith, Dr. John", "John", "Smith"},
+		{"van der Berg, Anna", "Anna", "van der Berg"},
+		{"Doe, Jr.", "Doe", "Jr."},
+		{"Smith,", "Smith", ""},
+		{", John", "John", ""},
+	}
+	for _, tt := range tests {
+		first, last := parseName(tt.name)
+		if first != tt.wantFirst || last != tt.wantLast {
+			t.Errorf("parseName(%q) = %q, %q; want %q, %q", tt.name, first, last, tt.wantFirst, tt.wantLast)
+		}
+	}
+}
+
+func TestNormalizeNameCase(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"JOHN SMITH", "John Smith"},
+		{"john smith", "John Smith"},
+		{"  john   smith ", "John Smith"},
+		{"RONALD MCDONALD", "Ronald McDonald"},
+		{"mcdonald", "McDonald"},
+		{"mc", "Mc"},
+		{"SEAN O'BRIEN", "Sean O'Brien"},
+		{"mary smith-jones", "Mary Smith-Jones"},
+		{"ludwig van beethoven", "Ludwig van Beethoven"},
+		{"van morrison", "Van Morrison"},
+		{"henry ford iii", "Henry Ford III"},
+		{"j. r. r. tolkien", "J. R. R. Tolkien"},
+		{"ÉMILE ZOLA", "Émile Zola"},
+		{"John McDonald", "John McDonald"},
+		{"DeShawn jones", "DeShawn jones"},
+	}
+	for _, tt := range tests {
+		if got := normalizeNameCase(tt.name); got != tt.want {
+			t.Errorf("normalizeNameCase(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
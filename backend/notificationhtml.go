@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"strings"
+)
+
+// notificationHTMLTemplate lays the notification out as a simple table with
+// inline styles, since most mail clients ignore stylesheets. html/template
+// escapes every submitted value.
+var notificationHTMLTemplate = template.Must(template.New("notification").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, Helvetica, sans-serif; font-size: 14px; color: #222;">
+<h2 style="font-size: 18px;">New lead from sogos.io website!</h2>
+<table cellpadding="6" cellspacing="0" style="border-collapse: collapse;">
+{{- range .Fields}}
+<tr><th align="left" style="border-bottom: 1px solid #ddd; padding-right: 16px;">{{.Label}}</th><td style="border-bottom: 1px solid #ddd;">{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- with .Details}}
+<ul>
+{{- range .}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- with .Message}}
+<h3 style="font-size: 16px;">Message</h3>
+<p style="white-space: pre-wrap;">{{.}}</p>
+{{- end}}
+{{- if .CRMLink}}
+<p><a href="{{.CRMLink}}">View in CRM</a></p>
+{{- else if .CRMNotice}}
+<p><strong>{{.CRMNotice}}</strong></p>
+{{- with .ManualEntry}}
+<table cellpadding="6" cellspacing="0" style="border-collapse: collapse;">
+{{- range .}}
+<tr><th align="left" style="padding-right: 16px;">{{.Label}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// notificationHTMLData is what notificationHTMLTemplate renders
+type notificationHTMLData struct {
+	Fields      []notificationField
+	Details     []string
+	Message     string
+	CRMLink     string
+	CRMNotice   string
+	ManualEntry []notificationField
+}
+
+// buildNotificationHTML renders the HTML alternative of the notification
+// email, with the same content as buildNotificationBody. It returns "" if
+// rendering fails, leaving the plain-text body on its own.
+func buildNotificationHTML(cfg *Config, req ContactRequest, lead *LeadResult, includeCRMLink bool) string {
+	data := notificationHTMLData{
+		Fields: []notificationField{
+			{"Name", req.Name},
+			{"Company", req.Company},
+			{"Email", req.Email},
+			{"Phone", req.Phone},
+			{"Service Interest", req.Service},
+			{"Status", notificationPersonStatus(lead)},
+		},
+		Details: notificationDetails(cfg, req),
+		Message: messageOrPlaceholder(cfg, req.Message),
+	}
+
+	link, notice, missing := notificationCRMStatus(cfg, lead, includeCRMLink)
+	data.CRMLink = link
+	data.CRMNotice = notice
+	if missing {
+		data.ManualEntry = manualEntryFields(req)
+	}
+
+	var b strings.Builder
+	if err := notificationHTMLTemplate.Execute(&b, data); err != nil {
+		log.Printf("Warning: Failed to render HTML notification: %v", err)
+		return ""
+	}
+	return b.String()
+}
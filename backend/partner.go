@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parsePartnerFieldMap parses PARTNER_FIELD_MAP, a comma-separated list of
+// partnerKey=ourField pairs (e.g. "full_name=name,contact.email=email").
+// Partner keys may use dots to reach into nested objects; our fields are
+// ContactRequest JSON names.
+func parsePartnerFieldMap(spec string) (map[string]string, error) {
+	known := transformableFields(&ContactRequest{})
+	mapping := make(map[string]string)
+
+	for _, pair := range splitList(spec) {
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("invalid mapping %q", pair)
+		}
+		if _, ok := known[to]; !ok {
+			return nil, fmt.Errorf("unknown field %q in mapping %q", to, pair)
+		}
+		mapping[from] = to
+	}
+
+	return mapping, nil
+}
+
+// lookupPartnerValue finds a dotted key in a decoded JSON object and returns
+// it as a string. Missing keys, nulls and nested objects are reported absent.
+func lookupPartnerValue(payload map[string]interface{}, key string) (string, bool) {
+	var value interface{} = payload
+	for _, part := range strings.Split(key, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = obj[part]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		// Plain digits, so numeric phone numbers and IDs don't turn into
+		// exponents
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// mapPartnerPayload builds a ContactRequest from a partner's payload using
+// the field mapping. It fails when a required field (name or email) isn't
+// provided by the payload.
+func mapPartnerPayload(payload map[string]interface{}, mapping map[string]string) (ContactRequest, error) {
+	var req ContactRequest
+	fields := transformableFields(&req)
+	for from, to := range mapping {
+		if value, ok := lookupPartnerValue(payload, from); ok {
+			*fields[to] = value
+		}
+	}
+
+	var missing []string
+	if strings.TrimSpace(req.Name) == "" {
+		missing = append(missing, "name")
+	}
+	if strings.TrimSpace(req.Email) == "" {
+		missing = append(missing, "email")
+	}
+	if len(missing) > 0 {
+		return req, fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return req, nil
+}
+
+// handlePartnerContact accepts a partner's own JSON shape, maps it onto a
+// ContactRequest with PARTNER_FIELD_MAP and processes it like a regular
+// submission. When PARTNER_API_KEY is set, requests must send it in the
+// X-API-Key header.
+func handlePartnerContact(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if key := cfg.PartnerAPIKey; key != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-API-Key")), []byte(key)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		raw, err := readRequestBody(cfg, r.Body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Invalid request body",
+			})
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Request body must be a JSON object",
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		req, err := mapPartnerPayload(payload, cfg.PartnerFieldMap)
+		if err != nil {
+			sendResponse(w, r, http.StatusBadRequest, Response{
+				Success: false,
+				Message: "Partner payload is " + err.Error(),
+				Code:    codeValidationError,
+			})
+			return
+		}
+
+		// Hand the mapped request to the regular contact handler so partner
+		// leads get the same validation and processing
+		body, err := json.Marshal(req)
+		if err != nil {
+			http.Error(w, "Failed to map partner payload", http.StatusInternalServerError)
+			return
+		}
+		mapped := r.Clone(r.Context())
+		mapped.Method = "POST"
+		mapped.Body = io.NopCloser(bytes.NewReader(body))
+		mapped.ContentLength = int64(len(body))
+		mapped.Header.Del("Content-Encoding")
+		handleContact(cfg)(w, mapped)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// samplePartnerMap maps samplePartnerPayload onto our fields
+const samplePartnerMap = "full_name=name, contact.email=email, contact.phone=phone, org=company, interest=service, notes=message, role=title"
+
+const samplePartnerPayload = `{
+	"full_name": "Jane Doe",
+	"contact": {"email": "jane@example.com", "phone": "555-0100"},
+	"org": "Acme",
+	"interest": "Branding",
+	"notes": "Forwarded from partner",
+	"role": "CTO",
+	"ignored": "extra"
+}`
+
+func TestParsePartnerFieldMap(t *testing.T) {
+	mapping, err := parsePartnerFieldMap(samplePartnerMap)
+	if err != nil {
+		t.Fatalf("parsePartnerFieldMap: %v", err)
+	}
+	if mapping["contact.email"] != "email" || mapping["full_name"] != "name" || len(mapping) != 7 {
+		t.Errorf("mapping = %v", mapping)
+	}
+
+	for _, spec := range []string{"full_name", "=name", "full_name=fullName"} {
+		if _, err := parsePartnerFieldMap(spec); err == nil {
+			t.Errorf("parsePartnerFieldMap(%q) accepted", spec)
+		}
+	}
+}
+
+func TestMapPartnerPayload(t *testing.T) {
+	mapping, _ := parsePartnerFieldMap(samplePartnerMap)
+	payload := map[string]interface{}{
+		"full_name": "Jane Doe",
+		"contact":   map[string]interface{}{"email": "jane@example.com", "phone": float64(5550100)},
+		"org":       map[string]interface{}{"name": "Acme"},
+		"role":      nil,
+	}
+
+	req, err := mapPartnerPayload(payload, mapping)
+	if err != nil {
+		t.Fatalf("mapPartnerPayload: %v", err)
+	}
+	if req.Name != "Jane Doe" || req.Email != "jane@example.com" || req.Phone != "5550100" {
+		t.Errorf("req = %+v", req)
+	}
+	if req.Title != "" || req.Company != "" {
+		t.Errorf("req = %+v, want nulls and objects left empty", req)
+	}
+
+	delete(payload, "full_name")
+	delete(payload, "contact")
+	if _, err := mapPartnerPayload(payload, mapping); err == nil || err.Error() != "missing required fields: name, email" {
+		t.Errorf("err = %v, want both required fields reported", err)
+	}
+}
+
+func postPartnerContact(cfg *Config, body, apiKey string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/partner/contact", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		r.Header.Set("X-API-Key", apiKey)
+	}
+	handlePartnerContact(cfg)(w, r)
+	return w
+}
+
+func TestHandlePartnerContact(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+	cfg.PartnerFieldMap, _ = parsePartnerFieldMap(samplePartnerMap)
+	cfg.PartnerAPIKey = "partner-key"
+
+	if w := postPartnerContact(cfg, samplePartnerPayload, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong key: status = %d, want 401", w.Code)
+	}
+
+	w := postPartnerContact(cfg, samplePartnerPayload, "partner-key")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	person := stub.input("CreatePerson")
+	if emails, _ := person["emails"].(map[string]interface{}); emails["primaryEmail"] != "jane@example.com" {
+		t.Errorf("person = %v, want the mapped email", person)
+	}
+	if !strings.Contains(stub.noteBody(), "Forwarded from partner") {
+		t.Errorf("note = %q, want the mapped message", stub.noteBody())
+	}
+}
+
+func TestHandlePartnerContactRejects(t *testing.T) {
+	useMemoryStore(t)
+	cfg := &Config{CRMMissingConfig: "unavailable"}
+
+	tests := []struct {
+		name    string
+		mapping string
+		body    string
+		want    int
+	}{
+		{"unmapped required field", "full_name=name", samplePartnerPayload, http.StatusBadRequest},
+		{"required field missing from payload", samplePartnerMap, `{"full_name":"Jane Doe"}`, http.StatusBadRequest},
+		{"not an object", samplePartnerMap, `["Jane Doe"]`, http.StatusBadRequest},
+		// Mapped requests get the regular validation too
+		{"invalid email", samplePartnerMap, `{"full_name":"Jane Doe","contact":{"email":"not-an-email"}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		cfg.PartnerFieldMap, _ = parsePartnerFieldMap(tt.mapping)
+		if w := postPartnerContact(cfg, tt.body, ""); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// countryCallingCodes maps country-code TLDs to their calling code. Only
+// TLDs that are reliably national are listed; ones widely used as generic
+// domains (.io, .co, .ai, .me, .tv, ...) are left out on purpose.
+var countryCallingCodes = map[string]string{
+	"at": "43",
+	"au": "61",
+	"be": "32",
+	"br": "55",
+	"ca": "1",
+	"ch": "41",
+	"cn": "86",
+	"cz": "420",
+	"de": "49",
+	"dk": "45",
+	"es": "34",
+	"fi": "358",
+	"fr": "33",
+	"gr": "30",
+	"ie": "353",
+	"in": "91",
+	"it": "39",
+	"jp": "81",
+	"kr": "82",
+	"mx": "52",
+	"nl": "31",
+	"no": "47",
+	"nz": "64",
+	"pl": "48",
+	"pt": "351",
+	"se": "46",
+	"uk": "44",
+	"us": "1",
+	"za": "27",
+}
+
+// callingCodeForCountry returns the calling code for an ISO 3166-1 alpha-2
+// country code from the countryCallingCodes table
+func callingCodeForCountry(country string) (string, bool) {
+	tld := strings.ToLower(country)
+	if tld == "gb" {
+		tld = "uk"
+	}
+	code, ok := countryCallingCodes[tld]
+	return code, ok
+}
+
+// internationalPhonePattern matches a phone written with an explicit
+// country code (leading + or 00)
+var internationalPhonePattern = regexp.MustCompile(`^\s*(\+|00)`)
+
+// phoneCountryMismatch compares the phone's country code with the country
+// implied by the email's TLD and describes the mismatch, or returns "". The
+// rules are conservative: the phone must carry an explicit country code
+// (local numbers would be read as US), and the email must end in a listed
+// national TLD.
+func phoneCountryMismatch(email, phone string) string {
+	if !internationalPhonePattern.MatchString(phone) {
+		return ""
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(email[at+1:]), "."))
+	tld := domain[strings.LastIndex(domain, ".")+1:]
+	code, ok := countryCallingCodes[tld]
+	if !ok {
+		return ""
+	}
+
+	digits := nonDigitPattern.ReplaceAllString(phone, "")
+	if !strings.HasPrefix(strings.TrimSpace(phone), "+") {
+		digits = strings.TrimPrefix(digits, "00")
+	}
+	if len(digits) < 8 || strings.HasPrefix(digits, code) {
+		return ""
+	}
+
+	return fmt.Sprintf("phone %s doesn't match the email's .%s domain (+%s)", phone, tld, code)
+}
+
+// phoneCountryWarning returns the mismatch for req when PHONE_COUNTRY_CHECK
+// is enabled. It only ever flags a lead, never rejects one.
+func phoneCountryWarning(req ContactRequest) string {
+	if !envBool("PHONE_COUNTRY_CHECK") {
+		return ""
+	}
+	return phoneCountryMismatch(req.Email, req.Phone)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPhoneCountryMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		phone    string
+		mismatch bool
+	}{
+		{"German email, US phone", "jan@firma.de", "+1 415 555 0100", true},
+		{"German email, German phone", "jan@firma.de", "+49 30 1234567", false},
+		{"00 prefix", "jan@firma.de", "0044 20 7946 0958", true},
+		{"00 prefix matching", "jan@firma.de", "0049 30 1234567", false},
+		{"UK email on a subdomain", "sam@mail.acme.co.uk", "+33 1 23 45 67 89", true},
+		{"shared calling code", "sam@acme.ca", "+1 416 555 0100", false},
+		{"local number is never flagged", "jan@firma.de", "(415) 555-0100", false},
+		{"generic TLD", "jane@acme.com", "+49 30 1234567", false},
+		{"generic country TLD", "jane@startup.io", "+49 30 1234567", false},
+		{"too short to judge", "jan@firma.de", "+1 555", false},
+		{"no phone", "jan@firma.de", "", false},
+		{"malformed email", "firma.de", "+1 415 555 0100", false},
+		{"uppercase domain and trailing dot", "JAN@FIRMA.DE.", "+1 415 555 0100", true},
+	}
+	for _, tt := range tests {
+		got := phoneCountryMismatch(tt.email, tt.phone)
+		if (got != "") != tt.mismatch {
+			t.Errorf("%s: phoneCountryMismatch(%q, %q) = %q, want mismatch %v", tt.name, tt.email, tt.phone, got, tt.mismatch)
+		}
+	}
+
+	if got := phoneCountryMismatch("jan@firma.de", "+1 415 555 0100"); got != "phone +1 415 555 0100 doesn't match the email's .de domain (+49)" {
+		t.Errorf("mismatch = %q", got)
+	}
+}
+
+func TestPhoneCountryWarningFlagsOnly(t *testing.T) {
+	req := ContactRequest{Name: "Jan Schmidt", Email: "jan@firma.de", Phone: "+1 415 555 0100"}
+
+	t.Setenv("PHONE_COUNTRY_CHECK", "")
+	cfg := &Config{PhoneCountryMismatchField: "phoneCheck"}
+	if got := phoneCountryWarning(req); got != "" {
+		t.Errorf("warning = %q with the check off", got)
+	}
+	if _, ok := opportunityCustomFields(cfg, req, &LeadResult{}, "")["phoneCheck"]; ok {
+		t.Error("CRM tag written with the check off")
+	}
+
+	t.Setenv("PHONE_COUNTRY_CHECK", "true")
+	if body := buildNotificationBody(&Config{}, req, nil, false); !strings.Contains(body, "⚠️ Check: phone +1 415 555 0100 doesn't match the email's .de domain") {
+		t.Errorf("notification lacks the mismatch flag:\n%s", body)
+	}
+	if tag := opportunityCustomFields(cfg, req, &LeadResult{}, "")["phoneCheck"]; tag == nil || !strings.Contains(tag.(string), ".de domain") {
+		t.Errorf("CRM tag = %v, want the mismatch", tag)
+	}
+}
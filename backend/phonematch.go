@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// nonDigitPattern matches everything but digits
+var nonDigitPattern = regexp.MustCompile(`\D`)
+
+// phoneSearchVariants returns the forms a stored phone may take, best match
+// first: E.164, E.164 digits without the plus, the national number, and the
+// last ten digits. National numbers are read in country (see
+// normalizePhone); numbers that don't normalize have no variants.
+func phoneSearchVariants(phone, country string) []string {
+	e164 := normalizePhone(phone, country)
+	if e164 == "" {
+		return nil
+	}
+
+	digits := strings.TrimPrefix(e164, "+")
+	variants := []string{e164, digits}
+	if strings.HasPrefix(digits, "1") && len(digits) == 11 {
+		variants = append(variants, digits[1:])
+	}
+	if len(digits) > 10 {
+		variants = append(variants, digits[len(digits)-10:])
+	}
+
+	var unique []string
+	seen := map[string]bool{}
+	for _, v := range variants {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// bestPhoneMatch returns the index of the stored number that matches the
+// earliest variant, comparing digits only so formatting doesn't matter, or
+// -1 if none match
+func bestPhoneMatch(variants, stored []string) int {
+	best, bestRank := -1, len(variants)
+	for i, number := range stored {
+		digits := nonDigitPattern.ReplaceAllString(number, "")
+		for rank, v := range variants {
+			if rank < bestRank && digits == strings.TrimPrefix(v, "+") {
+				best, bestRank = i, rank
+			}
+		}
+	}
+	return best
+}
+
+// phoneCandidate is a person returned by a phone search, as both the
+// GraphQL and REST APIs render it
+type phoneCandidate struct {
+	ID     string `json:"id"`
+	Phones struct {
+		PrimaryPhoneNumber      string `json:"primaryPhoneNumber"`
+		PrimaryPhoneCallingCode string `json:"primaryPhoneCallingCode"`
+	} `json:"phones"`
+}
+
+// findPersonByPhone returns the ID of the person whose stored phone matches
+// any variant of phone, or "" if there is none. Twenty may hold the number
+// with or without its calling code depending on how it was entered.
+func findPersonByPhone(ctx context.Context, cfg *Config, phone string) (string, error) {
+	variants := phoneSearchVariants(phone, defaultPhoneCountry(cfg))
+	if len(variants) == 0 {
+		return "", nil
+	}
+
+	searchQuery := `
+		query FindPersonByPhone($filter: PersonFilterInput) {
+			people(filter: $filter) {
+				edges {
+					node {
+						id
+						phones {
+							primaryPhoneNumber
+							primaryPhoneCallingCode
+						}
+					}
+				}
+			}
+		}
+	`
+
+	var or []map[string]interface{}
+	for _, v := range variants {
+		or = append(or, map[string]interface{}{
+			"phones": map[string]interface{}{
+				"primaryPhoneNumber": map[string]interface{}{"eq": v},
+			},
+		})
+	}
+
+	resp, err := executeTwentyGraphQL(ctx, cfg, searchQuery, map[string]interface{}{
+		"filter": map[string]interface{}{"or": or},
+	}, searchCall())
+	if err != nil {
+		return "", err
+	}
+
+	var searchResult struct {
+		People struct {
+			Edges []struct {
+				Node phoneCandidate `json:"node"`
+			} `json:"edges"`
+		} `json:"people"`
+	}
+
+	if err := json.Unmarshal(resp.Data, &searchResult); err != nil {
+		return "", fmt.Errorf("failed to parse person search response: %w", err)
+	}
+
+	var candidates []phoneCandidate
+	for _, edge := range searchResult.People.Edges {
+		candidates = append(candidates, edge.Node)
+	}
+	return bestPhoneCandidate(variants, candidates), nil
+}
+
+// bestPhoneCandidate returns the ID of the candidate whose stored phone
+// best matches variants, or "" if none does
+func bestPhoneCandidate(variants []string, candidates []phoneCandidate) string {
+	// Rank on the full number where a calling code is stored separately
+	var stored []string
+	for _, c := range candidates {
+		stored = append(stored, c.Phones.PrimaryPhoneCallingCode+c.Phones.PrimaryPhoneNumber)
+	}
+	best := bestPhoneMatch(variants, stored)
+	if best < 0 {
+		// The filter matched, so fall back to the stored number alone
+		for i, c := range candidates {
+			stored[i] = c.Phones.PrimaryPhoneNumber
+		}
+		best = bestPhoneMatch(variants, stored)
+	}
+	if best < 0 {
+		return ""
+	}
+	return candidates[best].ID
+}
+
+// findExistingPersonByPhone looks the person up by phone when
+// PERSON_PHONE_MATCH is set, for leads whose email isn't in the CRM yet.
+// search is the API-specific lookup. Failures are logged and treated as no
+// match.
+func findExistingPersonByPhone(ctx context.Context, phone string, search func(ctx context.Context, phone string) (string, error)) string {
+	if !envBool("PERSON_PHONE_MATCH") || phone == "" {
+		return ""
+	}
+
+	personID, err := search(ctx, phone)
+	if err != nil {
+		log.Printf("Warning: Failed to search people by phone: %v", err)
+		return ""
+	}
+	if personID != "" {
+		log.Printf("Matched existing person %s by phone number", personID)
+	}
+	return personID
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPhoneSearchVariants(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  []string
+	}{
+		{"+1 (555) 123-4567", []string{"+15551234567", "15551234567", "5551234567"}},
+		{"555-123-4567", []string{"+15551234567", "15551234567", "5551234567"}},
+		{"+44 20 7946 0958", []string{"+442079460958", "442079460958", "2079460958"}},
+		{"+49 3012345", []string{"+493012345", "493012345"}},
+		{"12", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := phoneSearchVariants(tt.phone, "US"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("phoneSearchVariants(%q) = %v, want %v", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestBestPhoneMatch(t *testing.T) {
+	variants := []string{"+15551234567", "15551234567", "5551234567"}
+	tests := []struct {
+		name   string
+		stored []string
+		want   int
+	}{
+		{"bare national number", []string{"5551234567"}, 0},
+		{"formatted E.164", []string{"+1 555-123-4567"}, 0},
+		{"E.164 beats national", []string{"(555) 123-4567", "+15551234567"}, 1},
+		{"first of equal matches", []string{"+15551234567", "1-555-123-4567"}, 0},
+		{"no match", []string{"5559999999"}, -1},
+		{"nothing stored", nil, -1},
+	}
+	for _, tt := range tests {
+		if got := bestPhoneMatch(variants, tt.stored); got != tt.want {
+			t.Errorf("%s: bestPhoneMatch = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// phonePeople is a FindPersonByPhone response with one person per
+// (id, calling code, number) triple
+func phonePeople(people ...[3]string) string {
+	edges := ""
+	for i, p := range people {
+		if i > 0 {
+			edges += ","
+		}
+		edges += fmt.Sprintf(`{"node":{"id":%q,"phones":{"primaryPhoneCallingCode":%q,"primaryPhoneNumber":%q}}}`, p[0], p[1], p[2])
+	}
+	return `{"data":{"people":{"edges":[` + edges + `]}}}`
+}
+
+func TestFindPersonByPhoneStoredFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"bare number without calling code", phonePeople([3]string{"person-1", "", "5551234567"}), "person-1"},
+		{"national number with calling code", phonePeople([3]string{"person-1", "+1", "5551234567"}), "person-1"},
+		{"full E.164 number", phonePeople([3]string{"person-1", "", "+15551234567"}), "person-1"},
+		{"E.164 digits without plus", phonePeople([3]string{"person-1", "", "15551234567"}), "person-1"},
+		{"full number ranks first", phonePeople([3]string{"person-1", "", "5551234567"}, [3]string{"person-2", "+1", "5551234567"}), "person-2"},
+		{"no people", `{"data":{"people":{"edges":[]}}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, cfg := useTwentyStub(t)
+			stub.on("FindPersonByPhone", tt.response)
+
+			got, err := findPersonByPhone(context.Background(), cfg, "+1 (555) 123-4567")
+			if err != nil || got != tt.want {
+				t.Errorf("findPersonByPhone = %q, %v; want %q", got, err, tt.want)
+			}
+
+			// Every variant is searched for
+			or, _ := stub.variables("FindPersonByPhone")["filter"].(map[string]interface{})["or"].([]interface{})
+			if len(or) != 3 {
+				t.Errorf("filter searched %d variants, want 3: %v", len(or), or)
+			}
+		})
+	}
+}
+
+func TestFindOrCreatePersonMatchesStoredPhoneFormat(t *testing.T) {
+	t.Setenv("PERSON_PHONE_MATCH", "true")
+	stub, cfg := useTwentyStub(t)
+	stub.on("FindPersonByPhone", phonePeople([3]string{"person-7", "", "5551234567"}))
+
+	id, isNew, err := findOrCreatePerson(context.Background(), cfg, "Jane", "Doe", "jane@example.com", "+1 555 123 4567", "", "", nil)
+	if err != nil || id != "person-7" || isNew {
+		t.Fatalf("findOrCreatePerson = %q, %v, %v; want the existing person-7", id, isNew, err)
+	}
+	if n := stub.count("CreatePerson"); n != 0 {
+		t.Errorf("%d people created, want none", n)
+	}
+
+	// Off by default
+	t.Setenv("PERSON_PHONE_MATCH", "")
+	if _, isNew, _ := findOrCreatePerson(context.Background(), cfg, "Jane", "Doe", "jane@example.com", "+1 555 123 4567", "", "", nil); !isNew {
+		t.Errorf("matched by phone with PERSON_PHONE_MATCH unset")
+	}
+}
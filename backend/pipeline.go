@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// leadPipelineAttempts returns how many times the CRM + notification
+// pipeline is attempted as a unit (default 1, i.e. no retry)
+func leadPipelineAttempts(cfg *Config) int {
+	if cfg.LeadPipelineAttempts > 0 {
+		return cfg.LeadPipelineAttempts
+	}
+	return 1
+}
+
+// leadPipelineBackoff returns the delays between pipeline attempts: a fixed
+// LEAD_PIPELINE_RETRY_DELAY when set, otherwise the shared retryBackoff
+func leadPipelineBackoff(cfg *Config) Backoff {
+	if cfg.LeadPipelineRetryDelay > 0 {
+		return Backoff{Strategy: backoffFixed, Base: cfg.LeadPipelineRetryDelay}
+	}
+	return retryBackoff(cfg)
+}
+
+// processLead creates the lead in Twenty and sends the notification email,
+// trying the pipeline as a unit up to attempts times. Only queued work
+// retries; request handlers pass 1 so nobody waits out the backoff. Progress
+// is kept across attempts, and across replays of a stored submission, so a
+// retry resumes where the last one stopped: records that were already
+// created are not created again and each notification is sent only once.
+//
+// The email waits for the CRM step until the final attempt, after which it
+// goes out without a CRM link rather than not at all. Other notification
+// channels are best-effort and posted once the pipeline has settled.
+func processLead(ctx context.Context, cfg *Config, req ContactRequest, progress *LeadProgress, attempts int) (lead *LeadResult, crmErr error, emailErr error) {
+	backoff := leadPipelineBackoff(cfg)
+	crmDone := progress.CRMDone
+	notified := progress.Notified || !notifyChannelEnabled(cfg, "email")
+	if crmDone {
+		lead = &progress.Lead
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if !crmDone {
+			spanCtx, span := startSpan(ctx, "twenty.create_lead", attribute.Int("attempt", attempt))
+			lead, crmErr = createTwentyLead(spanCtx, cfg, req, &progress.Lead)
+			endSpan(span, crmErr)
+			progress.CRMDone = crmErr == nil
+			// A missing configuration won't fix itself, so stop retrying the CRM
+			crmDone = crmErr == nil || errors.Is(crmErr, errCRMNotConfigured)
+		}
+
+		if !notified && (crmDone || attempt == attempts) {
+			_, span := startSpan(ctx, "mailgun.send_notification", attribute.Int("attempt", attempt))
+			emailErr = sendNotificationEmail(cfg, req, lead)
+			endSpan(span, emailErr)
+			notified = emailErr == nil
+			progress.Notified = notified
+		}
+
+		if crmDone && notified {
+			break
+		}
+
+		if attempt < attempts {
+			log.Printf("Lead pipeline attempt %d/%d incomplete (email_hash=%s, crm: %v, email: %v), retrying",
+				attempt, attempts, req.EmailHash, crmErr, emailErr)
+			systemClock.Sleep(backoff.Delay(attempt))
+		}
+	}
+
+	if notifyChannelEnabled(cfg, "teams") && !progress.TeamsNotified {
+		_, span := startSpan(ctx, "teams.notify")
+		notifyTeams(cfg, req, lead)
+		span.End()
+		progress.TeamsNotified = true
+	}
+
+	return lead, crmErr, emailErr
+}
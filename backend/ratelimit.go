@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitWindow is the period RATE_LIMIT_PER_MINUTE applies to
+const rateLimitWindow = time.Minute
+
+// rateLimitKeyPrefix starts the store key of every rate limit counter
+const rateLimitKeyPrefix = "rate-limit:"
+
+// parseOriginRateLimits parses RATE_LIMIT_ORIGINS, a comma-separated list
+// of origin=limit pairs ("https://sogos.io=20,https://partner.example=2"),
+// into per-minute limits keyed by lowercased origin
+func parseOriginRateLimits(raw string) (map[string]int64, error) {
+	limits := map[string]int64{}
+	for _, pair := range splitList(raw) {
+		origin, v, ok := strings.Cut(pair, "=")
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if !ok || origin == "" {
+			return nil, fmt.Errorf("entry %q is not origin=limit", pair)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid limit for %s: %q", origin, v)
+		}
+		limits[origin] = n
+	}
+	return limits, nil
+}
+
+// requestRateLimit returns the per-minute limit for r and the counter it is
+// kept in. Origins listed in RATE_LIMIT_ORIGINS get their own limit and
+// counter per client IP, as long as CORS allows the origin; everything else
+// shares RATE_LIMIT_PER_MINUTE. The Origin header is only a hint from the
+// browser, so this tunes allowances per site rather than enforcing them.
+func requestRateLimit(cfg *Config, r *http.Request) (int64, string) {
+	key := rateLimitKeyPrefix + clientIP(cfg, r)
+	origin := strings.ToLower(strings.TrimSuffix(r.Header.Get("Origin"), "/"))
+	if origin == "" || allowedOrigin(cfg, r.Header.Get("Origin")) == "" {
+		return cfg.RateLimitPerMinute, key
+	}
+	if limit, ok := cfg.RateLimitOrigins[origin]; ok {
+		return limit, key + "|" + origin
+	}
+	return cfg.RateLimitPerMinute, key
+}
+
+// rateLimited counts the request against its client IP (and origin, see
+// requestRateLimit) and reports whether it is over the limit. Counters live
+// in the shared store, so the limit holds across instances with the
+// Postgres backend and expired windows are swept by the store janitor.
+// Store errors let the request through.
+func rateLimited(cfg *Config, r *http.Request) bool {
+	limit, key := requestRateLimit(cfg, r)
+	if limit == 0 {
+		return false
+	}
+
+	n, err := store.Incr(key, rateLimitWindow)
+	if err != nil {
+		log.Printf("Warning: Failed to check rate limit: %v", err)
+		return false
+	}
+	return n > limit
+}
+
+// rateLimit rejects clients over their limit (RATE_LIMIT_PER_MINUTE, or
+// the origin's RATE_LIMIT_ORIGINS entry) with 429 before they reach next
+func rateLimit(cfg *Config, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "OPTIONS" && rateLimited(cfg, r) {
+			stats.RateLimited.Add(1)
+			logThrottled("Rate limited contact request from %s", clientIP(cfg, r))
+			w.Header().Set("Retry-After", strconv.Itoa(int(rateLimitWindow.Seconds())))
+			sendResponse(w, r, http.StatusTooManyRequests, Response{
+				Success: false,
+				Message: "Too many requests. Please wait a minute and try again.",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func rateLimitRequest(origin string) *http.Request {
+	r := httptest.NewRequest("POST", "/api/contact", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	return r
+}
+
+// allowedRequests counts how many of n requests get past rateLimited
+func allowedRequests(cfg *Config, origin string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if !rateLimited(cfg, rateLimitRequest(origin)) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestRateLimitPerOrigin(t *testing.T) {
+	origins, _ := parseOriginRateLimits("https://sogos.io=5, https://partner.example/=1")
+	cfg := &Config{
+		AllowedOrigins:     []string{"https://sogos.io", "https://partner.example", "https://other.example"},
+		RateLimitPerMinute: 2,
+		RateLimitOrigins:   origins,
+	}
+	useMemoryStore(t)
+
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"https://sogos.io", 5},
+		{"https://partner.example", 1},
+		// Unlisted and disallowed origins share the default counter
+		{"https://other.example", 2},
+		{"https://evil.example", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := allowedRequests(cfg, tt.origin, 10); got != tt.want {
+			t.Errorf("origin %q: %d requests allowed, want %d", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitOriginWindow(t *testing.T) {
+	cfg := &Config{RateLimitOrigins: map[string]int64{"https://partner.example": 1}}
+	_, clock := useMemoryStore(t)
+
+	if got := allowedRequests(cfg, "https://partner.example", 3); got != 1 {
+		t.Fatalf("%d requests allowed, want 1", got)
+	}
+	clock.Advance(rateLimitWindow)
+	if got := allowedRequests(cfg, "https://partner.example", 3); got != 1 {
+		t.Errorf("%d requests allowed in the next window, want 1", got)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	useMemoryStore(t)
+
+	if got := allowedRequests(&Config{}, "", 20); got != 20 {
+		t.Errorf("%d requests allowed, want all 20", got)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	useMemoryStore(t)
+
+	handler := rateLimit(&Config{RateLimitPerMinute: 1}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	statuses := []int{http.StatusOK, http.StatusTooManyRequests}
+	for i, want := range statuses {
+		w := httptest.NewRecorder()
+		handler(w, rateLimitRequest(""))
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("Retry-After = %q, want 60", w.Header().Get("Retry-After"))
+		}
+	}
+
+	// Preflights are never counted
+	w := httptest.NewRecorder()
+	r := rateLimitRequest("")
+	r.Method = "OPTIONS"
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("OPTIONS status = %d, want 200", w.Code)
+	}
+}
+
+func TestParseOriginRateLimits(t *testing.T) {
+	limits, err := parseOriginRateLimits("https://Sogos.io/=20, https://partner.example=0")
+	if err != nil {
+		t.Fatalf("parseOriginRateLimits: %v", err)
+	}
+	if limits["https://sogos.io"] != 20 || limits["https://partner.example"] != 0 || len(limits) != 2 {
+		t.Errorf("limits = %v", limits)
+	}
+
+	for _, raw := range []string{"https://sogos.io", "=5", "https://sogos.io=lots", "https://sogos.io=-1"} {
+		if _, err := parseOriginRateLimits(raw); err == nil {
+			t.Errorf("parseOriginRateLimits(%q) succeeded, want an error", raw)
+		}
+	}
+}
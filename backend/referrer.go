@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxReferrerChainEntries caps how many URLs of a referrer chain are kept
+const maxReferrerChainEntries = 20
+
+// maxReferrerURLLength caps each URL in a referrer chain
+const maxReferrerURLLength = 500
+
+// normalizeReferrerChain trims the URLs of a referrer chain, dropping empty
+// ones and shortening overlong ones. Chains longer than
+// maxReferrerChainEntries keep the first touch and the most recent URLs,
+// since those matter most for attribution.
+func normalizeReferrerChain(chain []string) []string {
+	var cleaned []string
+	for _, u := range chain {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if runes := []rune(u); len(runes) > maxReferrerURLLength {
+			u = string(runes[:maxReferrerURLLength])
+		}
+		cleaned = append(cleaned, u)
+	}
+
+	if len(cleaned) > maxReferrerChainEntries {
+		recent := cleaned[len(cleaned)-(maxReferrerChainEntries-1):]
+		cleaned = append([]string{cleaned[0]}, recent...)
+	}
+	return cleaned
+}
+
+// referrerChainSummary describes the first and last touch of a chain, or ""
+// for an empty chain
+func referrerChainSummary(chain []string) string {
+	switch len(chain) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("First/Last Touch: %s", chain[0])
+	default:
+		return fmt.Sprintf("First Touch: %s\nLast Touch: %s (%d pages)", chain[0], chain[len(chain)-1], len(chain))
+	}
+}
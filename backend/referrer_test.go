@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeReferrerChain(t *testing.T) {
+	if got := normalizeReferrerChain([]string{" https://google.com ", "", "  ", "/pricing"}); !reflect.DeepEqual(got, []string{"https://google.com", "/pricing"}) {
+		t.Errorf("chain = %q, want trimmed URLs without blanks", got)
+	}
+	if got := normalizeReferrerChain(nil); got != nil {
+		t.Errorf("chain = %q, want nil", got)
+	}
+
+	long := "/" + strings.Repeat("é", maxReferrerURLLength+10)
+	if got := normalizeReferrerChain([]string{long}); len([]rune(got[0])) != maxReferrerURLLength {
+		t.Errorf("URL kept %d characters, want %d", len([]rune(got[0])), maxReferrerURLLength)
+	}
+}
+
+func TestNormalizeReferrerChainTruncates(t *testing.T) {
+	var chain []string
+	for i := 1; i <= maxReferrerChainEntries+5; i++ {
+		chain = append(chain, fmt.Sprintf("/page-%d", i))
+	}
+
+	got := normalizeReferrerChain(chain)
+	if len(got) != maxReferrerChainEntries {
+		t.Fatalf("chain has %d entries, want %d", len(got), maxReferrerChainEntries)
+	}
+	// The first touch survives along with the most recent pages
+	if got[0] != "/page-1" || got[1] != "/page-7" || got[len(got)-1] != "/page-25" {
+		t.Errorf("chain = %q, want /page-1 then /page-7 to /page-25", got)
+	}
+
+	exact := chain[:maxReferrerChainEntries]
+	if got := normalizeReferrerChain(exact); !reflect.DeepEqual(got, exact) {
+		t.Errorf("chain at the cap was changed: %q", got)
+	}
+}
+
+func TestReferrerChainSummary(t *testing.T) {
+	tests := []struct {
+		chain []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"https://google.com"}, "First/Last Touch: https://google.com"},
+		{[]string{"https://google.com", "/blog", "/pricing"}, "First Touch: https://google.com\nLast Touch: /pricing (3 pages)"},
+	}
+	for _, tt := range tests {
+		if got := referrerChainSummary(tt.chain); got != tt.want {
+			t.Errorf("referrerChainSummary(%q) = %q, want %q", tt.chain, got, tt.want)
+		}
+	}
+}
+
+func TestReferrerChainInNotificationAndOpportunity(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", ReferrerChain: []string{"https://google.com", "/blog", "/pricing"}}
+
+	body := buildNotificationBody(&Config{}, req, nil, false)
+	for _, want := range []string{"First Touch: https://google.com", "Last Touch: /pricing (3 pages)"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("notification lacks %q:\n%s", want, body)
+		}
+	}
+
+	cfg := &Config{ReferrerChainField: "journey"}
+	fields := opportunityCustomFields(cfg, req, &LeadResult{}, "")
+	if fields["journey"] != "https://google.com\n/blog\n/pricing" {
+		t.Errorf("journey field = %q, want one URL per line", fields["journey"])
+	}
+	if _, ok := opportunityCustomFields(&Config{}, req, &LeadResult{}, "")["journey"]; ok {
+		t.Error("journey field written without REFERRER_CHAIN_FIELD")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// stagingSubjectPrefix marks emails sent in MAILGUN_SANDBOX mode
+const stagingSubjectPrefix = "[STAGING] "
+
+// applyMailgunSandbox redirects an outgoing email when MAILGUN_SANDBOX is
+// set: every recipient is replaced by MAILGUN_SANDBOX_RECIPIENT (an
+// authorized sandbox address) and the subject is prefixed with [STAGING].
+// The intended recipients are logged. Sandbox mode without a configured
+// recipient is an error, so staging can never fall back to real addresses.
+func applyMailgunSandbox(cfg *Config, subject string, recipients []string) (string, []string, error) {
+	if !envBool("MAILGUN_SANDBOX") {
+		return subject, recipients, nil
+	}
+
+	sandboxRecipient := cfg.MailgunSandboxRecipient
+	if sandboxRecipient == "" {
+		return "", nil, fmt.Errorf("MAILGUN_SANDBOX is set but MAILGUN_SANDBOX_RECIPIENT is not")
+	}
+
+	log.Printf("Mailgun sandbox: redirecting %q from %s to %s", subject, strings.Join(recipients, ", "), sandboxRecipient)
+	return stagingSubjectPrefix + subject, []string{sandboxRecipient}, nil
+}
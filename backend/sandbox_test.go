@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyMailgunSandbox(t *testing.T) {
+	recipients := []string{"sales@sogos.io", "cc@sogos.io"}
+
+	t.Setenv("MAILGUN_SANDBOX", "")
+	cfg := &Config{MailgunSandboxRecipient: "qa@sandbox.example.com"}
+	subject, to, err := applyMailgunSandbox(cfg, "🎯 New Lead: Jane Doe", recipients)
+	if err != nil || subject != "🎯 New Lead: Jane Doe" || !reflect.DeepEqual(to, recipients) {
+		t.Errorf("outside sandbox mode: %q, %v, %v; want the email unchanged", subject, to, err)
+	}
+
+	t.Setenv("MAILGUN_SANDBOX", "true")
+	out := captureStandardLog(t)
+	subject, to, err = applyMailgunSandbox(cfg, "🎯 New Lead: Jane Doe", recipients)
+	if err != nil {
+		t.Fatalf("applyMailgunSandbox: %v", err)
+	}
+	if subject != "[STAGING] 🎯 New Lead: Jane Doe" {
+		t.Errorf("subject = %q, want the [STAGING] prefix", subject)
+	}
+	if !reflect.DeepEqual(to, []string{"qa@sandbox.example.com"}) {
+		t.Errorf("recipients = %v, want only the sandbox recipient", to)
+	}
+	if !strings.Contains(out.String(), "from sales@sogos.io, cc@sogos.io to qa@sandbox.example.com") {
+		t.Errorf("log = %q, want the intended recipients logged", out.String())
+	}
+}
+
+func TestApplyMailgunSandboxWithoutRecipient(t *testing.T) {
+	t.Setenv("MAILGUN_SANDBOX", "true")
+	if _, to, err := applyMailgunSandbox(&Config{}, "subject", []string{"sales@sogos.io"}); err == nil || len(to) != 0 {
+		t.Errorf("recipients = %v, %v; want an error rather than real recipients", to, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SecondaryLeadPayload is the copy of a lead sent to the secondary target
+type SecondaryLeadPayload struct {
+	Name    string `json:"name"`
+	Company string `json:"company"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+	Message string `json:"message"`
+	Service string `json:"service"`
+
+	// EmailHash is the salted hash analytics use to count unique leads
+	EmailHash string `json:"emailHash,omitempty"`
+
+	// IDs of the records created in the primary CRM
+	PrimaryPersonID      string `json:"primaryPersonId,omitempty"`
+	PrimaryOpportunityID string `json:"primaryOpportunityId,omitempty"`
+}
+
+// mirrorLead sends a copy of the lead to SECONDARY_WEBHOOK_URL, if set.
+// It is meant to run in its own goroutine and only logs failures, so the
+// secondary target can never affect the primary flow.
+func mirrorLead(cfg *Config, req ContactRequest, lead *LeadResult) {
+	if cfg.SecondaryWebhookURL == "" {
+		return
+	}
+
+	payload := SecondaryLeadPayload{
+		Name:      req.Name,
+		Company:   req.Company,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		Message:   req.Message,
+		Service:   req.Service,
+		EmailHash: req.EmailHash,
+	}
+	if lead != nil {
+		payload.PrimaryPersonID = lead.PersonID
+		payload.PrimaryOpportunityID = lead.OpportunityID
+	}
+
+	if err := postSecondaryWebhook(cfg.SecondaryWebhookURL, cfg.SecondaryWebhookToken, payload); err != nil {
+		log.Printf("Warning: Failed to mirror lead to secondary target: %v", err)
+	}
+}
+
+func postSecondaryWebhook(webhookURL, token string, payload SecondaryLeadPayload) error {
+	jsonBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(body))
+	}
+
+	return nil
+}
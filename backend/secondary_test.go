@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMirrorLeadPayload(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	payloads := make(chan SecondaryLeadPayload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SecondaryLeadPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		requests <- r
+		payloads <- payload
+	}))
+	defer srv.Close()
+	cfg := &Config{SecondaryWebhookURL: srv.URL, SecondaryWebhookToken: "token"}
+
+	mirrorLead(cfg, ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Service: "Branding"}, &LeadResult{PersonID: "person-1", OpportunityID: "opportunity-1"})
+
+	if auth := (<-requests).Header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Authorization = %q, want Bearer token", auth)
+	}
+	payload := <-payloads
+	if payload.Name != "Jane Doe" || payload.Service != "Branding" || payload.PrimaryPersonID != "person-1" || payload.PrimaryOpportunityID != "opportunity-1" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestPostSecondaryWebhookStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if err := postSecondaryWebhook(srv.URL, "", SecondaryLeadPayload{}); err == nil {
+		t.Error("expected an error for a 502 response")
+	}
+}
+
+func TestSecondaryDoesNotBlockPrimary(t *testing.T) {
+	useMemoryStore(t)
+	_, cfg := useTwentyStub(t)
+
+	release := make(chan struct{})
+	mirrored := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		close(mirrored)
+	}))
+	defer srv.Close()
+	cfg.SecondaryWebhookURL = srv.URL
+
+	done := make(chan *LeadResult)
+	go func() {
+		lead, _ := completeLead(context.Background(), cfg, &Submission{ID: "sub-1"}, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, 1)
+		done <- lead
+	}()
+
+	select {
+	case lead := <-done:
+		if lead == nil || lead.OpportunityID != "opportunity-1" {
+			t.Errorf("lead = %+v, want the primary CRM records", lead)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("completeLead waited for the secondary target")
+	}
+
+	close(release)
+	<-mirrored
+}
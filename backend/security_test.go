@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Setenv("SECURITY_HEADERS", "")
+	cfg := &Config{HSTSMaxAge: "31536000"}
+	srv := newServer(cfg, ":0", newRouter(cfg))
+
+	// Error responses get the headers too
+	for _, path := range []string{"/health", "/missing"} {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		want := map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "strict-origin-when-cross-origin",
+			"Strict-Transport-Security": "",
+		}
+		for header, value := range want {
+			if got := w.Header().Get(header); got != value {
+				t.Errorf("%s: %s = %q, want %q", path, header, got, value)
+			}
+		}
+	}
+}
+
+func TestSecurityHeadersConfigured(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cfg := &Config{ReferrerPolicy: "no-referrer", HSTSMaxAge: "600"}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	securityHeaders(cfg, ok).ServeHTTP(w, r)
+	if got := w.Header().Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("Referrer-Policy = %q, want no-referrer", got)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=600" {
+		t.Errorf("Strict-Transport-Security = %q, want max-age=600", got)
+	}
+
+	t.Setenv("SECURITY_HEADERS", "false")
+	w = httptest.NewRecorder()
+	securityHeaders(cfg, ok).ServeHTTP(w, r)
+	if len(w.Header()) != 0 {
+		t.Errorf("headers = %v with SECURITY_HEADERS=false", w.Header())
+	}
+}
+
+func TestNewServerTLSMinVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+	}{
+		{"", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+	}
+	for _, tt := range tests {
+		cfg := &Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSMinVersion: tt.version}
+		srv := newServer(cfg, ":0", http.NotFoundHandler())
+		if srv.TLSConfig == nil || srv.TLSConfig.MinVersion != tt.want {
+			t.Errorf("TLS_MIN_VERSION=%q: TLSConfig = %+v", tt.version, srv.TLSConfig)
+		}
+	}
+
+	// Behind a proxy there is no TLS config to enforce
+	if srv := newServer(&Config{}, ":0", http.NotFoundHandler()); srv.TLSConfig != nil {
+		t.Errorf("TLSConfig = %+v without a certificate", srv.TLSConfig)
+	}
+}
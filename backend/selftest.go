@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+// checkMailgun sends a test email to recipient to confirm Mailgun is configured
+func checkMailgun(cfg *Config, recipient string) error {
+	apiKey := cfg.MailgunAPIKey
+	domain := cfg.MailgunDomain
+
+	if apiKey == "" || domain == "" {
+		return fmt.Errorf("mailgun configuration missing")
+	}
+
+	mg := mailgun.NewMailgun(domain, apiKey)
+
+	subject, recipients, err := applyMailgunSandbox(cfg, "Sogos backend self-test", []string{recipient})
+	if err != nil {
+		return err
+	}
+
+	m := mg.NewMessage(
+		fmt.Sprintf("Sogos CRM <noreply@%s>", domain),
+		subject,
+		fmt.Sprintf("This is an automated self-test from the sogos.io backend, sent at %s.", systemClock.Now().UTC().Format(time.RFC1123)),
+		recipients...,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	_, _, err = mg.Send(ctx, m)
+	return err
+}
+
+// checkTwenty runs a harmless read query to confirm Twenty is reachable and
+// the API key is accepted
+func checkTwenty(cfg *Config) error {
+	if !cfg.CRMConfigured() {
+		return fmt.Errorf("twenty CRM configuration missing")
+	}
+
+	query := `
+		query SelfTest {
+			companies(first: 1) {
+				edges {
+					node {
+						id
+					}
+				}
+			}
+		}
+	`
+
+	_, err := executeTwentyGraphQL(context.Background(), cfg, query, nil, searchCall())
+	return err
+}
+
+// runStartupSelfTest checks the configured integrations and logs the outcome.
+// It only logs failures so a broken integration never stops the server.
+func runStartupSelfTest(cfg *Config) {
+	recipient := cfg.SelfTestEmail
+	if recipient == "" {
+		recipient = cfg.ContactEmail
+	}
+	if recipient == "" {
+		recipient = "john@sogos.io"
+	}
+
+	if err := checkMailgun(cfg, recipient); err != nil {
+		log.Printf("Self-test FAILED: mailgun: %v", err)
+	} else {
+		log.Printf("Self-test passed: mailgun test email sent to %s", recipient)
+	}
+
+	if envBool("SELFTEST_TWENTY") {
+		if err := checkTwenty(cfg); err != nil {
+			log.Printf("Self-test FAILED: twenty: %v", err)
+		} else {
+			log.Printf("Self-test passed: twenty query succeeded")
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// sheetsScope grants read/write access to spreadsheets
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// SheetAppender appends rows to a spreadsheet
+type SheetAppender interface {
+	AppendRow(ctx context.Context, row []interface{}) error
+}
+
+// sheetAppender is nil when the Google Sheets integration is disabled
+var sheetAppender SheetAppender
+
+// googleSheetsAppender appends rows through the Sheets REST API
+type googleSheetsAppender struct {
+	client        *http.Client
+	spreadsheetID string
+	sheetRange    string
+}
+
+// AppendRow writes the row with valueInputOption=RAW, so submitted values
+// are stored as typed; USER_ENTERED would turn "=HYPERLINK(...)" into a
+// live formula
+func (g *googleSheetsAppender) AppendRow(ctx context.Context, row []interface{}) error {
+	endpoint := fmt.Sprintf("https://sheets.googleapis.com/v4/spreadsheets/%s/values/%s:append?valueInputOption=RAW&insertDataOption=INSERT_ROWS",
+		url.PathEscape(g.spreadsheetID), url.PathEscape(g.sheetRange))
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"values": [][]interface{}{row},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal row: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := g.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// initGoogleSheets enables appending leads to GOOGLE_SHEETS_SPREADSHEET_ID
+// (range GOOGLE_SHEETS_RANGE, default "Sheet1!A:G") using the service
+// account key at GOOGLE_SHEETS_CREDENTIALS_FILE. The integration stays off
+// when no spreadsheet is configured.
+func initGoogleSheets() error {
+	spreadsheetID := os.Getenv("GOOGLE_SHEETS_SPREADSHEET_ID")
+	if spreadsheetID == "" {
+		return nil
+	}
+
+	credentials, err := os.ReadFile(os.Getenv("GOOGLE_SHEETS_CREDENTIALS_FILE"))
+	if err != nil {
+		return fmt.Errorf("failed to read service account credentials: %w", err)
+	}
+
+	jwtConfig, err := google.JWTConfigFromJSON(credentials, sheetsScope)
+	if err != nil {
+		return fmt.Errorf("invalid service account credentials: %w", err)
+	}
+
+	sheetRange := os.Getenv("GOOGLE_SHEETS_RANGE")
+	if sheetRange == "" {
+		sheetRange = "Sheet1!A:G"
+	}
+
+	sheetAppender = &googleSheetsAppender{
+		client:        jwtConfig.Client(context.Background()),
+		spreadsheetID: spreadsheetID,
+		sheetRange:    sheetRange,
+	}
+	log.Printf("Google Sheets: appending leads to spreadsheet %s (%s)", spreadsheetID, sheetRange)
+	return nil
+}
+
+// buildSheetRow returns the row for a lead: timestamp, name, email, company,
+// service, CRM link (empty if the CRM step failed) and email hash (empty
+// without EMAIL_HASH_SALT)
+func buildSheetRow(req ContactRequest, lead *LeadResult, crmURL string, at time.Time) []interface{} {
+	link := ""
+	if lead != nil && lead.OpportunityID != "" {
+		link = fmt.Sprintf("%s/object/opportunity/%s", crmURL, lead.OpportunityID)
+	} else if lead != nil && lead.LeadID != "" {
+		link = fmt.Sprintf("%s/object/lead/%s", crmURL, lead.LeadID)
+	}
+
+	return []interface{}{
+		at.UTC().Format(time.RFC3339),
+		req.Name,
+		req.Email,
+		req.Company,
+		req.Service,
+		link,
+		req.EmailHash,
+	}
+}
+
+// appendLeadToSheet records the lead in the configured spreadsheet. It is
+// meant to run in its own goroutine and only logs failures.
+func appendLeadToSheet(cfg *Config, req ContactRequest, lead *LeadResult) {
+	if sheetAppender == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	row := buildSheetRow(req, lead, cfg.TwentyAPIURL, systemClock.Now())
+	if err := sheetAppender.AppendRow(ctx, row); err != nil {
+		log.Printf("Warning: Failed to append lead to Google Sheet: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSheet records appended rows, failing with err when set
+type stubSheet struct {
+	mu      sync.Mutex
+	rows    [][]interface{}
+	err     error
+	release chan struct{}
+	added   chan struct{}
+}
+
+func (s *stubSheet) AppendRow(ctx context.Context, row []interface{}) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	s.rows = append(s.rows, row)
+	s.mu.Unlock()
+	if s.added != nil {
+		s.added <- struct{}{}
+	}
+	return s.err
+}
+
+// useSheet swaps sheetAppender for the duration of the test
+func useSheet(t *testing.T, s SheetAppender) {
+	t.Helper()
+	previous := sheetAppender
+	sheetAppender = s
+	t.Cleanup(func() { sheetAppender = previous })
+}
+
+func TestBuildSheetRow(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Company: "Acme", Service: "Branding"}
+	at := time.Date(2024, 3, 1, 7, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	tests := []struct {
+		name string
+		lead *LeadResult
+		link string
+	}{
+		{"opportunity", &LeadResult{OpportunityID: "opportunity-1"}, "https://crm.example.com/object/opportunity/opportunity-1"},
+		{"lead object", &LeadResult{LeadID: "lead-1"}, "https://crm.example.com/object/lead/lead-1"},
+		{"CRM failed", nil, ""},
+	}
+	for _, tt := range tests {
+		got := buildSheetRow(req, tt.lead, "https://crm.example.com", at)
+		want := []interface{}{"2024-03-01T12:00:00Z", "Jane Doe", "jane@example.com", "Acme", "Branding", tt.link, ""}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: row = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestAppendLeadToSheetFailsSoft(t *testing.T) {
+	useSystemClock(t)
+	sheet := &stubSheet{err: errors.New("quota exceeded")}
+	useSheet(t, sheet)
+	out := captureStandardLog(t)
+
+	appendLeadToSheet(&Config{TwentyAPIURL: "https://crm.example.com"}, ContactRequest{Name: "Jane Doe"}, nil)
+	if len(sheet.rows) != 1 || sheet.rows[0][0] != testEpoch.Format(time.RFC3339) {
+		t.Errorf("rows = %v, want one row stamped with the clock", sheet.rows)
+	}
+	if !strings.Contains(out.String(), "Failed to append lead to Google Sheet: quota exceeded") {
+		t.Errorf("log = %q, want the failure logged", out.String())
+	}
+}
+
+func TestCompleteLeadDoesNotWaitForSheet(t *testing.T) {
+	useMemoryStore(t)
+	_, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+	sheet := &stubSheet{err: errors.New("sheets down"), release: make(chan struct{}), added: make(chan struct{}, 1)}
+	useSheet(t, sheet)
+
+	submission := &Submission{ID: "sub-1"}
+	done := make(chan error)
+	go func() {
+		_, err := completeLead(context.Background(), cfg, submission, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, 1)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("completeLead: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("completeLead waited for the spreadsheet")
+	}
+	close(sheet.release)
+	<-sheet.added
+
+	// A replay of the submission doesn't append the row twice
+	completeLead(context.Background(), cfg, submission, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, 1)
+	select {
+	case <-sheet.added:
+		t.Error("row appended again on replay")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// sheetsTransport answers Sheets API requests in place of Google
+type sheetsTransport struct {
+	requests chan *http.Request
+	bodies   chan []byte
+	status   int
+}
+
+func (s *sheetsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(r.Body)
+	s.requests <- r
+	s.bodies <- body
+	return &http.Response{StatusCode: s.status, Body: io.NopCloser(strings.NewReader(`{}`)), Header: http.Header{}}, nil
+}
+
+func TestGoogleSheetsAppender(t *testing.T) {
+	transport := &sheetsTransport{requests: make(chan *http.Request, 2), bodies: make(chan []byte, 2), status: http.StatusOK}
+	appender := &googleSheetsAppender{client: &http.Client{Transport: transport}, spreadsheetID: "sheet-1", sheetRange: "Leads!A:G"}
+
+	if err := appender.AppendRow(context.Background(), []interface{}{"=HYPERLINK(\"x\")", "Jane"}); err != nil {
+		t.Fatalf("AppendRow: %v", err)
+	}
+	r := <-transport.requests
+	if r.URL.Path != "/v4/spreadsheets/sheet-1/values/Leads!A:G:append" || r.URL.Query().Get("valueInputOption") != "RAW" {
+		t.Errorf("request = %s, want a RAW append to Leads!A:G", r.URL)
+	}
+	var body struct {
+		Values [][]interface{} `json:"values"`
+	}
+	json.Unmarshal(<-transport.bodies, &body)
+	if len(body.Values) != 1 || body.Values[0][0] != "=HYPERLINK(\"x\")" {
+		t.Errorf("values = %v", body.Values)
+	}
+
+	transport.status = http.StatusForbidden
+	if err := appender.AppendRow(context.Background(), []interface{}{"Jane"}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("err = %v, want the 403 reported", err)
+	}
+}
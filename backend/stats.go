@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// requestStats counts contact requests for the periodic summary log
+type requestStats struct {
+	Total         atomic.Int64
+	Accepted      atomic.Int64
+	Rejected      atomic.Int64 // rejected by validation
+	RateLimited   atomic.Int64 // turned away before reaching the handler
+	CRMFailures   atomic.Int64
+	EmailFailures atomic.Int64
+	BodyBytes     atomic.Int64
+}
+
+// stats collects counts since the last summary
+var stats requestStats
+
+// requestSummary is a snapshot of requestStats for one interval
+type requestSummary struct {
+	Total         int64
+	Accepted      int64
+	Rejected      int64
+	RateLimited   int64
+	CRMFailures   int64
+	EmailFailures int64
+	AvgBodyBytes  int64
+}
+
+// reset returns the counts accumulated so far and zeroes them
+func (s *requestStats) reset() requestSummary {
+	summary := requestSummary{
+		Total:         s.Total.Swap(0),
+		Accepted:      s.Accepted.Swap(0),
+		Rejected:      s.Rejected.Swap(0),
+		RateLimited:   s.RateLimited.Swap(0),
+		CRMFailures:   s.CRMFailures.Swap(0),
+		EmailFailures: s.EmailFailures.Swap(0),
+	}
+	if bodyBytes := s.BodyBytes.Swap(0); summary.Total > 0 {
+		summary.AvgBodyBytes = bodyBytes / summary.Total
+	}
+	return summary
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// summaryLogInterval returns SUMMARY_LOG_INTERVAL; zero (default) disables
+// the periodic summary
+func summaryLogInterval() time.Duration {
+	if v := os.Getenv("SUMMARY_LOG_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// runSummaryLogger logs and resets the request counts every interval until
+// stop is closed
+func runSummaryLogger(clock Clock, interval time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-clock.After(interval):
+			s := stats.reset()
+			log.Printf("Request summary (last %s): total=%d accepted=%d rejected=%d rate_limited=%d crm_failures=%d email_failures=%d avg_body_bytes=%d",
+				interval, s.Total, s.Accepted, s.Rejected, s.RateLimited, s.CRMFailures, s.EmailFailures, s.AvgBodyBytes)
+		case <-stop:
+			return
+		}
+	}
+}
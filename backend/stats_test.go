@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to write from another goroutine
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureStandardLog sends the standard logger to a buffer for the
+// duration of the test
+func captureStandardLog(t *testing.T) *lockedBuffer {
+	t.Helper()
+	buf := &lockedBuffer{}
+	previous := log.Writer()
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return buf
+}
+
+func TestRequestStatsReset(t *testing.T) {
+	var s requestStats
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Total.Add(1)
+			s.Accepted.Add(1)
+			s.BodyBytes.Add(200)
+		}()
+	}
+	wg.Wait()
+	s.Total.Add(4)
+	s.Rejected.Add(4)
+
+	want := requestSummary{Total: 104, Accepted: 100, Rejected: 4, AvgBodyBytes: 192}
+	if got := s.reset(); got != want {
+		t.Errorf("reset() = %+v, want %+v", got, want)
+	}
+	if got := s.reset(); got != (requestSummary{}) {
+		t.Errorf("second reset() = %+v, want zeros", got)
+	}
+}
+
+func TestRunSummaryLogger(t *testing.T) {
+	out := captureStandardLog(t)
+	stats.reset()
+	t.Cleanup(func() { stats.reset() })
+
+	clock := newFakeClock(testEpoch)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runSummaryLogger(clock, time.Minute, stop)
+		close(done)
+	}()
+
+	stats.Total.Add(3)
+	stats.Accepted.Add(1)
+	stats.Rejected.Add(1)
+	stats.RateLimited.Add(1)
+	stats.CRMFailures.Add(1)
+	stats.EmailFailures.Add(1)
+	stats.BodyBytes.Add(300)
+
+	waitForWaiters(t, clock, 1)
+	clock.Advance(time.Minute)
+	waitForWaiters(t, clock, 1)
+
+	want := "Request summary (last 1m0s): total=3 accepted=1 rejected=1 rate_limited=1 crm_failures=1 email_failures=1 avg_body_bytes=100"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("log = %q, want %q", out.String(), want)
+	}
+
+	// Counts start over for the next interval
+	clock.Advance(time.Minute)
+	waitForWaiters(t, clock, 1)
+	if !strings.Contains(out.String(), "total=0 accepted=0") {
+		t.Errorf("second summary did not reset: %q", out.String())
+	}
+
+	close(stop)
+	<-done
+}
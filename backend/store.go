@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store holds state that must be consistent across requests
+type Store interface {
+	// Incr atomically increments the counter at key and returns the new
+	// value. When the key is created and ttl > 0, it expires after ttl.
+	Incr(key string, ttl time.Duration) (int64, error)
+
+	// Delete removes key if present
+	Delete(key string) error
+
+	// SaveSubmission inserts the submission, or updates it if a submission
+	// with the same ID exists
+	SaveSubmission(sub *Submission) error
+
+	// GetSubmission returns the submission with the given ID, or nil
+	GetSubmission(id string) (*Submission, error)
+
+	// ListSubmissions returns submissions created at or after since,
+	// newest first
+	ListSubmissions(since time.Time) ([]Submission, error)
+
+	// SaveCompanyMerge queues an ambiguous company match for review. If a
+	// merge with the same ID is queued, it is updated and its Occurrences
+	// incremented.
+	SaveCompanyMerge(merge *CompanyMerge) error
+
+	// ListCompanyMerges returns the queued merges, most recently seen first
+	ListCompanyMerges() ([]CompanyMerge, error)
+}
+
+// Submission statuses
+const (
+	submissionReceived  = "received"
+	submissionProcessed = "processed"
+	submissionFailed    = "failed"
+)
+
+// Submission is a contact form submission and what became of it
+type Submission struct {
+	ID            string         `json:"id"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+	Status        string         `json:"status"`
+	Request       ContactRequest `json:"request"`
+	OpportunityID string         `json:"opportunityId,omitempty"`
+	LastError     string         `json:"lastError,omitempty"`
+
+	// Progress records the pipeline steps that completed, so a replay
+	// resumes after them instead of repeating them
+	Progress *LeadProgress `json:"progress,omitempty"`
+}
+
+// LeadProgress is the lead pipeline's state for one submission: the CRM
+// records created so far and which steps are done
+type LeadProgress struct {
+	Lead          LeadResult `json:"lead"`
+	CRMDone       bool       `json:"crmDone,omitempty"`
+	Notified      bool       `json:"notified,omitempty"`
+	TeamsNotified bool       `json:"teamsNotified,omitempty"`
+	Mirrored      bool       `json:"mirrored,omitempty"`
+	SheetAppended bool       `json:"sheetAppended,omitempty"`
+}
+
+// clone copies the submission, including its progress, so a stored copy
+// doesn't change with the caller's
+func (sub Submission) clone() Submission {
+	if sub.Progress != nil {
+		progress := *sub.Progress
+		sub.Progress = &progress
+	}
+	return sub
+}
+
+// newSubmissionID returns a random hex ID
+func newSubmissionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// store is the shared Store used by the handlers
+var store Store = newMemoryStore(systemClock)
+
+// initStore selects the Store backend from STORE_BACKEND ("memory", the
+// default, or "postgres" using POSTGRES_DSN)
+func initStore() error {
+	switch backend := strings.ToLower(os.Getenv("STORE_BACKEND")); backend {
+	case "", "memory":
+		return nil
+	case "postgres":
+		pg, err := newPostgresStore(os.Getenv("POSTGRES_DSN"), systemClock)
+		if err != nil {
+			return err
+		}
+		store = pg
+		return nil
+	default:
+		return fmt.Errorf("unknown STORE_BACKEND %q", backend)
+	}
+}
+
+// submissionRetention returns how long the in-memory store keeps
+// submissions (SUBMISSION_RETENTION, default 7 days)
+func submissionRetention() time.Duration {
+	return envDuration("SUBMISSION_RETENTION", 7*24*time.Hour)
+}
+
+type memoryEntry struct {
+	counter   int64
+	expiresAt time.Time
+}
+
+// memoryStore is an in-process Store. Expired entries are dropped lazily
+// when their key is next accessed, and by the janitor.
+type memoryStore struct {
+	mu          sync.Mutex
+	entries     map[string]*memoryEntry
+	submissions map[string]Submission
+	merges      map[string]CompanyMerge
+	clock       Clock
+}
+
+func newMemoryStore(clock Clock) *memoryStore {
+	return &memoryStore{
+		entries:     make(map[string]*memoryEntry),
+		submissions: make(map[string]Submission),
+		merges:      make(map[string]CompanyMerge),
+		clock:       clock,
+	}
+}
+
+// entry returns the live entry for key, dropping it if it has expired.
+// Callers must hold s.mu.
+func (s *memoryStore) entry(key string) *memoryEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !e.expiresAt.IsZero() && !s.clock.Now().Before(e.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (s *memoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key)
+	if e == nil {
+		e = &memoryEntry{}
+		if ttl > 0 {
+			e.expiresAt = s.clock.Now().Add(ttl)
+		}
+		s.entries[key] = e
+	}
+	e.counter++
+	return e.counter, nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStore) SaveSubmission(sub *Submission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if existing, ok := s.submissions[sub.ID]; ok {
+		sub.CreatedAt = existing.CreatedAt
+	} else if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+	sub.UpdatedAt = now
+	s.submissions[sub.ID] = sub.clone()
+	return nil
+}
+
+func (s *memoryStore) GetSubmission(id string) (*Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.submissions[id]
+	if !ok {
+		return nil, nil
+	}
+	sub = sub.clone()
+	return &sub, nil
+}
+
+func (s *memoryStore) ListSubmissions(since time.Time) ([]Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var subs []Submission
+	for _, sub := range s.submissions {
+		if !sub.CreatedAt.Before(since) {
+			subs = append(subs, sub.clone())
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.After(subs[j].CreatedAt)
+	})
+	return subs, nil
+}
+
+func (s *memoryStore) SaveCompanyMerge(merge *CompanyMerge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	merge.CreatedAt = now
+	merge.Occurrences = 1
+	if existing, ok := s.merges[merge.ID]; ok {
+		merge.CreatedAt = existing.CreatedAt
+		merge.Occurrences = existing.Occurrences + 1
+	}
+	merge.UpdatedAt = now
+	s.merges[merge.ID] = *merge
+	return nil
+}
+
+func (s *memoryStore) ListCompanyMerges() ([]CompanyMerge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var merges []CompanyMerge
+	for _, merge := range s.merges {
+		merges = append(merges, merge)
+	}
+	sort.Slice(merges, func(i, j int) bool {
+		return merges[i].UpdatedAt.After(merges[j].UpdatedAt)
+	})
+	return merges, nil
+}
+
+// Len returns the number of entries, submissions and company merges
+// currently held, including expired ones that have not been swept yet
+func (s *memoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries) + len(s.submissions) + len(s.merges)
+}
+
+// CountPrefix returns the number of entries whose key starts with prefix
+func (s *memoryStore) CountPrefix(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// Sweep removes all expired entries, and submissions and company merges
+// not updated within retention, and returns how many were removed
+func (s *memoryStore) Sweep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	removed := 0
+	for key, e := range s.entries {
+		if !e.expiresAt.IsZero() && !now.Before(e.expiresAt) {
+			delete(s.entries, key)
+			removed++
+		}
+	}
+
+	cutoff := now.Add(-submissionRetention())
+	for id, sub := range s.submissions {
+		if sub.CreatedAt.Before(cutoff) {
+			delete(s.submissions, id)
+			removed++
+		}
+	}
+	for id, merge := range s.merges {
+		if merge.UpdatedAt.Before(cutoff) {
+			delete(s.merges, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// sweeper is a Store that can purge its expired state
+type sweeper interface {
+	Sweep() int
+	Len() int
+}
+
+// storeSweepInterval returns how often the janitor sweeps the store
+// (STORE_SWEEP_INTERVAL, default 5m)
+func storeSweepInterval() time.Duration {
+	return envDuration("STORE_SWEEP_INTERVAL", 5*time.Minute)
+}
+
+// runStoreJanitor periodically sweeps expired state from s so keys that
+// are never accessed again don't accumulate, calling observe after each
+// sweep to update the size gauges. It runs until stop is closed.
+func runStoreJanitor(s sweeper, clock Clock, interval time.Duration, stop <-chan struct{}, observe func(sweeper)) {
+	for {
+		select {
+		case <-clock.After(interval):
+			if removed := s.Sweep(); removed > 0 {
+				log.Printf("Store janitor removed %d expired entries (%d remaining)", removed, s.Len())
+			}
+			observe(s)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrations are applied in order; the index+1 is the schema version
+var postgresMigrations = []string{
+	`CREATE TABLE store_entries (
+		key        TEXT PRIMARY KEY,
+		counter    BIGINT NOT NULL,
+		expires_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE submissions (
+		id             TEXT PRIMARY KEY,
+		created_at     TIMESTAMPTZ NOT NULL,
+		updated_at     TIMESTAMPTZ NOT NULL,
+		status         TEXT NOT NULL,
+		email          TEXT NOT NULL,
+		service        TEXT NOT NULL DEFAULT '',
+		request        JSONB NOT NULL,
+		opportunity_id TEXT NOT NULL DEFAULT '',
+		last_error     TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX submissions_created_at_idx ON submissions (created_at)`,
+	`CREATE TABLE company_merges (
+		id          TEXT PRIMARY KEY,
+		created_at  TIMESTAMPTZ NOT NULL,
+		updated_at  TIMESTAMPTZ NOT NULL,
+		occurrences INTEGER NOT NULL DEFAULT 1,
+		merge       JSONB NOT NULL
+	)`,
+	`ALTER TABLE submissions ADD COLUMN progress JSONB`,
+}
+
+// postgresStore is a Store backed by PostgreSQL, shared by all instances
+type postgresStore struct {
+	db    *sql.DB
+	clock Clock
+}
+
+func newPostgresStore(dsn string, clock Clock) (*postgresStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("POSTGRES_DSN is required for the postgres store")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	s := &postgresStore{db: db, clock: clock}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrationLockID is the pg_advisory_lock key held while migrating, so
+// instances booting together apply each migration once
+const migrationLockID = 0x736f676f73
+
+// migrate applies any postgresMigrations newer than the recorded version
+func (s *postgresStore) migrate() error {
+	ctx := context.Background()
+
+	// Session-level advisory locks belong to a connection, so keep one
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(postgresMigrations); i++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(postgresMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+		log.Printf("Applied database migration %d", i+1)
+	}
+
+	return nil
+}
+
+func (s *postgresStore) Incr(key string, ttl time.Duration) (int64, error) {
+	now := s.clock.Now()
+	var expiresAt interface{}
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	// An expired row restarts at 1 with a fresh expiry
+	var counter int64
+	err := s.db.QueryRow(`
+		INSERT INTO store_entries (key, counter, expires_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			counter = CASE WHEN store_entries.expires_at <= $3 THEN 1 ELSE store_entries.counter + 1 END,
+			expires_at = CASE WHEN store_entries.expires_at <= $3 THEN EXCLUDED.expires_at ELSE store_entries.expires_at END
+		RETURNING counter`, key, expiresAt, now).Scan(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment %s: %w", key, err)
+	}
+	return counter, nil
+}
+
+func (s *postgresStore) Delete(key string) error {
+	if _, err := s.db.Exec(`DELETE FROM store_entries WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *postgresStore) SaveSubmission(sub *Submission) error {
+	request, err := json.Marshal(sub.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal submission: %w", err)
+	}
+	var progress []byte
+	if sub.Progress != nil {
+		if progress, err = json.Marshal(sub.Progress); err != nil {
+			return fmt.Errorf("failed to marshal submission progress: %w", err)
+		}
+	}
+
+	now := s.clock.Now()
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+	sub.UpdatedAt = now
+
+	_, err = s.db.Exec(`
+		INSERT INTO submissions (id, created_at, updated_at, status, email, service, request, opportunity_id, last_error, progress)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			updated_at = EXCLUDED.updated_at,
+			status = EXCLUDED.status,
+			request = EXCLUDED.request,
+			opportunity_id = EXCLUDED.opportunity_id,
+			last_error = EXCLUDED.last_error,
+			progress = EXCLUDED.progress`,
+		sub.ID, sub.CreatedAt, sub.UpdatedAt, sub.Status, sub.Request.Email, sub.Request.Service, request, sub.OpportunityID, sub.LastError, progress)
+	if err != nil {
+		return fmt.Errorf("failed to save submission %s: %w", sub.ID, err)
+	}
+	return nil
+}
+
+// submissionColumns is the column list scanned by scanSubmission
+const submissionColumns = `id, created_at, updated_at, status, request, opportunity_id, last_error, progress`
+
+func scanSubmission(row interface{ Scan(...interface{}) error }) (*Submission, error) {
+	var sub Submission
+	var request, progress []byte
+	if err := row.Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt, &sub.Status, &request, &sub.OpportunityID, &sub.LastError, &progress); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(request, &sub.Request); err != nil {
+		return nil, fmt.Errorf("failed to parse submission %s: %w", sub.ID, err)
+	}
+	if progress != nil {
+		sub.Progress = &LeadProgress{}
+		if err := json.Unmarshal(progress, sub.Progress); err != nil {
+			return nil, fmt.Errorf("failed to parse submission %s progress: %w", sub.ID, err)
+		}
+	}
+	return &sub, nil
+}
+
+func (s *postgresStore) GetSubmission(id string) (*Submission, error) {
+	sub, err := scanSubmission(s.db.QueryRow(`SELECT `+submissionColumns+` FROM submissions WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submission %s: %w", id, err)
+	}
+	return sub, nil
+}
+
+func (s *postgresStore) ListSubmissions(since time.Time) ([]Submission, error) {
+	rows, err := s.db.Query(`SELECT `+submissionColumns+` FROM submissions WHERE created_at >= $1 ORDER BY created_at DESC`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submissions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []Submission
+	for rows.Next() {
+		sub, err := scanSubmission(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+func (s *postgresStore) SaveCompanyMerge(merge *CompanyMerge) error {
+	now := s.clock.Now()
+	merge.UpdatedAt = now
+
+	data, err := json.Marshal(merge)
+	if err != nil {
+		return fmt.Errorf("failed to marshal company merge: %w", err)
+	}
+
+	err = s.db.QueryRow(`
+		INSERT INTO company_merges (id, created_at, updated_at, occurrences, merge)
+		VALUES ($1, $2, $2, 1, $3)
+		ON CONFLICT (id) DO UPDATE SET
+			updated_at = EXCLUDED.updated_at,
+			occurrences = company_merges.occurrences + 1,
+			merge = EXCLUDED.merge
+		RETURNING created_at, occurrences`,
+		merge.ID, now, data).Scan(&merge.CreatedAt, &merge.Occurrences)
+	if err != nil {
+		return fmt.Errorf("failed to save company merge %s: %w", merge.ID, err)
+	}
+	return nil
+}
+
+func (s *postgresStore) ListCompanyMerges() ([]CompanyMerge, error) {
+	rows, err := s.db.Query(`SELECT created_at, occurrences, merge FROM company_merges ORDER BY updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list company merges: %w", err)
+	}
+	defer rows.Close()
+
+	var merges []CompanyMerge
+	for rows.Next() {
+		var merge CompanyMerge
+		var createdAt time.Time
+		var occurrences int
+		var data []byte
+		if err := rows.Scan(&createdAt, &occurrences, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &merge); err != nil {
+			return nil, fmt.Errorf("failed to parse company merge: %w", err)
+		}
+		merge.CreatedAt = createdAt
+		merge.Occurrences = occurrences
+		merges = append(merges, merge)
+	}
+	return merges, rows.Err()
+}
+
+// Len returns the number of live store entries
+func (s *postgresStore) Len() int {
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM store_entries`).Scan(&n); err != nil {
+		log.Printf("Warning: Failed to count store entries: %v", err)
+	}
+	return n
+}
+
+// Sweep deletes expired store entries. Submissions are kept: the database
+// is the durable record.
+func (s *postgresStore) Sweep() int {
+	res, err := s.db.Exec(`DELETE FROM store_entries WHERE expires_at <= $1`, s.clock.Now())
+	if err != nil {
+		log.Printf("Warning: Failed to sweep store entries: %v", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
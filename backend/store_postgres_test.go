@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// usePostgresStore creates a postgresStore in a throwaway schema of the
+// database at TEST_POSTGRES_DSN, skipping the test when it is unset
+func usePostgresStore(t *testing.T) (*postgresStore, *fakeClock) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "store_test_" + newSubmissionID()
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	// Unknown connection parameters are sent to the server as settings
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn = fmt.Sprintf("%s search_path=%s", dsn, schema)
+	}
+
+	clock := newFakeClock(testEpoch)
+	s, err := newPostgresStore(dsn, clock)
+	if err != nil {
+		t.Fatalf("newPostgresStore: %v", err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s, clock
+}
+
+func TestPostgresStoreContract(t *testing.T) {
+	s, clock := usePostgresStore(t)
+	testStoreContract(t, s, clock)
+}
+
+func TestPostgresStoreMigrationsIdempotent(t *testing.T) {
+	s, _ := usePostgresStore(t)
+
+	if err := s.migrate(); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(postgresMigrations) {
+		t.Errorf("schema version = %d, want %d", version, len(postgresMigrations))
+	}
+}
+
+func TestPostgresStoreSweep(t *testing.T) {
+	s, clock := usePostgresStore(t)
+
+	s.Incr("short", 1)
+	s.Incr("forever", 0)
+	clock.Advance(1)
+	if removed := s.Sweep(); removed != 1 || s.Len() != 1 {
+		t.Errorf("Sweep removed %d, left %d; want 1 and 1", removed, s.Len())
+	}
+}
+
+func TestNewPostgresStoreRequiresDSN(t *testing.T) {
+	if _, err := newPostgresStore("", newFakeClock(testEpoch)); err == nil {
+		t.Error("expected an error without a DSN")
+	}
+}
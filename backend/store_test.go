@@ -0,0 +1,207 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testStoreContract checks the Store behavior every backend must share.
+// clock must be the clock s was created with.
+func testStoreContract(t *testing.T, s Store, clock *fakeClock) {
+	t.Run("Incr", func(t *testing.T) {
+		for want := int64(1); want <= 2; want++ {
+			if n, err := s.Incr("contract:incr", time.Minute); err != nil || n != want {
+				t.Fatalf("Incr = %d, %v; want %d", n, err, want)
+			}
+		}
+		clock.Advance(time.Minute)
+		if n, _ := s.Incr("contract:incr", time.Minute); n != 1 {
+			t.Errorf("Incr after expiry = %d, want 1", n)
+		}
+
+		if err := s.Delete("contract:incr"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if n, _ := s.Incr("contract:incr", time.Minute); n != 1 {
+			t.Errorf("Incr after Delete = %d, want 1", n)
+		}
+	})
+
+	t.Run("submissions", func(t *testing.T) {
+		if sub, err := s.GetSubmission("contract-missing"); err != nil || sub != nil {
+			t.Errorf("GetSubmission of a missing ID = %v, %v; want nil, nil", sub, err)
+		}
+
+		since := clock.Now()
+		first := &Submission{ID: "contract-1", Status: submissionReceived, Request: ContactRequest{Name: "Jane", Email: "jane@example.com", Service: "Branding"}}
+		if err := s.SaveSubmission(first); err != nil {
+			t.Fatalf("SaveSubmission: %v", err)
+		}
+		clock.Advance(time.Minute)
+		second := &Submission{ID: "contract-2", Status: submissionReceived, Request: ContactRequest{Name: "John", Email: "john@example.com"}}
+		if err := s.SaveSubmission(second); err != nil {
+			t.Fatalf("SaveSubmission: %v", err)
+		}
+
+		// Updates keep the creation time
+		clock.Advance(time.Minute)
+		first.Status = submissionProcessed
+		first.OpportunityID = "opportunity-1"
+		first.Progress = &LeadProgress{Lead: LeadResult{PersonID: "person-1"}, CRMDone: true}
+		if err := s.SaveSubmission(first); err != nil {
+			t.Fatalf("SaveSubmission update: %v", err)
+		}
+
+		got, err := s.GetSubmission("contract-1")
+		if err != nil || got == nil {
+			t.Fatalf("GetSubmission = %v, %v", got, err)
+		}
+		if got.Status != submissionProcessed || got.OpportunityID != "opportunity-1" || got.Request.Service != "Branding" {
+			t.Errorf("submission = %+v", got)
+		}
+		if !got.CreatedAt.Equal(since) || !got.UpdatedAt.Equal(clock.Now()) {
+			t.Errorf("created %v, updated %v; want %v and %v", got.CreatedAt, got.UpdatedAt, since, clock.Now())
+		}
+		if got.Progress == nil || got.Progress.Lead.PersonID != "person-1" || !got.Progress.CRMDone {
+			t.Errorf("progress = %+v", got.Progress)
+		}
+
+		subs, err := s.ListSubmissions(since)
+		if err != nil {
+			t.Fatalf("ListSubmissions: %v", err)
+		}
+		if len(subs) != 2 || subs[0].ID != "contract-2" || subs[1].ID != "contract-1" {
+			t.Errorf("ListSubmissions = %v, want newest first", subs)
+		}
+		if subs, _ := s.ListSubmissions(since.Add(time.Second)); len(subs) != 1 {
+			t.Errorf("ListSubmissions since later = %d submissions, want 1", len(subs))
+		}
+	})
+
+	t.Run("company merges", func(t *testing.T) {
+		merge := &CompanyMerge{ID: "contract-merge", SubmittedName: "Acme", Candidates: []CompanyMatch{{ID: "c1", Name: "Acme"}, {ID: "c2", Name: "ACME Inc"}}, ChosenID: "c1"}
+		if err := s.SaveCompanyMerge(merge); err != nil {
+			t.Fatalf("SaveCompanyMerge: %v", err)
+		}
+		clock.Advance(time.Minute)
+		if err := s.SaveCompanyMerge(&CompanyMerge{ID: "contract-merge", SubmittedName: "Acme", ChosenID: "c2"}); err != nil {
+			t.Fatalf("SaveCompanyMerge repeat: %v", err)
+		}
+
+		merges, err := s.ListCompanyMerges()
+		if err != nil {
+			t.Fatalf("ListCompanyMerges: %v", err)
+		}
+		if len(merges) != 1 || merges[0].Occurrences != 2 || merges[0].ChosenID != "c2" {
+			t.Errorf("merges = %+v, want one merge seen twice", merges)
+		}
+	})
+}
+
+func TestMemoryStoreContract(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	testStoreContract(t, newMemoryStore(clock), clock)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	t.Setenv("SUBMISSION_RETENTION", "")
+	clock := newFakeClock(testEpoch)
+	s := newMemoryStore(clock)
+
+	s.Incr("short", time.Minute)
+	s.Incr("long", time.Hour)
+	s.Incr("forever", 0)
+
+	clock.Advance(time.Minute)
+	if removed := s.Sweep(); removed != 1 || s.Len() != 2 {
+		t.Errorf("Sweep removed %d, left %d; want 1 and 2", removed, s.Len())
+	}
+	clock.Advance(time.Hour)
+	if removed := s.Sweep(); removed != 1 || s.Len() != 1 {
+		t.Errorf("Sweep removed %d, left %d; want 1 and 1", removed, s.Len())
+	}
+}
+
+func TestRunStoreJanitor(t *testing.T) {
+	t.Setenv("SUBMISSION_RETENTION", "3m")
+	clock := newFakeClock(testEpoch)
+	s := newMemoryStore(clock)
+	s.Incr("a", time.Minute)
+	s.Incr(rateLimitKeyPrefix+"192.0.2.1", 3*time.Minute)
+	s.SaveCompanyMerge(&CompanyMerge{ID: "merge-1", SubmittedName: "Acme"})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runStoreJanitor(s, clock, 2*time.Minute, stop, observeStoreSize)
+		close(done)
+	}()
+
+	// Expired entries stay until the next sweep
+	waitForWaiters(t, clock, 1)
+	clock.Advance(time.Minute)
+	if s.Len() != 3 {
+		t.Fatalf("Len() = %d before the first sweep, want 3", s.Len())
+	}
+
+	clock.Advance(time.Minute)
+	waitForWaiters(t, clock, 1)
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d after the first sweep, want 2", s.Len())
+	}
+	if got := testutil.ToFloat64(metricStoreEntries); got != 2 {
+		t.Errorf("store gauge = %v after the first sweep, want 2", got)
+	}
+	if got := testutil.ToFloat64(metricRateLimitKeys); got != 1 {
+		t.Errorf("rate limit gauge = %v after the first sweep, want 1", got)
+	}
+
+	// The merge is past retention by the second sweep
+	clock.Advance(2 * time.Minute)
+	waitForWaiters(t, clock, 1)
+	if s.Len() != 0 {
+		t.Errorf("Len() = %d after the second sweep, want 0", s.Len())
+	}
+	if merges, _ := s.ListCompanyMerges(); len(merges) != 0 {
+		t.Errorf("merges = %+v after the second sweep, want none", merges)
+	}
+	if got := testutil.ToFloat64(metricStoreEntries); got != 0 {
+		t.Errorf("store gauge = %v after the second sweep, want 0", got)
+	}
+	if got := testutil.ToFloat64(metricRateLimitKeys); got != 0 {
+		t.Errorf("rate limit gauge = %v after the second sweep, want 0", got)
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("janitor did not stop")
+	}
+}
+
+func TestRunStoreJanitorIdempotencyGauge(t *testing.T) {
+	clock := newFakeClock(testEpoch)
+	cache := &idempotencyCache{clock: clock, entries: make(map[string]*idempotencyEntry)}
+	cache.Begin("short", "fp", time.Minute, 10)
+	cache.Begin("long", "fp", time.Hour, 10)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runStoreJanitor(cache, clock, 2*time.Minute, stop, observeIdempotencySize)
+		close(done)
+	}()
+
+	waitForWaiters(t, clock, 1)
+	clock.Advance(2 * time.Minute)
+	waitForWaiters(t, clock, 1)
+	if got := testutil.ToFloat64(metricIdempotencyKeys); got != 1 {
+		t.Errorf("idempotency gauge = %v after the sweep, want 1", got)
+	}
+
+	close(stop)
+	<-done
+}
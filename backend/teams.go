@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// notifyChannels returns the channels lead notifications go to
+// (NOTIFY_CHANNELS, comma-separated "email" and/or "teams"). When unset,
+// email is used, plus Teams if TEAMS_WEBHOOK_URL is configured.
+func notifyChannels(cfg *Config) []string {
+	if len(cfg.NotifyChannels) > 0 {
+		return cfg.NotifyChannels
+	}
+
+	channels := []string{"email"}
+	if cfg.TeamsWebhookURL != "" {
+		channels = append(channels, "teams")
+	}
+	return channels
+}
+
+// notifyChannelEnabled reports whether channel is one of notifyChannels
+func notifyChannelEnabled(cfg *Config, channel string) bool {
+	return slices.Contains(notifyChannels(cfg), channel)
+}
+
+// teamsMarkdownEscaper escapes the markdown Teams renders in card text, so
+// submitted content can't inject links or formatting
+var teamsMarkdownEscaper = strings.NewReplacer(
+	`\`, `\\`, `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`(`, `\(`, `)`, `\)`, `#`, `\#`, `>`, `\>`, "`", "\\`", `~`, `\~`,
+)
+
+// escapeTeamsText escapes user-supplied text for a card TextBlock or fact
+func escapeTeamsText(s string) string {
+	return teamsMarkdownEscaper.Replace(s)
+}
+
+// buildTeamsCard renders the lead as an Adaptive Card message for a Teams
+// incoming webhook
+func buildTeamsCard(cfg *Config, req ContactRequest, lead *LeadResult) map[string]interface{} {
+	facts := []map[string]string{}
+	addFact := func(title, value string) {
+		if value != "" {
+			facts = append(facts, map[string]string{"title": title, "value": escapeTeamsText(value)})
+		}
+	}
+	addFact("Email", req.Email)
+	addFact("Phone", req.Phone)
+	addFact("Company", req.Company)
+	addFact("Service", req.Service)
+	if req.Location != nil {
+		addFact("Location", req.Location.String())
+	}
+	addFact("Heard About Us", req.ReferralSource)
+
+	body := []map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"size":   "Medium",
+			"weight": "Bolder",
+			"text":   "🎯 New Lead: " + escapeTeamsText(req.Name),
+			"wrap":   true,
+		},
+		{
+			"type":  "FactSet",
+			"facts": facts,
+		},
+	}
+	if message := messageOrPlaceholder(cfg, req.Message); message != "" {
+		body = append(body, map[string]interface{}{
+			"type": "TextBlock",
+			"text": escapeTeamsText(message),
+			"wrap": true,
+		})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+
+	link := ""
+	if lead != nil && lead.OpportunityID != "" {
+		link = fmt.Sprintf("%s/object/opportunity/%s", cfg.TwentyAPIURL, lead.OpportunityID)
+	} else if lead != nil && lead.LeadID != "" {
+		link = fmt.Sprintf("%s/object/lead/%s", cfg.TwentyAPIURL, lead.LeadID)
+	}
+	if link != "" {
+		card["actions"] = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "View in CRM", "url": link},
+		}
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	}
+}
+
+// notifyTeams posts the lead to TEAMS_WEBHOOK_URL. Failures are only logged
+// so Teams can never hold up or fail a lead.
+func notifyTeams(cfg *Config, req ContactRequest, lead *LeadResult) {
+	if cfg.TeamsWebhookURL == "" {
+		log.Printf("Warning: Teams notifications enabled but TEAMS_WEBHOOK_URL is not set")
+		return
+	}
+
+	card := buildTeamsCard(cfg, req, lead)
+	if err := postTeamsWebhook(cfg.TeamsWebhookURL, card); err != nil {
+		log.Printf("Warning: Failed to post Teams notification: %v", err)
+	}
+}
+
+func postTeamsWebhook(webhookURL string, payload map[string]interface{}) error {
+	jsonBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal card: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", httpResp.StatusCode, string(body))
+	}
+
+	return nil
+}
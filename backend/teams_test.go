@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// cardOf returns the Adaptive Card inside a Teams message payload
+func cardOf(t *testing.T, payload map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	// Round-trip through JSON so the card reads like what Teams receives
+	b, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal card: %v", err)
+	}
+	var message struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string                 `json:"contentType"`
+			Content     map[string]interface{} `json:"content"`
+		} `json:"attachments"`
+	}
+	json.Unmarshal(b, &message)
+	if message.Type != "message" || len(message.Attachments) != 1 || message.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("payload = %s, want one adaptive card attachment", b)
+	}
+	return message.Attachments[0].Content
+}
+
+func TestBuildTeamsCard(t *testing.T) {
+	req := ContactRequest{
+		Name:    "Jane *Doe*",
+		Email:   "jane@example.com",
+		Company: "Acme [evil](https://evil.example)",
+		Service: "Branding",
+		Message: "# Hello\n> quoted",
+	}
+	card := cardOf(t, buildTeamsCard(&Config{TwentyAPIURL: "https://crm.example.com"}, req, &LeadResult{OpportunityID: "opportunity-1"}))
+
+	if card["type"] != "AdaptiveCard" || card["version"] != "1.4" {
+		t.Errorf("card = %v", card)
+	}
+	body := card["body"].([]interface{})
+	if len(body) != 3 {
+		t.Fatalf("body has %d blocks, want title, facts and message", len(body))
+	}
+	if title := body[0].(map[string]interface{})["text"]; title != `🎯 New Lead: Jane \*Doe\*` {
+		t.Errorf("title = %q", title)
+	}
+
+	facts := map[string]string{}
+	for _, f := range body[1].(map[string]interface{})["facts"].([]interface{}) {
+		fact := f.(map[string]interface{})
+		facts[fact["title"].(string)] = fact["value"].(string)
+	}
+	want := map[string]string{
+		"Email":   "jane@example.com",
+		"Company": `Acme \[evil\]\(https://evil.example\)`,
+		"Service": "Branding",
+	}
+	if len(facts) != len(want) {
+		t.Errorf("facts = %v, want only the non-empty fields", facts)
+	}
+	for title, value := range want {
+		if facts[title] != value {
+			t.Errorf("fact %s = %q, want %q", title, facts[title], value)
+		}
+	}
+	if message := body[2].(map[string]interface{})["text"]; message != "\\# Hello\n\\> quoted" {
+		t.Errorf("message = %q", message)
+	}
+
+	actions := card["actions"].([]interface{})
+	if len(actions) != 1 || actions[0].(map[string]interface{})["url"] != "https://crm.example.com/object/opportunity/opportunity-1" {
+		t.Errorf("actions = %v, want a CRM link", actions)
+	}
+}
+
+func TestBuildTeamsCardCRMLinks(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}
+
+	card := cardOf(t, buildTeamsCard(&Config{TwentyAPIURL: "https://crm.example.com"}, req, &LeadResult{LeadID: "lead-1"}))
+	if actions := card["actions"].([]interface{}); actions[0].(map[string]interface{})["url"] != "https://crm.example.com/object/lead/lead-1" {
+		t.Errorf("actions = %v, want a lead link", actions)
+	}
+	if card := cardOf(t, buildTeamsCard(&Config{TwentyAPIURL: "https://crm.example.com"}, req, nil)); card["actions"] != nil {
+		t.Errorf("actions = %v without CRM records", card["actions"])
+	}
+}
+
+func TestNotifyChannels(t *testing.T) {
+	tests := []struct {
+		channels []string
+		webhook  string
+		want     string
+	}{
+		{nil, "", "email"},
+		{nil, "https://teams.example.com/hook", "email,teams"},
+		{[]string{"teams"}, "https://teams.example.com/hook", "teams"},
+		{[]string{"email", "teams"}, "", "email,teams"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{NotifyChannels: tt.channels, TeamsWebhookURL: tt.webhook}
+		if got := strings.Join(notifyChannels(cfg), ","); got != tt.want {
+			t.Errorf("NOTIFY_CHANNELS=%q, TEAMS_WEBHOOK_URL=%q: channels = %s, want %s", tt.channels, tt.webhook, got, tt.want)
+		}
+	}
+}
+
+func TestNotifyTeamsPostsCard(t *testing.T) {
+	cards := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		cards <- payload
+	}))
+	defer srv.Close()
+
+	notifyTeams(&Config{TeamsWebhookURL: srv.URL}, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, nil)
+	card := cardOf(t, <-cards)
+	if title := card["body"].([]interface{})[0].(map[string]interface{})["text"]; title != "🎯 New Lead: Jane Doe" {
+		t.Errorf("title = %q", title)
+	}
+}
+
+func TestTeamsFailureIsSoft(t *testing.T) {
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		http.Error(w, "throttled", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	out := captureStandardLog(t)
+
+	progress := &LeadProgress{}
+	_, crmErr, emailErr := processLead(context.Background(), &Config{CRMMissingConfig: "degraded", NotifyChannels: []string{"teams"}, TeamsWebhookURL: srv.URL}, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, progress, 1)
+	if emailErr != nil {
+		t.Errorf("emailErr = %v, want Teams failures ignored", emailErr)
+	}
+	if crmErr == nil {
+		t.Error("crmErr = nil without a CRM")
+	}
+	if posts.Load() != 1 || !progress.TeamsNotified {
+		t.Errorf("posted %d times, notified %v; want one attempt", posts.Load(), progress.TeamsNotified)
+	}
+	if !strings.Contains(out.String(), "Failed to post Teams notification: unexpected status 429") {
+		t.Errorf("log = %q, want the Teams failure logged", out.String())
+	}
+
+	// A replay doesn't post again
+	processLead(context.Background(), &Config{CRMMissingConfig: "degraded", NotifyChannels: []string{"teams"}, TeamsWebhookURL: srv.URL}, ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}, progress, 1)
+	if posts.Load() != 1 {
+		t.Errorf("posted %d times after a replay, want 1", posts.Load())
+	}
+}
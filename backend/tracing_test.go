@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in
+// memory, restoring the previous provider when the test ends
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// findSpan returns the first recorded span called name
+func findSpan(spans tracetest.SpanStubs, name string) (tracetest.SpanStub, bool) {
+	for _, span := range spans {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+// spanAttribute returns the value of the attribute key on span
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestExecuteTwentyGraphQLSpan(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	exporter := recordSpans(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"companies":{"edges":[]}}}`))
+	}))
+	defer srv.Close()
+
+	ctx, parent := startSpan(context.Background(), "parent")
+	query := `query FindCompany($filter: CompanyFilterInput) { companies(filter: $filter) { edges { node { id } } } }`
+	if _, err := executeTwentyGraphQL(ctx, &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key"}, query, nil); err != nil {
+		t.Fatalf("executeTwentyGraphQL: %v", err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	span, ok := findSpan(spans, "twenty.graphql")
+	if !ok {
+		t.Fatalf("no twenty.graphql span in %d spans", len(spans))
+	}
+	if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("twenty.graphql span is not a child of the caller's span")
+	}
+	if v, _ := spanAttribute(span, "graphql.operation.name"); v.AsString() != "FindCompany" {
+		t.Errorf("graphql.operation.name = %q, want FindCompany", v.AsString())
+	}
+	if v, _ := spanAttribute(span, "attempts"); v.AsInt64() != 1 {
+		t.Errorf("attempts = %d, want 1", v.AsInt64())
+	}
+}
+
+func TestExecuteTwentyGraphQLSpanError(t *testing.T) {
+	t.Setenv("ALLOW_INSECURE_CRM", "true")
+	exporter := recordSpans(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":[{"message":"boom"}]}`))
+	}))
+	defer srv.Close()
+
+	if _, err := executeTwentyGraphQL(context.Background(), &Config{TwentyAPIURL: srv.URL, TwentyAPIKey: "key", TwentyRequestAttempts: 1}, `mutation CreateCompany { createCompany { id } }`, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	span, ok := findSpan(exporter.GetSpans(), "twenty.graphql")
+	if !ok {
+		t.Fatal("no twenty.graphql span")
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("status = %v, want Error", span.Status.Code)
+	}
+}
+
+func TestGraphQLOperationName(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"\n\t\tmutation CreateOpportunity($input: OpportunityCreateInput!) {", "CreateOpportunity"},
+		{"query SelfTest { companies { edges { node { id } } } }", "SelfTest"},
+		{"{ companies { edges { node { id } } } }", "anonymous"},
+	}
+	for _, tt := range tests {
+		if got := graphQLOperationName(tt.query); got != tt.want {
+			t.Errorf("graphQLOperationName(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
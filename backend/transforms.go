@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldTransforms are the operations available in FIELD_TRANSFORMS
+var fieldTransforms = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"collapse-spaces": func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	},
+}
+
+// transformableFields returns pointers to the ContactRequest fields that
+// FIELD_TRANSFORMS may target, keyed by their JSON name
+func transformableFields(req *ContactRequest) map[string]*string {
+	return map[string]*string{
+		"name":           &req.Name,
+		"company":        &req.Company,
+		"email":          &req.Email,
+		"phone":          &req.Phone,
+		"message":        &req.Message,
+		"service":        &req.Service,
+		"title":          &req.Title,
+		"website":        &req.Website,
+		"referralSource": &req.ReferralSource,
+		"city":           &req.City,
+		"state":          &req.State,
+		"country":        &req.Country,
+	}
+}
+
+// parseFieldTransforms parses a spec like "company:trim,upper;email:lower"
+// into the ordered operations for each field
+func parseFieldTransforms(spec string) (map[string][]string, error) {
+	known := transformableFields(&ContactRequest{})
+	transforms := make(map[string][]string)
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		field, ops, ok := strings.Cut(entry, ":")
+		field = strings.TrimSpace(field)
+		if !ok {
+			return nil, fmt.Errorf("missing ':' in %q", entry)
+		}
+		if _, ok := known[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+
+		for _, op := range splitList(ops) {
+			op = strings.ToLower(op)
+			if _, ok := fieldTransforms[op]; !ok {
+				return nil, fmt.Errorf("unknown transform %q for field %q", op, field)
+			}
+			transforms[field] = append(transforms[field], op)
+		}
+	}
+
+	return transforms, nil
+}
+
+// applyFieldTransforms runs the FIELD_TRANSFORMS pipeline over req
+func applyFieldTransforms(cfg *Config, req *ContactRequest) {
+	fields := transformableFields(req)
+	for field, ops := range cfg.FieldTransforms {
+		value := fields[field]
+		for _, op := range ops {
+			*value = fieldTransforms[op](*value)
+		}
+	}
+}
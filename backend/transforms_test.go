@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseFieldTransforms(t *testing.T) {
+	transforms, err := parseFieldTransforms(" company: trim, UPPER ; email:lower;;")
+	if err != nil {
+		t.Fatalf("parseFieldTransforms: %v", err)
+	}
+	if !slices.Equal(transforms["company"], []string{"trim", "upper"}) || !slices.Equal(transforms["email"], []string{"lower"}) || len(transforms) != 2 {
+		t.Errorf("transforms = %v", transforms)
+	}
+
+	for _, spec := range []string{"company", "favoriteColor:trim", "company:reverse"} {
+		if _, err := parseFieldTransforms(spec); err == nil {
+			t.Errorf("parseFieldTransforms(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestApplyFieldTransforms(t *testing.T) {
+	tests := []struct {
+		spec string
+		in   ContactRequest
+		want ContactRequest
+	}{
+		{
+			"company:collapse-spaces,upper;email:trim,lower",
+			ContactRequest{Company: "  acme   corp ", Email: " Jane@Example.COM "},
+			ContactRequest{Company: "ACME CORP", Email: "jane@example.com"},
+		},
+		{
+			"country:trim,upper;city:collapse-spaces",
+			ContactRequest{Country: " gb ", City: "New\n  York"},
+			ContactRequest{Country: "GB", City: "New York"},
+		},
+		// Operations run in the order given
+		{
+			"name:upper,lower",
+			ContactRequest{Name: "Jane"},
+			ContactRequest{Name: "jane"},
+		},
+		{
+			"",
+			ContactRequest{Name: " Jane "},
+			ContactRequest{Name: " Jane "},
+		},
+	}
+	for _, tt := range tests {
+		transforms, err := parseFieldTransforms(tt.spec)
+		if err != nil {
+			t.Fatalf("parseFieldTransforms(%q): %v", tt.spec, err)
+		}
+		req := tt.in
+		applyFieldTransforms(&Config{FieldTransforms: transforms}, &req)
+		if !reflect.DeepEqual(req, tt.want) {
+			t.Errorf("FIELD_TRANSFORMS=%q: got %+v, want %+v", tt.spec, req, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// vcardLineLimit is the folding width in octets for vCard 3.0 (RFC 2426)
+const vcardLineLimit = 75
+
+// vcardEscaper escapes text values per RFC 2426 section 4
+var vcardEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	",", `\,`,
+	";", `\;`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// vcardFilenamePattern matches runs of characters left out of attachment
+// filenames
+var vcardFilenamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// buildVCard renders the lead as a vCard 3.0 contact with CRLF line endings
+// and folded long lines. Empty fields are omitted; the phone is written in
+// E.164 form when it normalizes.
+func buildVCard(cfg *Config, req ContactRequest) string {
+	firstName, lastName := parseName(req.Name)
+
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"N:" + vcardEscaper.Replace(lastName) + ";" + vcardEscaper.Replace(firstName) + ";;;",
+		"FN:" + vcardEscaper.Replace(strings.TrimSpace(req.Name)),
+	}
+	if req.Company != "" {
+		lines = append(lines, "ORG:"+vcardEscaper.Replace(req.Company))
+	}
+	if req.Title != "" {
+		lines = append(lines, "TITLE:"+vcardEscaper.Replace(req.Title))
+	}
+	if req.Email != "" {
+		lines = append(lines, "EMAIL;TYPE=INTERNET:"+vcardEscaper.Replace(req.Email))
+	}
+	if phone := normalizePhone(req.Phone, defaultPhoneCountry(cfg)); phone != "" {
+		lines = append(lines, "TEL;TYPE=WORK,VOICE:"+phone)
+	}
+	lines = append(lines, "END:VCARD")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldVCardLine(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// foldVCardLine splits a content line longer than vcardLineLimit octets into
+// continuation lines starting with a space, never splitting a UTF-8 rune
+func foldVCardLine(line string) string {
+	var b strings.Builder
+	limit := vcardLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines lose one octet to the leading space
+		limit = vcardLineLimit - 1
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// vcardFilename returns the attachment name for a lead's vCard
+func vcardFilename(req ContactRequest) string {
+	slug := strings.Trim(vcardFilenamePattern.ReplaceAllString(strings.ToLower(req.Name), "-"), "-")
+	if slug == "" {
+		slug = "lead"
+	}
+	return slug + ".vcf"
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBuildVCardFull(t *testing.T) {
+	req := ContactRequest{
+		Name:    "Jane O'Neil-Doe",
+		Email:   "jane@example.com",
+		Phone:   "(415) 555-0100",
+		Company: "Acme, Inc; \\ Widgets",
+		Title:   "VP, Design\nand Brand",
+	}
+
+	want := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"N:O'Neil-Doe;Jane;;;\r\n" +
+		"FN:Jane O'Neil-Doe\r\n" +
+		"ORG:Acme\\, Inc\\; \\\\ Widgets\r\n" +
+		"TITLE:VP\\, Design\\nand Brand\r\n" +
+		"EMAIL;TYPE=INTERNET:jane@example.com\r\n" +
+		"TEL;TYPE=WORK,VOICE:+14155550100\r\n" +
+		"END:VCARD\r\n"
+	if got := buildVCard(&Config{}, req); got != want {
+		t.Errorf("vCard =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildVCardMinimal(t *testing.T) {
+	want := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"N:;Cher;;;\r\n" +
+		"FN:Cher\r\n" +
+		"EMAIL;TYPE=INTERNET:cher@example.com\r\n" +
+		"END:VCARD\r\n"
+	if got := buildVCard(&Config{}, ContactRequest{Name: "Cher", Email: "cher@example.com", Phone: "12"}); got != want {
+		t.Errorf("vCard =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBuildVCardFoldsLongLines(t *testing.T) {
+	req := ContactRequest{Name: "Jane Doe", Company: strings.Repeat("Ünïcödé ", 20)}
+	card := buildVCard(&Config{}, req)
+
+	for _, line := range strings.Split(strings.TrimSuffix(card, "\r\n"), "\r\n") {
+		if len(line) > vcardLineLimit {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a rune: %q", line)
+		}
+	}
+
+	// Unfolding restores the value
+	unfolded := strings.ReplaceAll(card, "\r\n ", "")
+	if !strings.Contains(unfolded, "ORG:"+req.Company+"\r\n") {
+		t.Errorf("unfolded vCard lacks the company:\n%q", unfolded)
+	}
+}
+
+func TestVCardFilename(t *testing.T) {
+	tests := map[string]string{
+		"Jane O'Neil-Doe": "jane-o-neil-doe.vcf",
+		"  ":              "lead.vcf",
+		"José Álvarez":    "jos-lvarez.vcf",
+	}
+	for name, want := range tests {
+		if got := vcardFilename(ContactRequest{Name: name}); got != want {
+			t.Errorf("vcardFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// wafThreatScore returns the score our CDN/WAF put in the WAF_SCORE_HEADER
+// request header (e.g. X-Threat-Score) and whether it is above
+// WAF_SCORE_THRESHOLD. Both must be set; a missing or unparsable header
+// never blocks.
+func wafThreatScore(cfg *Config, r *http.Request) (float64, bool) {
+	if cfg.WAFScoreHeader == "" {
+		return 0, false
+	}
+
+	score, err := strconv.ParseFloat(strings.TrimSpace(r.Header.Get(cfg.WAFScoreHeader)), 64)
+	if err != nil {
+		return 0, false
+	}
+	return score, score > cfg.WAFScoreThreshold
+}
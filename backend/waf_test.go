@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWAFThreatScore(t *testing.T) {
+	tests := []struct {
+		header      string
+		threshold   float64
+		value       string
+		wantScore   float64
+		wantBlocked bool
+	}{
+		{"X-Threat-Score", 50, "80", 80, true},
+		{"X-Threat-Score", 50, " 50.5 ", 50.5, true},
+		{"X-Threat-Score", 50, "50", 50, false},
+		{"X-Threat-Score", 50, "3", 3, false},
+		{"X-Threat-Score", 50, "", 0, false},
+		{"X-Threat-Score", 50, "high", 0, false},
+		{"", 50, "80", 0, false},
+	}
+	for _, tt := range tests {
+		cfg := &Config{WAFScoreHeader: tt.header, WAFScoreThreshold: tt.threshold}
+		r := httptest.NewRequest("POST", "/api/contact", nil)
+		if tt.value != "" {
+			r.Header.Set("X-Threat-Score", tt.value)
+		}
+		if score, blocked := wafThreatScore(cfg, r); score != tt.wantScore || blocked != tt.wantBlocked {
+			t.Errorf("header %q, threshold %v, value %q: got %v, %v; want %v, %v", tt.header, tt.threshold, tt.value, score, blocked, tt.wantScore, tt.wantBlocked)
+		}
+	}
+}
+
+func postContactWithThreatScore(cfg *Config, score string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(validContactBody))
+	r.Header.Set("Content-Type", "application/json")
+	if score != "" {
+		r.Header.Set("X-Threat-Score", score)
+	}
+	handleContact(cfg)(w, r)
+	return w
+}
+
+func TestHandleContactWAFThreatScore(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+	cfg.WAFScoreHeader = "X-Threat-Score"
+	cfg.WAFScoreThreshold = 50
+	out := captureStandardLog(t)
+
+	// High scores get a normal success without anything being created
+	w := postContactWithThreatScore(cfg, "90")
+	if w.Code != http.StatusOK || !responseOf(t, w).Success {
+		t.Errorf("high score: status = %d, want a silent 200", w.Code)
+	}
+	if n := len(stub.operations()); n != 0 {
+		t.Errorf("high-score submission made %d CRM calls, want none", n)
+	}
+	if !strings.Contains(out.String(), "Dropped submission flagged by WAF (threat score 90)") {
+		t.Errorf("log = %q, want the drop logged", out.String())
+	}
+
+	// Normal scores and requests without the header are processed
+	for i, score := range []string{"10", ""} {
+		if w := postContactWithThreatScore(cfg, score); w.Code != http.StatusOK || stub.count("CreatePerson") != i+1 {
+			t.Errorf("score %q: status = %d, %d people created; want the lead processed", score, w.Code, stub.count("CreatePerson"))
+		}
+	}
+
+	// With the feature off even high scores are processed
+	cfg.WAFScoreHeader = ""
+	if w := postContactWithThreatScore(cfg, "90"); w.Code != http.StatusOK || stub.count("CreatePerson") != 3 {
+		t.Errorf("feature off: status = %d, %d people created; want the lead processed", w.Code, stub.count("CreatePerson"))
+	}
+}
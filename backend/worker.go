@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// leadJobMaxAge bounds how old a signed lead job timestamp may be
+const leadJobMaxAge = 5 * time.Minute
+
+// LeadJob is what the contact handler posts to LEAD_WORKER_URL. Location,
+// ScriptContent and EmailHash are carried separately since ContactRequest
+// never serializes them.
+type LeadJob struct {
+	SubmissionID  string         `json:"submissionId"`
+	Request       ContactRequest `json:"request"`
+	Location      *GeoLocation   `json:"location,omitempty"`
+	ScriptContent bool           `json:"scriptContent,omitempty"`
+	EmailHash     string         `json:"emailHash,omitempty"`
+}
+
+// signLeadJob returns the hex HMAC-SHA256 of timestamp + "." + body
+func signLeadJob(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyLeadJob checks the signature headers of a lead job and that its
+// timestamp is recent
+func verifyLeadJob(secret, timestamp, signature string, body []byte, now time.Time) error {
+	expected := signLeadJob(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > leadJobMaxAge || age < -leadJobMaxAge {
+		return fmt.Errorf("timestamp outside the allowed window (%s)", age.Round(time.Second))
+	}
+
+	return nil
+}
+
+// errWorkerRejected marks a dispatch the worker answered with a non-2xx
+// status. The worker only answers once it has queued or refused a job, so
+// a rejected job was never taken and is safe to process elsewhere.
+var errWorkerRejected = errors.New("worker rejected the job")
+
+// dispatchLead posts the lead to the external worker, signed with
+// LEAD_WORKER_SECRET. Errors wrap errWorkerRejected when the worker refused
+// the job, or a dial error when it was never sent; any other error (such as
+// a timeout waiting for the answer) means the worker may have the job.
+func dispatchLead(ctx context.Context, workerURL, secret, submissionID string, req ContactRequest) error {
+	body, err := json.Marshal(LeadJob{
+		SubmissionID:  submissionID,
+		Request:       req,
+		Location:      req.Location,
+		ScriptContent: req.ScriptContent,
+		EmailHash:     req.EmailHash,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", workerURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(systemClock.Now().Unix(), 10)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Lead-Timestamp", timestamp)
+	httpReq.Header.Set("X-Lead-Signature", signLeadJob(secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A gateway error leaves it unknown whether the worker got the job
+	if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout {
+		return fmt.Errorf("worker gateway returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%w: status %d: %s", errWorkerRejected, resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+// leadJobUndelivered reports whether a dispatchLead error means the worker
+// certainly doesn't have the job: it refused it, or the connection was
+// never made
+func leadJobUndelivered(err error) bool {
+	if errors.Is(err, errWorkerRejected) {
+		return true
+	}
+	return isDialError(err)
+}
+
+// leadJobs holds verified jobs waiting for a lead worker goroutine; it is
+// nil until startLeadWorkers runs
+var leadJobs chan LeadJob
+
+// leadWorkerConcurrency returns LEAD_WORKER_CONCURRENCY, how many queued
+// jobs are processed at once (default 4)
+func leadWorkerConcurrency(cfg *Config) int {
+	if cfg.LeadWorkerConcurrency > 0 {
+		return cfg.LeadWorkerConcurrency
+	}
+	return 4
+}
+
+// leadWorkerQueueSize returns LEAD_WORKER_QUEUE_SIZE, how many accepted jobs
+// may wait for processing before new ones are refused (default 100)
+func leadWorkerQueueSize(cfg *Config) int {
+	if cfg.LeadWorkerQueueSize > 0 {
+		return cfg.LeadWorkerQueueSize
+	}
+	return 100
+}
+
+// startLeadWorkers starts the goroutines that process queued lead jobs.
+// The returned function stops accepting jobs and waits for the queued ones
+// to finish.
+func startLeadWorkers(cfg *Config, concurrency, queueSize int) func() {
+	leadJobs = make(chan LeadJob, queueSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(jobs <-chan LeadJob) {
+			defer wg.Done()
+			for job := range jobs {
+				processLeadJob(cfg, job)
+			}
+		}(leadJobs)
+	}
+
+	return func() {
+		close(leadJobs)
+		wg.Wait()
+	}
+}
+
+// processLeadJob runs the CRM/notification pipeline for a queued job.
+// Failures are recorded on the submission for the dead-letter replay.
+func processLeadJob(cfg *Config, job LeadJob) {
+	req := job.Request
+	req.Location = job.Location
+	req.ScriptContent = job.ScriptContent
+	req.EmailHash = job.EmailHash
+
+	// The submission is shared when both sides use the Postgres store;
+	// otherwise track it locally under the same ID
+	submission, err := store.GetSubmission(job.SubmissionID)
+	if err != nil {
+		log.Printf("Warning: Failed to load submission %s: %v", job.SubmissionID, err)
+	}
+	if submission == nil {
+		submission = &Submission{ID: job.SubmissionID, Status: submissionReceived, Request: req}
+		if err := store.SaveSubmission(submission); err != nil {
+			logThrottled("Warning: Failed to record submission: %v", err)
+		}
+	}
+
+	completeLead(context.Background(), cfg, submission, req, leadPipelineAttempts(cfg))
+}
+
+// handleProcessLead accepts a lead dispatched by another instance. Requests
+// must be signed with LEAD_WORKER_SECRET (the route is only registered when
+// it is set), and each signature is accepted once. The job is queued and
+// acknowledged with 202 before any processing, so the dispatcher never
+// waits on the CRM; 503 means the queue is full and the job was not taken.
+func handleProcessLead(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxDecompressedBody(cfg)))
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		signature := r.Header.Get("X-Lead-Signature")
+		err = verifyLeadJob(cfg.LeadWorkerSecret, r.Header.Get("X-Lead-Timestamp"), signature, body, systemClock.Now())
+		if err != nil {
+			log.Printf("Rejected lead job: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var job LeadJob
+		if err := json.Unmarshal(body, &job); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Signatures stay valid for the whole timestamp window, so remember
+		// each one for that long and refuse replays
+		seenKey := "lead-job:" + signature
+		n, err := store.Incr(seenKey, 2*leadJobMaxAge)
+		if err != nil {
+			log.Printf("Warning: Failed to check lead job replay: %v", err)
+			http.Error(w, "Failed to accept lead job", http.StatusServiceUnavailable)
+			return
+		}
+		if n > 1 {
+			log.Printf("Rejected replayed lead job for submission %s", job.SubmissionID)
+			http.Error(w, "Lead job already received", http.StatusConflict)
+			return
+		}
+
+		select {
+		case leadJobs <- job:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			// Not queued, so let a redelivery of the same job through
+			store.Delete(seenKey)
+			logThrottled("Warning: Lead job queue full, refusing submission %s", job.SubmissionID)
+			http.Error(w, "Lead job queue full", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// markDispatchUnknown flags a submission whose dispatch outcome is unknown
+// as failed, so it shows up for dead-letter replay if the worker never got
+// it. A worker that did get it has already moved it past "received".
+func markDispatchUnknown(submissionID string, dispatchErr error) {
+	sub, err := store.GetSubmission(submissionID)
+	if err != nil || sub == nil || sub.Status != submissionReceived {
+		return
+	}
+	sub.Status = submissionFailed
+	sub.LastError = "worker dispatch outcome unknown: " + dispatchErr.Error()
+	if err := store.SaveSubmission(sub); err != nil {
+		logThrottled("Warning: Failed to update submission %s: %v", sub.ID, err)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatchLeadCarriesEmailHash(t *testing.T) {
+	jobs := make(chan LeadJob, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job LeadJob
+		json.NewDecoder(r.Body).Decode(&job)
+		jobs <- job
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	req := ContactRequest{Email: "jane@example.com", EmailHash: "abc123"}
+	if err := dispatchLead(context.Background(), srv.URL, "secret", "sub-1", req); err != nil {
+		t.Fatalf("dispatchLead: %v", err)
+	}
+	if job := <-jobs; job.EmailHash != "abc123" {
+		t.Errorf("job emailHash = %q, want abc123", job.EmailHash)
+	}
+}
+
+// stubWorker answers lead dispatches with status, recording each job
+type stubWorker struct {
+	*httptest.Server
+	status int
+	jobs   chan LeadJob
+	errs   chan error
+}
+
+func newStubWorker(t *testing.T, secret string, status int) *stubWorker {
+	t.Helper()
+	w := &stubWorker{status: status, jobs: make(chan LeadJob, 10), errs: make(chan error, 10)}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.errs <- verifyLeadJob(secret, r.Header.Get("X-Lead-Timestamp"), r.Header.Get("X-Lead-Signature"), body, systemClock.Now())
+		var job LeadJob
+		json.Unmarshal(body, &job)
+		w.jobs <- job
+		rw.WriteHeader(w.status)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// useLeadJobs replaces the worker queue with one of the given size
+func useLeadJobs(t *testing.T, size int) chan LeadJob {
+	t.Helper()
+	previous := leadJobs
+	leadJobs = make(chan LeadJob, size)
+	t.Cleanup(func() { leadJobs = previous })
+	return leadJobs
+}
+
+// signedLeadJob builds a /internal/process-lead request signed at now
+func signedLeadJob(t *testing.T, secret string, job LeadJob, now time.Time) *http.Request {
+	t.Helper()
+	body, _ := json.Marshal(job)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	r := httptest.NewRequest("POST", "/internal/process-lead", bytes.NewReader(body))
+	r.Header.Set("X-Lead-Timestamp", timestamp)
+	r.Header.Set("X-Lead-Signature", signLeadJob(secret, timestamp, body))
+	return r
+}
+
+func TestDispatchLeadSignsJob(t *testing.T) {
+	useSystemClock(t)
+	worker := newStubWorker(t, "secret", http.StatusAccepted)
+
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com", Location: &GeoLocation{Country: "US"}, ScriptContent: true}
+	if err := dispatchLead(context.Background(), worker.URL, "secret", "sub-1", req); err != nil {
+		t.Fatalf("dispatchLead: %v", err)
+	}
+	if err := <-worker.errs; err != nil {
+		t.Errorf("worker rejected the signature: %v", err)
+	}
+	job := <-worker.jobs
+	if job.SubmissionID != "sub-1" || job.Request.Email != "jane@example.com" || job.Location == nil || job.Location.Country != "US" || !job.ScriptContent {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestDispatchLeadErrors(t *testing.T) {
+	useSystemClock(t)
+	tests := []struct {
+		status      int
+		undelivered bool
+	}{
+		{http.StatusServiceUnavailable, true},
+		{http.StatusUnauthorized, true},
+		{http.StatusBadGateway, false},
+		{http.StatusGatewayTimeout, false},
+	}
+	for _, tt := range tests {
+		worker := newStubWorker(t, "secret", tt.status)
+		err := dispatchLead(context.Background(), worker.URL, "secret", "sub-1", ContactRequest{})
+		if err == nil || leadJobUndelivered(err) != tt.undelivered {
+			t.Errorf("status %d: err = %v, undelivered = %v; want %v", tt.status, err, leadJobUndelivered(err), tt.undelivered)
+		}
+	}
+
+	// A worker that can't be reached certainly didn't get the job
+	worker := newStubWorker(t, "secret", http.StatusAccepted)
+	worker.Close()
+	if err := dispatchLead(context.Background(), worker.URL, "secret", "sub-1", ContactRequest{}); err == nil || !leadJobUndelivered(err) {
+		t.Errorf("unreachable worker: err = %v, want an undelivered error", err)
+	}
+}
+
+func TestVerifyLeadJob(t *testing.T) {
+	body := []byte(`{"submissionId":"sub-1"}`)
+	timestamp := strconv.FormatInt(testEpoch.Unix(), 10)
+	signature := signLeadJob("secret", timestamp, body)
+
+	if err := verifyLeadJob("secret", timestamp, signature, body, testEpoch); err != nil {
+		t.Fatalf("valid job rejected: %v", err)
+	}
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		timestamp string
+		now       time.Time
+	}{
+		{"wrong secret", "other", body, timestamp, testEpoch},
+		{"tampered body", "secret", []byte(`{"submissionId":"sub-2"}`), timestamp, testEpoch},
+		{"stale", "secret", body, timestamp, testEpoch.Add(leadJobMaxAge + time.Second)},
+		{"tampered timestamp", "secret", body, timestamp + "0", testEpoch},
+	}
+	for _, tt := range tests {
+		if err := verifyLeadJob(tt.secret, tt.timestamp, signature, tt.body, tt.now); err == nil {
+			t.Errorf("%s: job accepted", tt.name)
+		}
+	}
+}
+
+func TestHandleProcessLead(t *testing.T) {
+	useMemoryStore(t)
+	clock := useSystemClock(t)
+	jobs := useLeadJobs(t, 1)
+	cfg := &Config{LeadWorkerSecret: "secret"}
+	job := LeadJob{SubmissionID: "sub-1", Request: ContactRequest{Email: "jane@example.com"}}
+
+	// Accepted jobs are queued and acknowledged before processing
+	r := signedLeadJob(t, "secret", job, clock.Now())
+	w := httptest.NewRecorder()
+	handleProcessLead(cfg)(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", w.Code)
+	}
+	if queued := <-jobs; queued.SubmissionID != "sub-1" {
+		t.Errorf("queued job = %+v", queued)
+	}
+
+	// The same signed request is refused the second time
+	w = httptest.NewRecorder()
+	handleProcessLead(cfg)(w, signedLeadJob(t, "secret", job, clock.Now()))
+	if w.Code != http.StatusConflict {
+		t.Errorf("replay: status = %d, want 409", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleProcessLead(cfg)(w, signedLeadJob(t, "wrong", job, clock.Now()))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature: status = %d, want 401", w.Code)
+	}
+}
+
+func TestHandleProcessLeadQueueFull(t *testing.T) {
+	useMemoryStore(t)
+	clock := useSystemClock(t)
+	jobs := useLeadJobs(t, 1)
+	cfg := &Config{LeadWorkerSecret: "secret"}
+	jobs <- LeadJob{SubmissionID: "waiting"}
+
+	job := LeadJob{SubmissionID: "sub-1"}
+	w := httptest.NewRecorder()
+	handleProcessLead(cfg)(w, signedLeadJob(t, "secret", job, clock.Now()))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+
+	// The refused job can be redelivered once there's room
+	<-jobs
+	w = httptest.NewRecorder()
+	handleProcessLead(cfg)(w, signedLeadJob(t, "secret", job, clock.Now()))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("redelivery: status = %d, want 202", w.Code)
+	}
+}
+
+func TestHandleContactDispatchesToWorker(t *testing.T) {
+	useMemoryStore(t)
+	useSystemClock(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+	cfg.LeadWorkerSecret = "secret"
+
+	t.Run("accepted", func(t *testing.T) {
+		worker := newStubWorker(t, "secret", http.StatusAccepted)
+		cfg.LeadWorkerURL = worker.URL
+
+		w := postContact(cfg, validContactBody)
+		if w.Code != http.StatusAccepted || !responseOf(t, w).Success {
+			t.Fatalf("status = %d, want 202", w.Code)
+		}
+		if err := <-worker.errs; err != nil {
+			t.Errorf("worker rejected the signature: %v", err)
+		}
+		if job := <-worker.jobs; job.Request.Email != "jane@example.com" || job.SubmissionID == "" {
+			t.Errorf("job = %+v", job)
+		}
+		if n := len(stub.operations()); n != 0 {
+			t.Errorf("%d CRM calls from the web tier, want none", n)
+		}
+	})
+
+	t.Run("rejected falls back in-process", func(t *testing.T) {
+		worker := newStubWorker(t, "secret", http.StatusServiceUnavailable)
+		cfg.LeadWorkerURL = worker.URL
+
+		if w := postContact(cfg, validContactBody); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 from in-process handling", w.Code)
+		}
+		if n := stub.count("CreateOpportunity"); n != 1 {
+			t.Errorf("%d opportunities created, want 1", n)
+		}
+	})
+
+	t.Run("unknown outcome is left to the worker", func(t *testing.T) {
+		worker := newStubWorker(t, "secret", http.StatusBadGateway)
+		cfg.LeadWorkerURL = worker.URL
+		before := stub.count("CreateOpportunity")
+
+		if w := postContact(cfg, validContactBody); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202", w.Code)
+		}
+		job := <-worker.jobs
+		if n := stub.count("CreateOpportunity"); n != before {
+			t.Errorf("lead processed in-process too")
+		}
+		if sub, _ := store.GetSubmission(job.SubmissionID); sub == nil || sub.Status != submissionFailed {
+			t.Errorf("submission = %+v, want it marked failed for replay", sub)
+		}
+	})
+}
+
+func TestProcessLeadJob(t *testing.T) {
+	useMemoryStore(t)
+	stub, cfg := useTwentyStub(t)
+	cfg.NotifyChannels = []string{"teams"}
+
+	processLeadJob(cfg, LeadJob{SubmissionID: "sub-1", Request: ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}})
+	if n := stub.count("CreateOpportunity"); n != 1 {
+		t.Errorf("%d opportunities created, want 1", n)
+	}
+	if sub, _ := store.GetSubmission("sub-1"); sub == nil || sub.Status != submissionProcessed {
+		t.Errorf("submission = %+v, want it processed", sub)
+	}
+}
+
+func TestProcessLeadJobRetriesPipeline(t *testing.T) {
+	useMemoryStore(t)
+	clock := useSystemClock(t)
+	stub, cfg := useTwentyStub(t)
+	stub.on("CreateOpportunity", `{"errors":[{"message":"boom"}]}`, `{"data":{"createOpportunity":{"id":"opportunity-1"}}}`)
+	cfg.LeadPipelineAttempts = 2
+	cfg.LeadPipelineRetryDelay = 5 * time.Second
+	cfg.NotifyChannels = []string{"teams"}
+	out := captureStandardLog(t)
+
+	req := ContactRequest{Name: "Jane Doe", Email: "jane@example.com"}
+	processLeadJob(cfg, LeadJob{SubmissionID: "sub-1", Request: req, EmailHash: "hash-1"})
+	if n := stub.count("CreateOpportunity"); n != 2 {
+		t.Errorf("%d opportunity creates, want 2", n)
+	}
+	if n := stub.count("CreatePerson"); n != 1 {
+		t.Errorf("%d person creates, want the retry to resume", n)
+	}
+	if waited := clock.Now().Sub(testEpoch); waited != 5*time.Second {
+		t.Errorf("backed off for %v, want 5s", waited)
+	}
+	if sub, _ := store.GetSubmission("sub-1"); sub == nil || sub.Status != submissionProcessed {
+		t.Errorf("submission = %+v, want it processed", sub)
+	}
+	_, retry, found := strings.Cut(out.String(), "Lead pipeline attempt")
+	retry, _, _ = strings.Cut(retry, "\n")
+	if !found || strings.Contains(retry, "jane@example.com") || !strings.Contains(retry, "email_hash=hash-1") {
+		t.Errorf("retry log should carry the hash, not the address: %s", retry)
+	}
+}
+
+func TestHandleContactDoesNotRetryPipeline(t *testing.T) {
+	useMemoryStore(t)
+	clock := useSystemClock(t)
+	stub, cfg := useTwentyStub(t)
+	stub.on("CreateOpportunity", `{"errors":[{"message":"boom"}]}`)
+	cfg.LeadPipelineAttempts = 3
+	cfg.NotifyChannels = []string{"teams"}
+
+	postContact(cfg, validContactBody)
+	if n := stub.count("CreateOpportunity"); n != 1 {
+		t.Errorf("%d opportunity creates in the request, want 1", n)
+	}
+	if waited := clock.Now().Sub(testEpoch); waited != 0 {
+		t.Errorf("request backed off for %v, want no wait", waited)
+	}
+}